@@ -0,0 +1,225 @@
+// Package artifacts resolves artifacts of tasks found in the index, e.g. "the
+// latest public/build/target.tar.bz2 indexed under namespace X, or else
+// under namespace Y", and downloads them.
+//
+// For example:
+//
+//	resolver := artifacts.NewResolver(index.New("", ""), queue.New("", ""))
+//	artifact, err := resolver.Resolve(
+//		"public/build/target.tar.bz2",
+//		"gecko.v2.mozilla-central.latest.firefox.linux64-opt",
+//		"buildbot.branches.mozilla-central.linux64",
+//	)
+//	if err != nil {
+//		// handle error...
+//	}
+//	digest, err := resolver.DownloadFile(artifact, "target.tar.bz2", expectedSHA256)
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/httpbackoff"
+	"github.com/taskcluster/taskcluster-client-go/index"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	D "github.com/tj/go-debug"
+)
+
+var (
+	// Used for logging based on DEBUG environment variable
+	// See github.com/tj/go-debug
+	debug = D.Debug("artifacts")
+)
+
+// Artifact is an artifact resolved from the index.
+type Artifact struct {
+	// Namespace the task was found under
+	Namespace string
+	TaskId    string
+	// The latest run of the task
+	RunId int
+	Name  string
+	// Url to fetch the artifact from, signed if the artifact is not public
+	URL         string
+	ContentType string
+	Expires     queue.Time
+	StorageType string
+}
+
+// NotFoundError is returned by Resolver.Resolve when the artifact could not
+// be found under any of the namespaces.
+type NotFoundError struct {
+	Name string
+	// Reason the artifact was not found, for each namespace tried
+	Reasons []string
+}
+
+func (err *NotFoundError) Error() string {
+	return fmt.Sprintf("artifact %v not found:\n  * %v", err.Name, strings.Join(err.Reasons, "\n  * "))
+}
+
+// ChecksumError is returned when a downloaded artifact does not have the
+// expected SHA256 digest.
+type ChecksumError struct {
+	URL      string
+	Expected string
+	Actual   string
+}
+
+func (err *ChecksumError) Error() string {
+	return fmt.Sprintf("artifact %v has SHA256 digest %v, but %v was expected", err.URL, err.Actual, err.Expected)
+}
+
+// Resolver finds artifacts of indexed tasks.
+type Resolver struct {
+	Index *index.Index
+	Queue *queue.Queue
+	// How long signed urls of non-public artifacts are valid for
+	SignedURLDuration time.Duration
+}
+
+// NewResolver returns a Resolver which finds tasks with myIndex, and their
+// artifacts with myQueue. Signed urls are valid for 15 minutes.
+func NewResolver(myIndex *index.Index, myQueue *queue.Queue) *Resolver {
+	return &Resolver{
+		Index:             myIndex,
+		Queue:             myQueue,
+		SignedURLDuration: 15 * time.Minute,
+	}
+}
+
+// Resolve tries each of the namespaces in turn, and returns artifact name of
+// the latest run of the first task found which has it. A namespace is
+// skipped if no task is indexed under it, or if the task has no runs, or
+// its latest run has no such artifact; if all namespaces are skipped, a
+// *NotFoundError is returned. Any other failure is returned immediately,
+// rather than falling back to the next namespace.
+func (resolver *Resolver) Resolve(name string, namespaces ...string) (*Artifact, error) {
+	notFound := &NotFoundError{Name: name}
+	for _, namespace := range namespaces {
+		artifact, reason, err := resolver.resolve(name, namespace)
+		if err != nil || artifact != nil {
+			return artifact, err
+		}
+		debug("Artifact %v not found under %v: %v", name, namespace, reason)
+		notFound.Reasons = append(notFound.Reasons, namespace+": "+reason)
+	}
+	if len(namespaces) == 0 {
+		notFound.Reasons = append(notFound.Reasons, "no namespaces given")
+	}
+	return nil, notFound
+}
+
+// resolve returns the artifact, or the reason it was not found under
+// namespace, or an error
+func (resolver *Resolver) resolve(name, namespace string) (*Artifact, string, error) {
+	indexedTask, callSummary := resolver.Index.FindTask(namespace)
+	if notFound(callSummary.HttpResponse) {
+		return nil, "no task indexed", nil
+	}
+	if callSummary.Error != nil {
+		return nil, "", fmt.Errorf("could not find task indexed under %v: %v", namespace, callSummary.Error)
+	}
+	taskId := indexedTask.TaskId
+
+	tsr, cs := resolver.Queue.Status(taskId)
+	if notFound(cs.HttpResponse) {
+		return nil, "task " + taskId + " not found", nil
+	}
+	if cs.Error != nil {
+		return nil, "", fmt.Errorf("could not get status of task %v: %v", taskId, cs.Error)
+	}
+	runs := tsr.Status.Runs
+	if len(runs) == 0 {
+		return nil, "task " + taskId + " has no runs", nil
+	}
+	runId := runs[len(runs)-1].RunId
+
+	artifacts, cs := resolver.Queue.ListArtifacts(taskId, strconv.Itoa(runId))
+	if cs.Error != nil {
+		return nil, "", fmt.Errorf("could not list artifacts of task %v run %v: %v", taskId, runId, cs.Error)
+	}
+	for _, a := range artifacts.Artifacts {
+		if a.Name != name {
+			continue
+		}
+		u, err := resolver.Queue.ArtifactURL(taskId, runId, name, resolver.SignedURLDuration)
+		if err != nil {
+			return nil, "", err
+		}
+		return &Artifact{
+			Namespace:   namespace,
+			TaskId:      taskId,
+			RunId:       runId,
+			Name:        name,
+			URL:         u.String(),
+			ContentType: a.ContentType,
+			Expires:     a.Expires,
+			StorageType: a.StorageType,
+		}, "", nil
+	}
+	return nil, fmt.Sprintf("task %v run %v has no such artifact", taskId, runId), nil
+}
+
+func notFound(response *http.Response) bool {
+	return response != nil && response.StatusCode == http.StatusNotFound
+}
+
+// Download writes the artifact to out, and returns the hex encoded SHA256
+// digest of the data written. If expectedSHA256 is not empty, and does not
+// match the digest, a *ChecksumError is returned, but note that the data has
+// already been written to out; see DownloadFile.
+func (resolver *Resolver) Download(artifact *Artifact, out io.Writer, expectedSHA256 string) (string, error) {
+	response, _, err := httpbackoff.Retry(func() (*http.Response, error, error) {
+		resp, err := http.Get(artifact.URL)
+		return resp, err, nil
+	})
+	if err != nil {
+		if response != nil {
+			response.Body.Close()
+		}
+		return "", fmt.Errorf("could not download artifact %v: %v", artifact.URL, err)
+	}
+	defer response.Body.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), response.Body); err != nil {
+		return "", fmt.Errorf("could not download artifact %v: %v", artifact.URL, err)
+	}
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(digest, expectedSHA256) {
+		return digest, &ChecksumError{URL: artifact.URL, Expected: expectedSHA256, Actual: digest}
+	}
+	return digest, nil
+}
+
+// DownloadFile downloads the artifact to a temporary file in the same
+// directory as path, and only renames it to path if the download succeeds,
+// and has the expected SHA256 digest (if given). It returns the hex encoded
+// SHA256 digest of the artifact.
+func (resolver *Resolver) DownloadFile(artifact *Artifact, path, expectedSHA256 string) (string, error) {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	digest, err := resolver.Download(artifact, file, expectedSHA256)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return digest, err
+}
@@ -0,0 +1,99 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster-client-go/index"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+)
+
+const content = "target contents"
+
+// newResolver returns a resolver for a fake index, with namespace "missing"
+// empty, "old" pointing at a task without the artifact, and "latest"
+// pointing at a task with it.
+func newResolver(t *testing.T) (*Resolver, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index/task/old":
+			w.Write([]byte(`{"taskId": "XgvL0qtSR92cIWpcwdGKCA"}`))
+		case "/index/task/latest":
+			w.Write([]byte(`{"taskId": "Gu3BJf0IQeuJE-HFKtYI2A"}`))
+		case "/queue/task/XgvL0qtSR92cIWpcwdGKCA/status", "/queue/task/Gu3BJf0IQeuJE-HFKtYI2A/status":
+			w.Write([]byte(`{"status": {"runs": [{"runId": 0}, {"runId": 1}]}}`))
+		case "/queue/task/XgvL0qtSR92cIWpcwdGKCA/runs/1/artifacts":
+			w.Write([]byte(`{"artifacts": [{"name": "public/logs/live.log"}]}`))
+		case "/queue/task/Gu3BJf0IQeuJE-HFKtYI2A/runs/1/artifacts":
+			w.Write([]byte(`{"artifacts": [{"name": "public/build/target.tar.bz2", "contentType": "application/x-bzip2", "storageType": "s3"}]}`))
+		case "/queue/task/Gu3BJf0IQeuJE-HFKtYI2A/runs/1/artifacts/public/build/target.tar.bz2":
+			w.Write([]byte(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	myIndex := index.New("", "")
+	myIndex.BaseURL = server.URL + "/index"
+	myQueue := queue.New("", "")
+	myQueue.BaseURL = server.URL + "/queue"
+	return NewResolver(myIndex, myQueue), server
+}
+
+func TestResolveWithFallbacks(t *testing.T) {
+	resolver, server := newResolver(t)
+	defer server.Close()
+	artifact, err := resolver.Resolve("public/build/target.tar.bz2", "missing", "old", "latest")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if artifact.Namespace != "latest" || artifact.TaskId != "Gu3BJf0IQeuJE-HFKtYI2A" || artifact.RunId != 1 || artifact.ContentType != "application/x-bzip2" {
+		t.Errorf("Unexpected artifact %#v", artifact)
+	}
+
+	_, err = resolver.Resolve("public/build/target.tar.bz2", "missing", "old")
+	notFound, ok := err.(*NotFoundError)
+	if !ok || len(notFound.Reasons) != 2 || !strings.Contains(notFound.Reasons[1], "has no such artifact") {
+		t.Errorf("Expected NotFoundError with 2 reasons, but got %v", err)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	resolver, server := newResolver(t)
+	defer server.Close()
+	artifact, err := resolver.Resolve("public/build/target.tar.bz2", "latest")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "target.tar.bz2")
+	sum := sha256.Sum256([]byte(content))
+	expected := hex.EncodeToString(sum[:])
+
+	if _, err := resolver.DownloadFile(artifact, path, strings.Repeat("0", 64)); err == nil {
+		t.Errorf("Expected checksum error")
+	} else if _, ok := err.(*ChecksumError); !ok {
+		t.Errorf("Expected *ChecksumError, but got %v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected no files after failed download, but found %v", len(files))
+	}
+
+	digest, err := resolver.DownloadFile(artifact, path, expected)
+	if err != nil || digest != expected {
+		t.Fatalf("Expected digest %v without error, but got %v (%v)", expected, digest, err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != content {
+		t.Errorf("Unexpected file content %q", data)
+	}
+}
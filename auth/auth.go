@@ -85,6 +85,7 @@ import (
 	"time"
 
 	"github.com/taskcluster/httpbackoff"
+	"github.com/taskcluster/taskcluster-client-go/relativetime"
 	hawk "github.com/tent/hawk-go"
 	D "github.com/tj/go-debug"
 )
@@ -445,9 +446,9 @@ func (myAuth *Auth) AuthenticateHawk(payload *HawkSignatureAuthenticationRequest
 //   * auth:credentials
 //
 // See http://docs.taskcluster.net/auth/api-docs/#importClients
-func (myAuth *Auth) ImportClients(payload *ExportedClients) *CallSummary {
-	_, callSummary := myAuth.apiCall(payload, "POST", "/import-clients", nil)
-	return callSummary
+func (myAuth *Auth) ImportClients(payload *ExportedClients) (*ExportedClients, *CallSummary) {
+	responseObject, callSummary := myAuth.apiCall(payload, "POST", "/import-clients", new(ExportedClients))
+	return responseObject.(*ExportedClients), callSummary
 }
 
 // Documented later...
@@ -455,9 +456,9 @@ func (myAuth *Auth) ImportClients(payload *ExportedClients) *CallSummary {
 // **Warning** this api end-point is **not stable**.
 //
 // See http://docs.taskcluster.net/auth/api-docs/#ping
-func (myAuth *Auth) Ping() *CallSummary {
-	_, callSummary := myAuth.apiCall(nil, "GET", "/ping", nil)
-	return callSummary
+func (myAuth *Auth) Ping() (*json.RawMessage, *CallSummary) {
+	responseObject, callSummary := myAuth.apiCall(nil, "GET", "/ping", new(json.RawMessage))
+	return responseObject.(*json.RawMessage), callSummary
 }
 
 type (
@@ -744,3 +745,12 @@ func (t *Time) UnmarshalJSON(data []byte) (err error) {
 func (t Time) String() string {
 	return time.Time(t).UTC().Format("2006-01-02T15:04:05.000Z")
 }
+
+// FromNow returns the Time which is the given relative time expression from
+// now, e.g. "2 days 3 hours", "in 1 day" or "-30 minutes". See package
+// github.com/taskcluster/taskcluster-client-go/relativetime for the supported
+// syntax.
+func FromNow(expr string) (Time, error) {
+	t, err := relativetime.FromNow(expr)
+	return Time(t), err
+}
@@ -68,6 +68,7 @@ import (
 	"time"
 
 	"github.com/taskcluster/httpbackoff"
+	"github.com/taskcluster/taskcluster-client-go/relativetime"
 	hawk "github.com/tent/hawk-go"
 	D "github.com/tj/go-debug"
 )
@@ -411,9 +412,9 @@ func (awsProvisioner *AwsProvisioner) GetLaunchSpecs(workerType string) (*GetAll
 //   * aws-provisioner:aws-state
 //
 // See http://docs.taskcluster.net/aws-provisioner/api-docs/#awsState
-func (awsProvisioner *AwsProvisioner) AwsState() *CallSummary {
-	_, callSummary := awsProvisioner.apiCall(nil, "GET", "/aws-state", nil)
-	return callSummary
+func (awsProvisioner *AwsProvisioner) AwsState() (*json.RawMessage, *CallSummary) {
+	responseObject, callSummary := awsProvisioner.apiCall(nil, "GET", "/aws-state", new(json.RawMessage))
+	return responseObject.(*json.RawMessage), callSummary
 }
 
 // Return the state of a given workertype as stored by the provisioner.
@@ -425,9 +426,9 @@ func (awsProvisioner *AwsProvisioner) AwsState() *CallSummary {
 //   * aws-provisioner:view-worker-type:<workerType>
 //
 // See http://docs.taskcluster.net/aws-provisioner/api-docs/#state
-func (awsProvisioner *AwsProvisioner) State(workerType string) *CallSummary {
-	_, callSummary := awsProvisioner.apiCall(nil, "GET", "/state/"+url.QueryEscape(workerType), nil)
-	return callSummary
+func (awsProvisioner *AwsProvisioner) State(workerType string) (*WorkerTypeState, *CallSummary) {
+	responseObject, callSummary := awsProvisioner.apiCall(nil, "GET", "/state/"+url.QueryEscape(workerType), new(WorkerTypeState))
+	return responseObject.(*WorkerTypeState), callSummary
 }
 
 // Documented later...
@@ -435,9 +436,9 @@ func (awsProvisioner *AwsProvisioner) State(workerType string) *CallSummary {
 // **Warning** this api end-point is **not stable**.
 //
 // See http://docs.taskcluster.net/aws-provisioner/api-docs/#ping
-func (awsProvisioner *AwsProvisioner) Ping() *CallSummary {
-	_, callSummary := awsProvisioner.apiCall(nil, "GET", "/ping", nil)
-	return callSummary
+func (awsProvisioner *AwsProvisioner) Ping() (*json.RawMessage, *CallSummary) {
+	responseObject, callSummary := awsProvisioner.apiCall(nil, "GET", "/ping", new(json.RawMessage))
+	return responseObject.(*json.RawMessage), callSummary
 }
 
 // Get an API reference!
@@ -445,9 +446,9 @@ func (awsProvisioner *AwsProvisioner) Ping() *CallSummary {
 // **Warning** this api end-point is **not stable**.
 //
 // See http://docs.taskcluster.net/aws-provisioner/api-docs/#apiReference
-func (awsProvisioner *AwsProvisioner) ApiReference() *CallSummary {
-	_, callSummary := awsProvisioner.apiCall(nil, "GET", "/api-reference", nil)
-	return callSummary
+func (awsProvisioner *AwsProvisioner) ApiReference() (*json.RawMessage, *CallSummary) {
+	responseObject, callSummary := awsProvisioner.apiCall(nil, "GET", "/api-reference", new(json.RawMessage))
+	return responseObject.(*json.RawMessage), callSummary
 }
 
 type (
@@ -724,3 +725,12 @@ func (t *Time) UnmarshalJSON(data []byte) (err error) {
 func (t Time) String() string {
 	return time.Time(t).UTC().Format("2006-01-02T15:04:05.000Z")
 }
+
+// FromNow returns the Time which is the given relative time expression from
+// now, e.g. "2 days 3 hours", "in 1 day" or "-30 minutes". See package
+// github.com/taskcluster/taskcluster-client-go/relativetime for the supported
+// syntax.
+func FromNow(expr string) (Time, error) {
+	t, err := relativetime.FromNow(expr)
+	return Time(t), err
+}
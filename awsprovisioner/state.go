@@ -0,0 +1,51 @@
+package awsprovisioner
+
+// WorkerTypeState is the state of a worker type as stored by the
+// provisioner, as returned by State. The reference of the aws-provisioner
+// defines no schema for it, so it is declared here, and named as the output
+// of the state entry in the supplementary data of the code generator.
+type WorkerTypeState struct {
+	WorkerType string `json:"workerType"`
+	// All instances of the worker type
+	Instances []Instance `json:"instances"`
+	// Spot requests which show in the ec2 api
+	Requests []SpotRequest `json:"requests"`
+	// Spot requests which are only tracked internally by the provisioner,
+	// since they do not show in the ec2 api yet
+	InternalTrackedRequests []SpotRequest `json:"internalTrackedRequests"`
+}
+
+// Instance is an ec2 instance of a worker type.
+type Instance struct {
+	// Instance id, e.g. i-1a2b3c4d
+	Id string `json:"id"`
+	// Id of the spot request which the instance was launched for
+	SpotRequestId string `json:"srId"`
+	Ami           string `json:"ami"`
+	// Instance type, e.g. c3.xlarge
+	Type   string `json:"type"`
+	Region string `json:"region"`
+	// Availability zone, e.g. us-west-2a
+	Zone string `json:"zone"`
+	// Ec2 state of the instance, e.g. pending or running
+	State  string `json:"state"`
+	Launch Time   `json:"launch"`
+}
+
+// SpotRequest is an open spot request for an instance of a worker type.
+type SpotRequest struct {
+	// Spot request id, e.g. sir-1a2b3c4d
+	Id  string `json:"id"`
+	Ami string `json:"ami"`
+	// Instance type, e.g. c3.xlarge
+	Type   string `json:"type"`
+	Region string `json:"region"`
+	// Availability zone, e.g. us-west-2a
+	Zone string `json:"zone"`
+	// When the spot request was made
+	Time Time `json:"time"`
+	// Whether the spot request shows in the ec2 api yet
+	VisibleToEc2Api bool `json:"visibleToEC2Api"`
+	// Ec2 status code of the spot request, e.g. pending-evaluation
+	Status string `json:"status"`
+}
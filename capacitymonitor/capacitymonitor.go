@@ -0,0 +1,280 @@
+// Package capacitymonitor periodically samples the pending tasks of worker
+// types from the queue, and the capacity provisioned for them by the
+// aws-provisioner, and computes trends, to give early warning of backlogs,
+// e.g. when the number of pending tasks keeps growing while a worker type is
+// already at its maximum capacity.
+//
+// Each round of samples is passed to Monitor.OnSample, e.g. to alert
+// on-call, and the latest samples can be written in the Prometheus text
+// exposition format with Monitor.WritePrometheus, e.g. from a /metrics
+// handler.
+//
+// For example:
+//
+//	monitor := capacitymonitor.New(queue.New("", ""), awsprovisioner.New("myClientId", "myAccessToken"))
+//	monitor.PendingThreshold = 100
+//	monitor.OnSample = func(samples []*capacitymonitor.Sample) {
+//		for _, sample := range samples {
+//			for _, warning := range sample.Warnings {
+//				log.Printf("%v: %v", sample.Name(), warning)
+//			}
+//		}
+//	}
+//	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+//		monitor.WritePrometheus(w)
+//	})
+//	go monitor.Run(context.Background())
+package capacitymonitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/awsprovisioner"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	D "github.com/tj/go-debug"
+	"golang.org/x/net/context"
+)
+
+var (
+	// Used for logging based on DEBUG environment variable
+	// See github.com/tj/go-debug
+	debug = D.Debug("capacitymonitor")
+)
+
+// Sample is the state of a worker type at one point in time, with trends
+// over the preceding Monitor.Window.
+type Sample struct {
+	ProvisionerId string
+	WorkerType    string
+	Time          time.Time
+	// Number of pending tasks, which is an upper bound, according to the
+	// queue
+	PendingTasks int
+	// Change in the number of pending tasks per minute, over the window
+	PendingGrowth float64
+	// Whether the worker type is managed by the aws-provisioner. If not,
+	// the capacity fields are zero.
+	Managed bool
+	// Capacity bounds of the worker type definition
+	MinCapacity int
+	MaxCapacity int
+	// Capacity of running instances, and of pending instances and spot
+	// requests, weighted by the capacity of their instance types
+	RunningCapacity int
+	PendingCapacity int
+	// Proportion of MaxCapacity which is running or pending
+	CapacityRatio float64
+	// Warnings of possible backlogs
+	Warnings []string
+	// Set if the worker type could not be sampled, in which case the other
+	// fields, except the identifiers, are not valid
+	Err error
+}
+
+// Name returns the worker type of the sample, qualified by its provisioner,
+// e.g. aws-provisioner-v1/gaia.
+func (s *Sample) Name() string {
+	return s.ProvisionerId + "/" + s.WorkerType
+}
+
+// Monitor samples worker types periodically. Create one with New, and
+// adjust its parameters if required, before calling Run or Poll.
+type Monitor struct {
+	Queue       *queue.Queue
+	Provisioner *awsprovisioner.AwsProvisioner
+	// Provisioner id of the aws-provisioner
+	ProvisionerId string
+	// Worker types to monitor, as provisionerId/workerType, e.g.
+	// aws-provisioner-v1/gaia, or just the worker type for worker types of
+	// the aws-provisioner. If empty, all worker types listed by the
+	// aws-provisioner are monitored.
+	WorkerTypes []string
+	// Interval between rounds of samples
+	Interval time.Duration
+	// Period over which trends are computed
+	Window time.Duration
+	// If positive, a warning is given when there are more pending tasks
+	PendingThreshold int
+	// Called, if not nil, with the samples of each round
+	OnSample func(samples []*Sample)
+
+	mutex sync.Mutex
+	// pending tasks within the window, by worker type name
+	history map[string][]point
+	latest  []*Sample
+	// returns the current time, overridden in tests
+	now func() time.Time
+}
+
+// point is a number of pending tasks at a point in time
+type point struct {
+	time         time.Time
+	pendingTasks int
+}
+
+// New returns a Monitor which samples pending tasks from myQueue, and
+// capacity from myProvisioner, which has provisioner id aws-provisioner-v1,
+// every minute, computing trends over 15 minutes.
+func New(myQueue *queue.Queue, myProvisioner *awsprovisioner.AwsProvisioner) *Monitor {
+	return &Monitor{
+		Queue:         myQueue,
+		Provisioner:   myProvisioner,
+		ProvisionerId: "aws-provisioner-v1",
+		Interval:      time.Minute,
+		Window:        15 * time.Minute,
+		history:       map[string][]point{},
+		now:           time.Now,
+	}
+}
+
+// Run samples the worker types every m.Interval until ctx is done. Rounds
+// which fail, because the worker types of the aws-provisioner could not be
+// listed, are skipped.
+func (m *Monitor) Run(ctx context.Context) {
+	for {
+		if _, err := m.Poll(); err != nil {
+			debug("Skipping round: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.Interval):
+		}
+	}
+}
+
+// Poll samples the worker types once, passes the samples to m.OnSample,
+// and returns them. Failures to sample individual worker types are
+// reported in their Sample.Err; an error is only returned if the worker
+// types of the aws-provisioner could not be listed.
+func (m *Monitor) Poll() ([]*Sample, error) {
+	list, callSummary := m.Provisioner.ListWorkerTypes()
+	if callSummary.Error != nil {
+		return nil, fmt.Errorf("could not list worker types: %v", callSummary.Error)
+	}
+	managed := map[string]bool{}
+	for _, workerType := range *list {
+		managed[m.ProvisionerId+"/"+workerType] = true
+	}
+	names := m.WorkerTypes
+	if len(names) == 0 {
+		names = make([]string, 0, len(managed))
+		for name := range managed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	samples := make([]*Sample, len(names))
+	for i, name := range names {
+		if !strings.Contains(name, "/") {
+			name = m.ProvisionerId + "/" + name
+		}
+		samples[i] = m.sample(name, managed[name])
+	}
+	m.mutex.Lock()
+	m.latest = samples
+	m.mutex.Unlock()
+	if m.OnSample != nil {
+		m.OnSample(samples)
+	}
+	return samples, nil
+}
+
+// sample samples the worker type with the given name
+func (m *Monitor) sample(name string, managed bool) *Sample {
+	i := strings.LastIndex(name, "/")
+	s := &Sample{ProvisionerId: name[:i], WorkerType: name[i+1:], Time: m.now(), Managed: managed}
+	pending, callSummary := m.Queue.PendingTasks(s.ProvisionerId, s.WorkerType)
+	if callSummary.Error != nil {
+		s.Err = fmt.Errorf("could not get pending tasks: %v", callSummary.Error)
+		return s
+	}
+	s.PendingTasks = pending.PendingTasks
+	s.PendingGrowth = m.trend(name, s.Time, s.PendingTasks)
+	if managed {
+		if err := m.sampleCapacity(s); err != nil {
+			s.Err = err
+			return s
+		}
+	}
+
+	if m.PendingThreshold > 0 && s.PendingTasks > m.PendingThreshold {
+		s.Warnings = append(s.Warnings, fmt.Sprintf("%v pending tasks, more than %v", s.PendingTasks, m.PendingThreshold))
+	}
+	if managed && s.RunningCapacity+s.PendingCapacity >= s.MaxCapacity {
+		if s.PendingGrowth > 0 {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("pending tasks growing by %.1f per minute at maximum capacity %v", s.PendingGrowth, s.MaxCapacity))
+		} else if s.PendingTasks > 0 {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("%v pending tasks at maximum capacity %v", s.PendingTasks, s.MaxCapacity))
+		}
+	}
+	return s
+}
+
+// sampleCapacity sets the capacity fields of s from the worker type
+// definition and state of the aws-provisioner
+func (m *Monitor) sampleCapacity(s *Sample) error {
+	definition, callSummary := m.Provisioner.WorkerType(s.WorkerType)
+	if callSummary.Error != nil {
+		return fmt.Errorf("could not get worker type definition: %v", callSummary.Error)
+	}
+	s.MinCapacity = definition.MinCapacity
+	s.MaxCapacity = definition.MaxCapacity
+	capacities := map[string]int{}
+	for _, instanceType := range definition.InstanceTypes {
+		capacities[instanceType.InstanceType] = instanceType.Capacity
+	}
+
+	st, callSummary := m.Provisioner.State(s.WorkerType)
+	if callSummary.Error != nil {
+		return fmt.Errorf("could not get worker type state: %v", callSummary.Error)
+	}
+	for _, instance := range st.Instances {
+		switch instance.State {
+		case "running":
+			s.RunningCapacity += capacities[instance.Type]
+		case "pending":
+			s.PendingCapacity += capacities[instance.Type]
+		}
+	}
+	for _, request := range st.Requests {
+		s.PendingCapacity += capacities[request.Type]
+	}
+	for _, request := range st.InternalTrackedRequests {
+		s.PendingCapacity += capacities[request.Type]
+	}
+	if s.MaxCapacity > 0 {
+		s.CapacityRatio = float64(s.RunningCapacity+s.PendingCapacity) / float64(s.MaxCapacity)
+	}
+	return nil
+}
+
+// trend records the number of pending tasks of the named worker type at
+// time t, and returns its change per minute over the window
+func (m *Monitor) trend(name string, t time.Time, pendingTasks int) float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	points := append(m.history[name], point{t, pendingTasks})
+	for len(points) > 1 && t.Sub(points[0].time) > m.Window {
+		points = points[1:]
+	}
+	m.history[name] = points
+	first := points[0]
+	minutes := t.Sub(first.time).Minutes()
+	if minutes <= 0 {
+		return 0
+	}
+	return float64(pendingTasks-first.pendingTasks) / minutes
+}
+
+// Latest returns the samples of the latest round.
+func (m *Monitor) Latest() []*Sample {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.latest
+}
@@ -0,0 +1,207 @@
+package capacitymonitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/awsprovisioner"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+)
+
+// fakeServices serves the queue and aws-provisioner end points used by the
+// monitor, with pending tasks and worker type states set by the tests
+type fakeServices struct {
+	mutex sync.Mutex
+	// pending tasks by provisionerId/workerType
+	pending map[string]int
+	// worker type definitions and states by worker type
+	workerTypes map[string]string
+	states      map[string]string
+}
+
+func (f *fakeServices) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch path := r.URL.Path; {
+	case strings.HasPrefix(path, "/queue/pending/"):
+		name := strings.TrimPrefix(path, "/queue/pending/")
+		json.NewEncoder(w).Encode(map[string]interface{}{"pendingTasks": f.pending[name]})
+	case path == "/provisioner/list-worker-types":
+		list := []string{}
+		for workerType := range f.workerTypes {
+			list = append(list, workerType)
+		}
+		json.NewEncoder(w).Encode(list)
+	case strings.HasPrefix(path, "/provisioner/worker-type/"):
+		w.Write([]byte(f.workerTypes[strings.TrimPrefix(path, "/provisioner/worker-type/")]))
+	case strings.HasPrefix(path, "/provisioner/state/"):
+		w.Write([]byte(f.states[strings.TrimPrefix(path, "/provisioner/state/")]))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newTestMonitor returns a Monitor using fakeServices, with a clock which
+// is moved forward by the returned function
+func newTestMonitor() (*Monitor, *fakeServices, func(time.Duration), func()) {
+	f := &fakeServices{
+		pending: map[string]int{},
+		workerTypes: map[string]string{
+			"gaia": `{"workerType": "gaia", "minCapacity": 1, "maxCapacity": 6, "instanceTypes": [{"instanceType": "c3.xlarge", "capacity": 1}, {"instanceType": "c3.2xlarge", "capacity": 2}]}`,
+		},
+		states: map[string]string{
+			"gaia": `{"workerType": "gaia", "instances": [{"type": "c3.xlarge", "state": "running"}, {"type": "c3.2xlarge", "state": "running"}, {"type": "c3.xlarge", "state": "pending"}], "requests": [], "internalTrackedRequests": []}`,
+		},
+	}
+	server := httptest.NewServer(f)
+	myQueue := queue.New("", "")
+	myQueue.Authenticate = false
+	myQueue.BaseURL = server.URL + "/queue"
+	myProvisioner := awsprovisioner.New("", "")
+	myProvisioner.Authenticate = false
+	myProvisioner.BaseURL = server.URL + "/provisioner"
+	m := New(myQueue, myProvisioner)
+	clock := time.Date(2015, 11, 2, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return clock }
+	advance := func(d time.Duration) { clock = clock.Add(d) }
+	return m, f, advance, server.Close
+}
+
+func TestPoll(t *testing.T) {
+	m, f, advance, done := newTestMonitor()
+	defer done()
+	m.PendingThreshold = 100
+	m.WorkerTypes = []string{"gaia", "localprovisioner/test"}
+	rounds := 0
+	m.OnSample = func(samples []*Sample) { rounds++ }
+
+	for i, pending := range []int{10, 40, 70, 130} {
+		if i > 0 {
+			advance(5 * time.Minute)
+		}
+		f.pending["aws-provisioner-v1/gaia"] = pending
+		f.pending["localprovisioner/test"] = 3
+		if _, err := m.Poll(); err != nil {
+			t.Fatalf("Could not poll: %v", err)
+		}
+	}
+	if rounds != 4 {
+		t.Errorf("Expected OnSample to be called for each of 4 rounds, but got %v", rounds)
+	}
+	samples := m.Latest()
+	if len(samples) != 2 {
+		t.Fatalf("Expected 2 samples, but got %v", len(samples))
+	}
+	gaia, local := samples[0], samples[1]
+	if gaia.Name() != "aws-provisioner-v1/gaia" || local.Name() != "localprovisioner/test" {
+		t.Errorf("Unexpected samples %v and %v", gaia.Name(), local.Name())
+	}
+	if gaia.Err != nil {
+		t.Fatalf("Could not sample gaia: %v", gaia.Err)
+	}
+	// 130 - 10 pending tasks over 15 minutes
+	if gaia.PendingTasks != 130 || gaia.PendingGrowth != 8 {
+		t.Errorf("Expected 130 pending tasks, growing by 8 per minute, but got %v, growing by %v", gaia.PendingTasks, gaia.PendingGrowth)
+	}
+	if !gaia.Managed || gaia.MinCapacity != 1 || gaia.MaxCapacity != 6 || gaia.RunningCapacity != 3 || gaia.PendingCapacity != 1 {
+		t.Errorf("Unexpected capacity of gaia: %+v", gaia)
+	}
+	expected := []string{"130 pending tasks, more than 100"}
+	if strings.Join(gaia.Warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected warnings %q, but got %q", expected, gaia.Warnings)
+	}
+	if local.Managed || local.PendingTasks != 3 || local.PendingGrowth != 0 || len(local.Warnings) != 0 || local.Err != nil {
+		t.Errorf("Unexpected sample of unmanaged worker type: %+v", local)
+	}
+
+	// at maximum capacity, the growth of pending tasks is a warning, and
+	// points older than the window no longer count
+	f.states["gaia"] = strings.Replace(f.states["gaia"], `"requests": []`, `"requests": [{"type": "c3.2xlarge"}]`, 1)
+	advance(5 * time.Minute)
+	f.pending["aws-provisioner-v1/gaia"] = 145
+	samples, _ = m.Poll()
+	gaia = samples[0]
+	// 145 - 40 pending tasks over 15 minutes
+	if gaia.PendingGrowth != 7 || gaia.CapacityRatio != 1 {
+		t.Errorf("Expected growth of 7 per minute at full capacity, but got %v at %v", gaia.PendingGrowth, gaia.CapacityRatio)
+	}
+	expected = []string{"145 pending tasks, more than 100", "pending tasks growing by 7.0 per minute at maximum capacity 6"}
+	if strings.Join(gaia.Warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected warnings %q, but got %q", expected, gaia.Warnings)
+	}
+}
+
+func TestPollErrors(t *testing.T) {
+	m, f, _, done := newTestMonitor()
+	defer done()
+	f.states["gaia"] = "<html>Bad Gateway</html>"
+	samples, err := m.Poll()
+	if err != nil {
+		t.Fatalf("Could not poll: %v", err)
+	}
+	if len(samples) != 1 || samples[0].Err == nil || !strings.Contains(samples[0].Err.Error(), "could not get worker type state") {
+		t.Errorf("Expected state of gaia to be unreadable, but got %+v", samples[0])
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	m.Provisioner.BaseURL = closed.URL
+	if _, err := m.Poll(); err == nil {
+		t.Errorf("Expected poll to fail when worker types cannot be listed")
+	}
+	if len(m.Latest()) != 1 {
+		t.Errorf("Expected latest samples to be kept when a round fails")
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	m, f, _, done := newTestMonitor()
+	defer done()
+	m.WorkerTypes = []string{"gaia", `local"provisioner/test`}
+	f.pending["aws-provisioner-v1/gaia"] = 12
+	f.pending[`local"provisioner/test`] = 3
+	if _, err := m.Poll(); err != nil {
+		t.Fatalf("Could not poll: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := m.WritePrometheus(buf); err != nil {
+		t.Fatalf("Could not write metrics: %v", err)
+	}
+	expected := `# HELP taskcluster_pending_tasks Number of pending tasks of the worker type.
+# TYPE taskcluster_pending_tasks gauge
+taskcluster_pending_tasks{provisionerId="aws-provisioner-v1",workerType="gaia"} 12
+taskcluster_pending_tasks{provisionerId="local\"provisioner",workerType="test"} 3
+# HELP taskcluster_pending_tasks_growth_per_minute Change in the number of pending tasks per minute, over the monitor window.
+# TYPE taskcluster_pending_tasks_growth_per_minute gauge
+taskcluster_pending_tasks_growth_per_minute{provisionerId="aws-provisioner-v1",workerType="gaia"} 0
+taskcluster_pending_tasks_growth_per_minute{provisionerId="local\"provisioner",workerType="test"} 0
+# HELP taskcluster_worker_type_running_capacity Capacity of running instances of the worker type.
+# TYPE taskcluster_worker_type_running_capacity gauge
+taskcluster_worker_type_running_capacity{provisionerId="aws-provisioner-v1",workerType="gaia"} 3
+# HELP taskcluster_worker_type_pending_capacity Capacity of pending instances and spot requests of the worker type.
+# TYPE taskcluster_worker_type_pending_capacity gauge
+taskcluster_worker_type_pending_capacity{provisionerId="aws-provisioner-v1",workerType="gaia"} 1
+# HELP taskcluster_worker_type_min_capacity Minimum capacity of the worker type.
+# TYPE taskcluster_worker_type_min_capacity gauge
+taskcluster_worker_type_min_capacity{provisionerId="aws-provisioner-v1",workerType="gaia"} 1
+# HELP taskcluster_worker_type_max_capacity Maximum capacity of the worker type.
+# TYPE taskcluster_worker_type_max_capacity gauge
+taskcluster_worker_type_max_capacity{provisionerId="aws-provisioner-v1",workerType="gaia"} 6
+# HELP taskcluster_worker_type_capacity_ratio Proportion of the maximum capacity of the worker type which is running or pending.
+# TYPE taskcluster_worker_type_capacity_ratio gauge
+taskcluster_worker_type_capacity_ratio{provisionerId="aws-provisioner-v1",workerType="gaia"} 0.6666666666666666
+# HELP taskcluster_monitor_error Whether the worker type could not be sampled.
+# TYPE taskcluster_monitor_error gauge
+taskcluster_monitor_error{provisionerId="aws-provisioner-v1",workerType="gaia"} 0
+taskcluster_monitor_error{provisionerId="local\"provisioner",workerType="test"} 0
+`
+	if buf.String() != expected {
+		t.Errorf("Expected metrics\n%v\nbut got\n%v", expected, buf)
+	}
+}
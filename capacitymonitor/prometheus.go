@@ -0,0 +1,70 @@
+package capacitymonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// metric is a gauge written by WritePrometheus, with the value of a sample
+type metric struct {
+	name string
+	help string
+	// whether the metric only applies to worker types managed by the
+	// aws-provisioner
+	managed bool
+	value   func(s *Sample) float64
+}
+
+var metrics = []metric{
+	{"taskcluster_pending_tasks", "Number of pending tasks of the worker type.", false,
+		func(s *Sample) float64 { return float64(s.PendingTasks) }},
+	{"taskcluster_pending_tasks_growth_per_minute", "Change in the number of pending tasks per minute, over the monitor window.", false,
+		func(s *Sample) float64 { return s.PendingGrowth }},
+	{"taskcluster_worker_type_running_capacity", "Capacity of running instances of the worker type.", true,
+		func(s *Sample) float64 { return float64(s.RunningCapacity) }},
+	{"taskcluster_worker_type_pending_capacity", "Capacity of pending instances and spot requests of the worker type.", true,
+		func(s *Sample) float64 { return float64(s.PendingCapacity) }},
+	{"taskcluster_worker_type_min_capacity", "Minimum capacity of the worker type.", true,
+		func(s *Sample) float64 { return float64(s.MinCapacity) }},
+	{"taskcluster_worker_type_max_capacity", "Maximum capacity of the worker type.", true,
+		func(s *Sample) float64 { return float64(s.MaxCapacity) }},
+	{"taskcluster_worker_type_capacity_ratio", "Proportion of the maximum capacity of the worker type which is running or pending.", true,
+		func(s *Sample) float64 { return s.CapacityRatio }},
+}
+
+// WritePrometheus writes the latest samples to w as gauges, in the
+// Prometheus text exposition format, labelled by provisionerId and
+// workerType. Samples which failed are only reported by the
+// taskcluster_monitor_error gauge.
+func (m *Monitor) WritePrometheus(w io.Writer) error {
+	samples := m.Latest()
+	out := bufio.NewWriter(w)
+	for _, metric := range metrics {
+		fmt.Fprintf(out, "# HELP %v %v\n# TYPE %v gauge\n", metric.name, metric.help, metric.name)
+		for _, s := range samples {
+			if s.Err != nil || metric.managed && !s.Managed {
+				continue
+			}
+			fmt.Fprintf(out, "%v%v %v\n", metric.name, labels(s), strconv.FormatFloat(metric.value(s), 'g', -1, 64))
+		}
+	}
+	fmt.Fprintf(out, "# HELP taskcluster_monitor_error Whether the worker type could not be sampled.\n# TYPE taskcluster_monitor_error gauge\n")
+	for _, s := range samples {
+		value := 0
+		if s.Err != nil {
+			value = 1
+		}
+		fmt.Fprintf(out, "taskcluster_monitor_error%v %v\n", labels(s), value)
+	}
+	return out.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels returns the labels identifying the worker type of s
+func labels(s *Sample) string {
+	return fmt.Sprintf(`{provisionerId="%v",workerType="%v"}`, labelEscaper.Replace(s.ProvisionerId), labelEscaper.Replace(s.WorkerType))
+}
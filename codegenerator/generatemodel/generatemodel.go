@@ -17,12 +17,13 @@ var (
 	usage   = `
 generatemodel
 generatemodel takes input from a json file describing a set of taskcluster APIs, and generates
-go source files for inclusion in the (Go) TaskCluster Client API library. It is referenced by
+go source files for inclusion in the (Go) TaskCluster Client API library, together with the
+command table of the tc command line tool. It is referenced by
 go generate commands in the model package. See go generate --help and ../build.sh to see how
 this is used by the build process for this taskcluster-client-go go project.
 
   Usage:
-      generatemodel -u API-MANIFEST -f SUPPLEMENTARY-DATA -o GO-OUTPUT-DIR -m MODEL-DATA-FILE
+      generatemodel -u API-MANIFEST -f SUPPLEMENTARY-DATA -o GO-OUTPUT-DIR -m MODEL-DATA-FILE [-p WORKER-PAYLOAD]...
       generatemodel --help
 
   Options:
@@ -42,6 +43,12 @@ this is used by the build process for this taskcluster-client-go go project.
                             parsed, and their dependencies have also been
                             processed, an overview of all the processed data
                             will be written to this file.
+    -p WORKER-PAYLOAD       Optionally also generate a go package of types for
+                            the task payload of a worker, given as
+                            <package>=<schema url>, e.g.
+                            dockerworker=http://schemas.taskcluster.net/docker-worker/v1/payload.json#
+                            May be specified multiple times. Register the
+                            generated types with queue.RegisterPayload.
 `
 )
 
@@ -51,4 +58,8 @@ func main() {
 	utils.ExitOnFail(err)
 	model.LoadAPIs(arguments["-u"].(string), arguments["-f"].(string))
 	model.GenerateCode(arguments["-o"].(string), arguments["-m"].(string))
+	model.GenerateCLI(arguments["-o"].(string))
+	if payloads, ok := arguments["-p"].([]string); ok && len(payloads) > 0 {
+		model.GenerateWorkerPayloads(arguments["-o"].(string), payloads)
+	}
 }
@@ -2,6 +2,8 @@ package model
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/taskcluster/taskcluster-client-go/codegenerator/utils"
@@ -49,6 +51,20 @@ func (api *API) postPopulate(apiDef *APIDefinition) {
 		api.Entries[i].MethodName = utils.Normalise(api.Entries[i].Name, methods)
 		api.Entries[i].postPopulate(apiDef)
 	}
+
+	// supplementary outputs must refer to existing entries
+	entries := make(map[string]bool, len(api.Entries))
+	for _, entry := range api.Entries {
+		entries[entry.Name] = true
+	}
+	for name := range apiDef.Outputs {
+		if !entries[name] {
+			fmt.Printf(
+				"\nFATAL: Supplementary data for '%v' defines an output for entry '%v', but the api has no such entry, therefore exiting...\n\n",
+				apiDef.URL, name)
+			os.Exit(66)
+		}
+	}
 }
 
 func (api *API) generateAPICode(apiName string) string {
@@ -63,7 +79,7 @@ func (api *API) generateAPICode(apiName string) string {
 	exampleCall := ""
 	// here we choose an example API method to call, just the first one in the list of api.Entries
 	// We need to first see if it returns one or two variables...
-	if api.Entries[0].Output == "" {
+	if api.Entries[0].outputType() == "" {
 		exampleCall = "//  callSummary := " + exampleVarName + "." + api.Entries[0].MethodName + "(.....)"
 	} else {
 		exampleCall = "//  data, callSummary := " + exampleVarName + "." + api.Entries[0].MethodName + "(.....)"
@@ -113,6 +129,7 @@ import (
 	"reflect"
 	"time"
 	"github.com/taskcluster/httpbackoff"
+	"golang.org/x/net/context"
 	hawk "github.com/tent/hawk-go"
 	D "github.com/tj/go-debug"
 %%{imports}
@@ -274,8 +291,29 @@ type CallSummary struct {
 	content += "\t}\n"
 	content += "}\n"
 	content += "\n"
+	paginated := false
 	for _, entry := range api.Entries {
 		content += entry.generateAPICode(apiName)
+		if p := entry.pagination(); p != nil {
+			content += entry.generateIteratorCode(p)
+			paginated = true
+		}
+	}
+	if paginated {
+		content += `
+// PageError is the error returned by the Err method of an iterator when a
+// page of results could not be fetched.
+type PageError struct {
+	// Number of the page which could not be fetched, starting at 1
+	Page        int
+	CallSummary *CallSummary
+}
+
+func (err *PageError) Error() string {
+	return fmt.Sprintf("could not fetch page %v of results: %v", err.Page, err.CallSummary.Error)
+}
+
+`
 	}
 	return content
 }
@@ -297,10 +335,26 @@ type APIEntry struct {
 	Description string     `json:"description"`
 
 	MethodName string
-	Parent     *API
+	// Go type of the output of an entry without an output schema, from the
+	// supplementary data
+	OutputGoType string
+	Parent       *API
 }
 
 func (entry *APIEntry) postPopulate(apiDef *APIDefinition) {
+	if output, ok := apiDef.Outputs[entry.Name]; ok {
+		if entry.Output != "" {
+			fmt.Printf(
+				"\nFATAL: Supplementary data for '%v' defines an output for entry '%v', but the api already defines output schema '%v', therefore exiting...\n\n",
+				apiDef.URL, entry.Name, entry.Output)
+			os.Exit(67)
+		}
+		if strings.HasPrefix(output, "http://") || strings.HasPrefix(output, "https://") {
+			entry.Output = output
+		} else {
+			entry.OutputGoType = output
+		}
+	}
 	if entry.Input != "" {
 		entry.Parent.apiDef.cacheJsonSchema(&entry.Input)
 		entry.Parent.apiDef.schemas[entry.Input].IsInputSchema = true
@@ -375,16 +429,17 @@ func (entry *APIEntry) generateAPICode(apiName string) string {
 		}
 	}
 
+	outputType := entry.outputType()
 	responseType := "*CallSummary"
-	if entry.Output != "" {
-		responseType = "(*" + entry.Parent.apiDef.schemas[entry.Output].TypeName + ", *CallSummary)"
+	if outputType != "" {
+		responseType = "(*" + outputType + ", *CallSummary)"
 	}
 
 	content := comment
 	content += "func (" + entry.Parent.apiDef.ExampleVarName + " *" + entry.Parent.apiDef.Name + ") " + entry.MethodName + "(" + inputParams + ") " + responseType + " {\n"
-	if entry.Output != "" {
-		content += "\tresponseObject, callSummary := " + entry.Parent.apiDef.ExampleVarName + ".apiCall(" + apiArgsPayload + ", \"" + strings.ToUpper(entry.Method) + "\", \"" + strings.Replace(strings.Replace(entry.Route, "<", "\" + url.QueryEscape(", -1), ">", ") + \"", -1) + "\", new(" + entry.Parent.apiDef.schemas[entry.Output].TypeName + "))\n"
-		content += "\treturn responseObject.(*" + entry.Parent.apiDef.schemas[entry.Output].TypeName + "), callSummary\n"
+	if outputType != "" {
+		content += "\tresponseObject, callSummary := " + entry.Parent.apiDef.ExampleVarName + ".apiCall(" + apiArgsPayload + ", \"" + strings.ToUpper(entry.Method) + "\", \"" + strings.Replace(strings.Replace(entry.Route, "<", "\" + url.QueryEscape(", -1), ">", ") + \"", -1) + "\", new(" + outputType + "))\n"
+		content += "\treturn responseObject.(*" + outputType + "), callSummary\n"
 	} else {
 		content += "\t_, callSummary := " + entry.Parent.apiDef.ExampleVarName + ".apiCall(" + apiArgsPayload + ", \"" + strings.ToUpper(entry.Method) + "\", \"" + strings.Replace(strings.Replace(entry.Route, "<", "\" + url.QueryEscape(", -1), ">", ") + \"", -1) + "\", nil)\n"
 		content += "\treturn callSummary\n"
@@ -394,3 +449,206 @@ func (entry *APIEntry) generateAPICode(apiName string) string {
 	// can remove any code that added an empty string to another string
 	return strings.Replace(content, ` + ""`, "", -1)
 }
+
+// outputType returns the go type of the entry's response, which is
+// generated from its output schema, or given by the supplementary data, or
+// "" if the entry has no output.
+func (entry *APIEntry) outputType() string {
+	if entry.Output != "" {
+		return entry.Parent.apiDef.schemas[entry.Output].TypeName
+	}
+	return entry.OutputGoType
+}
+
+// pagination describes how to page through the results of an API entry
+// whose request and response both have a continuationToken property.
+type pagination struct {
+	// go member names of the request type
+	RequestToken, RequestLimit string
+	// go member names of the response type
+	ResponseToken, Items string
+	// page size to request if none is given, from the request schema
+	DefaultLimit int
+}
+
+// pagination returns nil, unless the entry's input and output schemas both
+// have a continuationToken property, and the output schema has exactly one
+// array property, listing the results.
+func (entry *APIEntry) pagination() *pagination {
+	if entry.Input == "" || entry.Output == "" {
+		return nil
+	}
+	input := entry.Parent.apiDef.schemas[entry.Input]
+	output := entry.Parent.apiDef.schemas[entry.Output]
+	if input.Properties == nil || output.Properties == nil {
+		return nil
+	}
+	inputMembers := input.memberNames()
+	outputMembers := output.memberNames()
+	p := &pagination{
+		RequestToken:  inputMembers["continuationToken"],
+		ResponseToken: outputMembers["continuationToken"],
+	}
+	if p.RequestToken == "" || p.ResponseToken == "" {
+		return nil
+	}
+	for _, j := range output.Properties.SortedPropertyNames {
+		if t := output.Properties.Properties[j].Type; t != nil && *t == "array" {
+			if p.Items != "" {
+				return nil
+			}
+			p.Items = outputMembers[j]
+		}
+	}
+	if p.Items == "" {
+		return nil
+	}
+	if limit := input.Properties.Properties["limit"]; limit != nil && limit.Type != nil && *limit.Type == "integer" {
+		p.RequestLimit = inputMembers["limit"]
+		if d := limit.Default; d != nil {
+			if f, ok := (*d).(float64); ok {
+				p.DefaultLimit = int(f)
+			}
+		} else if m := limit.Maximum; m != nil {
+			p.DefaultLimit = *m
+		}
+	}
+	return p
+}
+
+// generateIteratorCode generates an iterator type for a paginated entry,
+// together with the method to create it.
+func (entry *APIEntry) generateIteratorCode(p *pagination) string {
+	apiDef := entry.Parent.apiDef
+	argFields, argInits, params, callArgs, exampleArgs := "", "", "", "", ""
+	for _, arg := range entry.Args {
+		argFields += "\t" + arg + " string\n"
+		argInits += "\t\t" + arg + ": " + arg + ",\n"
+		params += arg + " string, "
+		callArgs += "iterator." + arg + ", "
+		exampleArgs += arg + ", "
+	}
+	limitCode := ""
+	if p.RequestLimit != "" {
+		if p.DefaultLimit > 0 {
+			limitCode += `
+	if iterator.payload.%%{RequestLimit} == 0 {
+		iterator.payload.%%{RequestLimit} = ` + strconv.Itoa(p.DefaultLimit) + `
+	}`
+		}
+		limitCode += `
+	if remaining := iterator.limit - iterator.count; iterator.limit > 0 && (iterator.payload.%%{RequestLimit} == 0 || iterator.payload.%%{RequestLimit} > remaining) {
+		iterator.payload.%%{RequestLimit} = remaining
+	}`
+	}
+	content := `// %%{Method}Iterator pages through the results of %%{Method},
+// following continuation tokens transparently. See
+// %%{Name}.%%{Method}Iterator.
+type %%{Method}Iterator struct {
+	%%{ExampleVarName} *%%{Name}
+	ctx context.Context
+%%{argFields}	payload %%{Request}
+	limit int
+	count int
+	pages int
+	page *%%{Response}
+	callSummary *CallSummary
+	err error
+	done bool
+}
+
+// %%{Method}Iterator returns an iterator over the pages of results of
+// %%{Method}, for example:
+//
+//  iterator := %%{ExampleVarName}.%%{Method}Iterator(context.Background(), %%{exampleArgs}nil, 0)
+//  for iterator.Next() {
+//  	for _, item := range iterator.Page().%%{Items} {
+//  		// ...
+//  	}
+//  }
+//  if err := iterator.Err(); err != nil {
+//  	// handle error...
+//  }
+//
+// The payload may be nil, or give e.g. the page size or a continuation token
+// to start from. Iteration ends when there are no more results, when limit
+// results have been returned (if limit > 0), when a page cannot be fetched,
+// or when ctx is done, which is checked before fetching each page.
+func (%%{ExampleVarName} *%%{Name}) %%{Method}Iterator(ctx context.Context, %%{params}payload *%%{Request}, limit int) *%%{Method}Iterator {
+	iterator := &%%{Method}Iterator{
+		%%{ExampleVarName}: %%{ExampleVarName},
+		ctx: ctx,
+%%{argInits}		limit: limit,
+	}
+	if payload != nil {
+		iterator.payload = *payload
+	}
+	return iterator
+}
+
+// Next fetches the next page of results, which is then available from Page.
+// It returns false when iteration has ended; check Err to see why.
+func (iterator *%%{Method}Iterator) Next() bool {
+	if iterator.done {
+		return false
+	}
+	select {
+	case <-iterator.ctx.Done():
+		iterator.err = iterator.ctx.Err()
+		iterator.done = true
+		return false
+	default:
+	}` + limitCode + `
+	iterator.pages++
+	iterator.page, iterator.callSummary = iterator.%%{ExampleVarName}.%%{Method}(%%{callArgs}&iterator.payload)
+	if iterator.callSummary.Error != nil {
+		iterator.err = &PageError{Page: iterator.pages, CallSummary: iterator.callSummary}
+		iterator.done = true
+		return false
+	}
+	if iterator.limit > 0 && iterator.count+len(iterator.page.%%{Items}) >= iterator.limit {
+		iterator.page.%%{Items} = iterator.page.%%{Items}[:iterator.limit-iterator.count]
+		iterator.done = true
+	}
+	iterator.count += len(iterator.page.%%{Items})
+	iterator.payload.%%{RequestToken} = iterator.page.%%{ResponseToken}
+	if iterator.page.%%{ResponseToken} == "" {
+		iterator.done = true
+	}
+	return true
+}
+
+// Page returns the page of results fetched by the last call to Next.
+func (iterator *%%{Method}Iterator) Page() *%%{Response} {
+	return iterator.page
+}
+
+// CallSummary returns the CallSummary of the last page request.
+func (iterator *%%{Method}Iterator) CallSummary() *CallSummary {
+	return iterator.callSummary
+}
+
+// Err returns the error which ended iteration, if any. This is a *PageError
+// if a page could not be fetched, or the error of ctx if it was done.
+func (iterator *%%{Method}Iterator) Err() error {
+	return iterator.err
+}
+
+`
+	return strings.NewReplacer(
+		"%%{Method}", entry.MethodName,
+		"%%{Name}", apiDef.Name,
+		"%%{ExampleVarName}", apiDef.ExampleVarName,
+		"%%{Request}", apiDef.schemas[entry.Input].TypeName,
+		"%%{Response}", apiDef.schemas[entry.Output].TypeName,
+		"%%{Items}", p.Items,
+		"%%{RequestToken}", p.RequestToken,
+		"%%{RequestLimit}", p.RequestLimit,
+		"%%{ResponseToken}", p.ResponseToken,
+		"%%{argFields}", argFields,
+		"%%{argInits}", argInits,
+		"%%{params}", params,
+		"%%{callArgs}", callArgs,
+		"%%{exampleArgs}", exampleArgs,
+	).Replace(content)
+}
@@ -0,0 +1,199 @@
+package model
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/taskcluster/taskcluster-client-go/codegenerator/utils"
+)
+
+// GenerateCLI writes the tables of the tc command line tool: the services
+// and commands, with one command per entry of each REST API loaded by
+// LoadAPIs, to tc/services.go, and the exchanges that tc listen can
+// subscribe to, with one per entry of each AMQP API, to tc/exchanges.go,
+// under goOutputDir. It must be called after GenerateCode, which assigns
+// package names to the APIs.
+func GenerateCLI(goOutputDir string) {
+	content := `
+// The following code is AUTO-GENERATED. Please DO NOT edit.
+// To update this generated code, run the following command:
+// in the /codegenerator/model subdirectory of this project,
+// making sure that ` + "`${GOPATH}/bin` is in your `PATH`" + `:
+//
+// go install && go generate
+//
+// This file lists a tc command for each entry of the REST APIs of the
+// packages generated alongside it.
+
+package main
+
+import (
+%%{imports}
+)
+
+var services = []*service{
+`
+	extraPackages := make(map[string]bool)
+	constructors := ""
+	for i := range apiDefs {
+		api, ok := apiDefs[i].Data.(*API)
+		if !ok {
+			continue
+		}
+		extraPackages["github.com/taskcluster/taskcluster-client-go/"+apiDefs[i].PackageName] = true
+		content += api.generateCLICode()
+		constructors += api.generateCLIConstructor()
+	}
+	content += "}\n" + constructors
+	writeGoSource(content, extraPackages, filepath.Join(goOutputDir, "tc", "services.go"))
+
+	content = `
+// The following code is AUTO-GENERATED. Please DO NOT edit.
+// To update this generated code, run the following command:
+// in the /codegenerator/model subdirectory of this project,
+// making sure that ` + "`${GOPATH}/bin` is in your `PATH`" + `:
+//
+// go install && go generate
+//
+// This file lists the exchanges of the events packages generated alongside
+// it, for tc listen.
+
+package main
+
+import (
+	"github.com/taskcluster/pulse-go/pulse"
+%%{imports}
+)
+
+var exchanges = []*exchange{
+`
+	extraPackages = make(map[string]bool)
+	for i := range apiDefs {
+		exchange, ok := apiDefs[i].Data.(*Exchange)
+		if !ok {
+			continue
+		}
+		extraPackages["github.com/taskcluster/taskcluster-client-go/"+apiDefs[i].PackageName] = true
+		content += exchange.generateCLICode()
+	}
+	content += "}\n"
+	writeGoSource(content, extraPackages, filepath.Join(goOutputDir, "tc", "exchanges.go"))
+}
+
+// generateCLICode generates the service of the api, with a command per entry.
+func (api *API) generateCLICode() string {
+	content := "\t{\n"
+	content += "\t\tName: " + strconv.Quote(api.apiDef.PackageName) + ",\n"
+	content += "\t\tTitle: " + strconv.Quote(api.Title) + ",\n"
+	content += "\t\tCommands: []*command{\n"
+	for _, entry := range api.Entries {
+		content += utils.Indent(entry.generateCLICode(), "\t\t\t")
+	}
+	content += "\t\t},\n"
+	content += "\t},\n"
+	return content
+}
+
+// generateCLIConstructor generates the function which creates the client
+// object of the api, used by its commands, for a given config.
+func (api *API) generateCLIConstructor() string {
+	v := api.apiDef.ExampleVarName
+	return `
+func new` + api.apiDef.Name + `(config *config) *` + api.apiDef.PackageName + `.` + api.apiDef.Name + ` {
+	` + v + ` := ` + api.apiDef.PackageName + `.New(config.ClientId, config.AccessToken)
+	` + v + `.Certificate = config.Certificate
+	` + v + `.Authenticate = config.ClientId != ""
+	if config.BaseURL != "" {
+		` + v + `.BaseURL = config.BaseURL
+	}
+	return ` + v + `
+}
+`
+}
+
+// generateCLICode generates the tc listen exchange of each entry of the
+// exchange api, named after the corresponding REST API, e.g.
+// queue/task-defined for exchange task-defined of package queueevents.
+func (exchange *Exchange) generateCLICode() string {
+	service := strings.TrimSuffix(exchange.apiDef.PackageName, "events")
+	content := ""
+	entryTypeNames := make(map[string]bool, len(exchange.Entries))
+	for _, entry := range exchange.Entries {
+		typeName := exchange.apiDef.PackageName + "." + utils.Normalise(entry.Name, entryTypeNames)
+		content += "\t{\n"
+		content += "\t\tName: " + strconv.Quote(service+"/"+entry.Exchange) + ",\n"
+		content += "\t\tTitle: " + strconv.Quote(entry.Title) + ",\n"
+		content += "\t\tBinding: func() pulse.Binding { return new(" + typeName + ") },\n"
+		content += "\t\tFields: []field{\n"
+		keyNames := make(map[string]bool, len(entry.RoutingKey))
+		for _, rk := range entry.RoutingKey {
+			// generated field names must match those of the binding type
+			fieldName := utils.Normalise(rk.Name, keyNames)
+			if rk.Constant != "" {
+				continue
+			}
+			content += "\t\t\t{" + strconv.Quote(commandName(rk.Name)) + ", " + strconv.Quote(fieldName) + "},\n"
+		}
+		content += "\t\t},\n"
+		content += "\t},\n"
+	}
+	return content
+}
+
+// generateCLICode generates the command which calls the entry.
+func (entry *APIEntry) generateCLICode() string {
+	apiDef := entry.Parent.apiDef
+	callArgs := make([]string, len(entry.Args))
+	for i := range entry.Args {
+		callArgs[i] = "args[" + strconv.Itoa(i) + "]"
+	}
+	content := "{\n"
+	content += "\tName: " + strconv.Quote(commandName(entry.Name)) + ",\n"
+	content += "\tTitle: " + strconv.Quote(entry.Title) + ",\n"
+	content += "\tDescription: " + strconv.Quote(entry.Description) + ",\n"
+	content += "\tArgs: []string{"
+	for i, arg := range entry.Args {
+		if i > 0 {
+			content += ", "
+		}
+		content += strconv.Quote(arg)
+	}
+	content += "},\n"
+	if entry.Input != "" {
+		inputType := apiDef.PackageName + "." + apiDef.schemas[entry.Input].TypeName
+		content += "\tInput: func() interface{} { return new(" + inputType + ") },\n"
+		callArgs = append(callArgs, "payload.(*"+inputType+")")
+	}
+	content += "\tRun: func(config *config, args []string, payload interface{}) *call {\n"
+	if entry.outputType() != "" {
+		content += "\t\t_, callSummary := "
+	} else {
+		content += "\t\tcallSummary := "
+	}
+	content += "new" + apiDef.Name + "(config)." + entry.MethodName + "(" + strings.Join(callArgs, ", ") + ")\n"
+	content += "\t\treturn &call{callSummary.HttpResponse, callSummary.HttpResponseBody, callSummary.Error}\n"
+	content += "\t},\n"
+	content += "},\n"
+	return content
+}
+
+// commandName converts a camel case name from an API reference to the dash
+// separated lower case name used by tc, e.g. API entry findTask to command
+// find-task, azureTableSAS to azure-table-sas, and routing key element
+// workerType to option --worker-type.
+func commandName(entryName string) string {
+	runes := []rune(entryName)
+	name := ""
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			if !unicode.IsUpper(previous) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				name += "-"
+			}
+		}
+		name += string(unicode.ToLower(r))
+	}
+	return name
+}
@@ -1,7 +1,10 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/taskcluster/taskcluster-client-go/codegenerator/utils"
 )
@@ -133,24 +136,48 @@ func (exchange *Exchange) generateAPICode(exchangeName string) string {
 	comment += "// \n"
 	comment += "// In addition, this means that you will also get objects in your callback method like *queueevents.TaskDefinedMessage\n"
 	comment += "// rather than just interface{}.\n"
+	comment += "//\n"
+	comment += "// Since the RoutingKey method of a binding cannot report errors, it panics if a field value is not a\n"
+	comment += "// valid routing key word, e.g. \"a.b\", rather than return the wrong routing key pattern. Check bindings\n"
+	comment += "// with ValidateBindings before subscribing with them, to get an error instead:\n"
+	comment += "//\n"
+	comment += "//  binding := queueevents.TaskDefined{WorkerType: workerType}\n"
+	comment += "//  if err := queueevents.ValidateBindings(binding); err != nil {\n"
+	comment += "//  \t// handle error...\n"
+	comment += "//  }\n"
 	content := comment
 	content += "package " + exchange.apiDef.PackageName + "\n"
 	content += `
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/taskcluster-client-go/schemacheck"
 %%{imports}
 )
 
 `
 	entryTypeNames := make(map[string]bool, len(exchange.Entries))
-	for _, entry := range exchange.Entries {
-		content += entry.generateAPICode(utils.Normalise(entry.Name, entryTypeNames))
+	typeNames := make([]string, len(exchange.Entries))
+	for i, entry := range exchange.Entries {
+		typeNames[i] = utils.Normalise(entry.Name, entryTypeNames)
+		content += entry.generateAPICode(typeNames[i])
 	}
 
 	content += `
+// generateRoutingKey returns the routing key pattern of binding x. It panics
+// if validateRoutingKey returns an error, so that a binding with an invalid
+// field value is never bound with the wrong pattern.
 func generateRoutingKey(x interface{}) string {
+	if err := validateRoutingKey(x); err != nil {
+		panic(err)
+	}
 	val := reflect.ValueOf(x).Elem()
 	p := make([]string, 0, val.NumField())
 	for i := 0; i < val.NumField(); i++ {
@@ -159,7 +186,11 @@ func generateRoutingKey(x interface{}) string {
 		tag := typeField.Tag
 		if t := tag.Get("mwords"); t != "" {
 			if v := valueField.Interface(); v == "" {
-				p = append(p, t)
+				if c := tag.Get("constant"); c != "" {
+					p = append(p, c)
+				} else {
+					p = append(p, t)
+				}
 			} else {
 				p = append(p, v.(string))
 			}
@@ -167,6 +198,360 @@ func generateRoutingKey(x interface{}) string {
 	}
 	return strings.Join(p, ".")
 }
+`
+	content += exchange.generateValidationCode(typeNames)
+	content += exchange.generateParseCode(typeNames)
+	content += exchange.generateHandlersCode(typeNames)
+	content += exchange.generatePublishCode()
+	return content
+}
+
+// generateValidationCode generates the validation of binding field values,
+// and the CCRoute binding, where typeNames are the binding type names of the
+// entries.
+func (exchange *Exchange) generateValidationCode(typeNames []string) string {
+	example := exchange.apiDef.PackageName + "." + typeNames[0] + "{}"
+	return `
+// validateRoutingKey returns an error if a field of binding x has a value
+// which would not result in the intended routing key pattern: a single-word
+// field containing a '.', a '*' or '#' which is not a whole word (or a '#'
+// in a single-word field), a constant field with a value other than its
+// constant, or a required field with value '_', which is only used for
+// values that are not present.
+func validateRoutingKey(x interface{}) error {
+	val := reflect.ValueOf(x).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		mwords := field.Tag.Get("mwords")
+		value := val.Field(i).String()
+		if mwords == "" || value == "" {
+			continue
+		}
+		if mwords == "*" && strings.Contains(value, ".") {
+			return fmt.Errorf("%v.%v %q may not contain a '.', since it is a single word of the routing key", val.Type(), field.Name, value)
+		}
+		if c := field.Tag.Get("constant"); c != "" && value != c {
+			return fmt.Errorf("%v.%v is always %q, but is %q", val.Type(), field.Name, c, value)
+		}
+		if field.Tag.Get("required") == "true" && value == "_" {
+			return fmt.Errorf("%v.%v is required, so is never %q", val.Type(), field.Name, value)
+		}
+		for _, word := range strings.Split(value, ".") {
+			if word == "" || word != "*" && word != "#" && strings.ContainsAny(word, "*#") || word == "#" && mwords == "*" {
+				return fmt.Errorf("%v.%v %q has invalid word %q", val.Type(), field.Name, value, word)
+			}
+		}
+	}
+	return nil
+}
+
+// CCRoute is a binding for messages from the exchange of Binding which are
+// CC'ed to the task specific route ` + "`route.<Route>`" + `, i.e. messages about
+// tasks with Route in their TaskDefinition.Routes. Route may contain the
+// wildcards * and #, and the routing key fields of Binding are ignored, e.g.
+//
+//  ` + exchange.apiDef.PackageName + `.CCRoute{Binding: ` + example + `, Route: "notify.by-email"}
+type CCRoute struct {
+	Binding interface {
+		ExchangeName() string
+		NewPayloadObject() interface{}
+	}
+	Route string
+}
+
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Route is not a valid route pattern.
+func (binding CCRoute) RoutingKey() string {
+	if err := validateRoute(binding.Route); err != nil {
+		panic(err)
+	}
+	return "route." + binding.Route
+}
+
+func (binding CCRoute) ExchangeName() string {
+	return binding.Binding.ExchangeName()
+}
+
+func (binding CCRoute) NewPayloadObject() interface{} {
+	return binding.Binding.NewPayloadObject()
+}
+
+// Validate returns an error if Binding is not set, or Route is not a valid
+// route pattern.
+func (binding CCRoute) Validate() error {
+	if binding.Binding == nil {
+		return errors.New("CCRoute has no Binding")
+	}
+	return validateRoute(binding.Route)
+}
+
+// validateRoute returns an error if route is not a valid route pattern.
+func validateRoute(route string) error {
+	for _, word := range strings.Split(route, ".") {
+		if word == "" || word != "*" && word != "#" && strings.ContainsAny(word, "*#") {
+			return fmt.Errorf("CCRoute has invalid route %q", route)
+		}
+	}
+	return nil
+}
+
+// ValidateBindings returns the first error returned by the Validate method
+// of the given bindings, if any. Since the RoutingKey method of a binding
+// panics if it is not valid, call ValidateBindings before passing bindings
+// to pulse.Connection.Consume. Bindings without a Validate method are
+// skipped.
+func ValidateBindings(bindings ...interface{}) error {
+	for _, binding := range bindings {
+		if v, ok := binding.(interface {
+			Validate() error
+		}); ok {
+			if err := v.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+`
+}
+
+// generateParseCode generates the function for parsing a delivered routing
+// key of the entry into a binding of type exchangeEntry.
+func (entry *ExchangeEntry) generateParseCode(exchangeEntry string) string {
+	return `// Parse` + exchangeEntry + ` returns the ` + exchangeEntry + ` binding with its fields set from
+// the primary routing key of a message from its exchange, such as
+// delivery.RoutingKey, so that they can be read without decoding the message
+// body.
+func Parse` + exchangeEntry + `(routingKey string) (*` + exchangeEntry + `, error) {
+	binding := new(` + exchangeEntry + `)
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+`
+}
+
+// generateParseCode generates the functions for parsing delivered routing
+// keys back into bindings, where typeNames are the binding type names of the
+// entries.
+func (exchange *Exchange) generateParseCode(typeNames []string) string {
+	content := `
+// parseRoutingKey sets the fields of binding x from the words of routingKey,
+// i.e. it is the inverse of generateRoutingKey. A multi-word field gets all
+// words not taken by the other fields, which may be none.
+func parseRoutingKey(routingKey string, x interface{}) error {
+	if strings.HasPrefix(routingKey, "route.") {
+		return &CCRouteError{RoutingKey: routingKey}
+	}
+	val := reflect.ValueOf(x).Elem()
+	fields := []int{}
+	multi := -1
+	for i := 0; i < val.NumField(); i++ {
+		switch val.Type().Field(i).Tag.Get("mwords") {
+		case "#":
+			multi = len(fields)
+			fields = append(fields, i)
+		case "*":
+			fields = append(fields, i)
+		}
+	}
+	words := strings.Split(routingKey, ".")
+	if multi == -1 && len(words) != len(fields) || multi >= 0 && len(words) < len(fields)-1 {
+		return fmt.Errorf("routing key %q has %v words, which does not match %v", routingKey, len(words), val.Type())
+	}
+	// number of fields after the multi-word field
+	after := len(fields) - 1 - multi
+	for j, i := range fields {
+		switch {
+		case multi == -1 || j < multi:
+			val.Field(i).SetString(words[j])
+		case j == multi:
+			val.Field(i).SetString(strings.Join(words[j:len(words)-after], "."))
+		default:
+			val.Field(i).SetString(words[len(words)-len(fields)+j])
+		}
+		if c := val.Type().Field(i).Tag.Get("constant"); c != "" && val.Field(i).String() != c {
+			return fmt.Errorf("routing key %q does not match %v, which always has %v %q", routingKey, val.Type(), val.Type().Field(i).Name, c)
+		}
+	}
+	return nil
+}
+
+// CCRouteError is returned when parsing a routing key which is a task
+// specific route that a message was CC'ed to, e.g. ` + "`route.notify.by-email`" + `,
+// rather than a primary routing key.
+type CCRouteError struct {
+	RoutingKey string
+}
+
+func (err *CCRouteError) Error() string {
+	return fmt.Sprintf("routing key %q is a CC'ed task specific route, not a primary routing key", err.RoutingKey)
+}
+
+// CCRoutes returns the task specific routes, without their ` + "`route.`" + ` prefix,
+// that a delivered message was CC'ed to.
+func CCRoutes(delivery amqp.Delivery) []string {
+	routes := []string{}
+	cc, _ := delivery.Headers["CC"].([]interface{})
+	for _, key := range cc {
+		if route, ok := key.(string); ok && strings.HasPrefix(route, "route.") {
+			routes = append(routes, strings.TrimPrefix(route, "route."))
+		}
+	}
+	return routes
+}
+
+// ParseRoutingKey returns the binding of the given exchange, e.g. *` + typeNames[0] + `,
+// with its fields set from routingKey, which must be the primary routing key
+// of a message from the exchange, such as delivery.RoutingKey.
+func ParseRoutingKey(exchange, routingKey string) (interface{}, error) {
+	var binding interface{}
+	switch exchange {
+`
+	for i, entry := range exchange.Entries {
+		content += `	case "` + entry.Parent.ExchangePrefix + entry.Exchange + `":
+		binding = new(` + typeNames[i] + `)
+`
+	}
+	content += `	default:
+		return nil, fmt.Errorf("unknown exchange %v", exchange)
+	}
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+`
+	return content
+}
+
+// generateHandlersCode generates the Handlers type, which dispatches
+// messages to a type-safe handler function per exchange entry, where
+// typeNames are the binding type names of the entries.
+func (exchange *Exchange) generateHandlersCode(typeNames []string) string {
+	example := typeNames[0]
+	content := `
+// Handlers dispatches pulse messages from the exchanges of this package to
+// type-safe handler functions, and acknowledges them according to the
+// result. Set a handler for each exchange of interest, and pass
+// handlers.Callback() to pulse.Connection.Consume with autoAck false, e.g.
+//
+//  handlers := &` + exchange.apiDef.PackageName + `.Handlers{
+//  	` + example + `: func(message *` + exchange.apiDef.PackageName + `.` + exchange.Entries[0].Payload.TypeName + `, delivery amqp.Delivery) error {
+//  		// handle message...
+//  	},
+//  }
+//  conn.Consume("my-queue", handlers.Callback(), 1, false, ` + exchange.apiDef.PackageName + `.` + example + `{})
+//
+// A handler returning nil acknowledges the message. A handler returning an
+// error negatively acknowledges it, requeueing it if the Requeue policy says
+// so.
+type Handlers struct {
+`
+	for i, entry := range exchange.Entries {
+		content += "\t// Handles messages from exchange " + entry.Parent.ExchangePrefix + entry.Exchange + "\n"
+		content += "\t" + typeNames[i] + " func(message *" + entry.Payload.TypeName + ", delivery amqp.Delivery) error\n"
+	}
+	content += `	// Handles messages from exchanges without a handler, if not nil;
+	// otherwise such messages are acknowledged and dropped
+	Unknown func(message interface{}, delivery amqp.Delivery) error
+	// Decides whether a message that could not be handled is requeued (true)
+	// or discarded (false); DefaultRequeue is used if nil
+	Requeue func(err error, delivery amqp.Delivery) bool
+}
+
+// DecodeError is returned by Handlers.Handle when a message body cannot be
+// decoded into the message type of its exchange.
+type DecodeError struct {
+	Exchange string
+	Err      error
+}
+
+func (err *DecodeError) Error() string {
+	return fmt.Sprintf("could not decode message from exchange %v: %v", err.Exchange, err.Err)
+}
+
+// Permanent reports that decoding the message would fail again, so that
+// consumers such as pulseconsumer.Supervisor do not retry it.
+func (err *DecodeError) Permanent() bool {
+	return true
+}
+
+// PermanentError can be returned by a handler to signal that handling the
+// message would fail again, so it should not be requeued.
+type PermanentError struct {
+	Err error
+}
+
+func (err *PermanentError) Error() string {
+	return err.Err.Error()
+}
+
+// Permanent reports that handling the message would fail again, so that
+// consumers such as pulseconsumer.Supervisor do not retry it.
+func (err *PermanentError) Permanent() bool {
+	return true
+}
+
+// DefaultRequeue requeues a message that could not be handled, unless err is
+// a *DecodeError or *PermanentError, or the message has already been
+// redelivered, so that each message is retried at most once.
+func DefaultRequeue(err error, delivery amqp.Delivery) bool {
+	switch err.(type) {
+	case *DecodeError, *PermanentError:
+		return false
+	}
+	return !delivery.Redelivered
+}
+
+// Handle calls the handler for the exchange of the delivery, decoding
+// delivery.Body if message is not already of the message type of the
+// exchange, and returns the handler's error. Handle does not acknowledge the
+// message, so it can also be used when consuming with autoAck.
+func (handlers *Handlers) Handle(message interface{}, delivery amqp.Delivery) error {
+	switch delivery.Exchange {
+`
+	for i, entry := range exchange.Entries {
+		content += `	case "` + entry.Parent.ExchangePrefix + entry.Exchange + `":
+		if handlers.` + typeNames[i] + ` != nil {
+			m, ok := message.(*` + entry.Payload.TypeName + `)
+			if !ok {
+				m = new(` + entry.Payload.TypeName + `)
+				if err := json.Unmarshal(delivery.Body, m); err != nil {
+					return &DecodeError{Exchange: delivery.Exchange, Err: err}
+				}
+			}
+			return handlers.` + typeNames[i] + `(m, delivery)
+		}
+`
+	}
+	content += `	}
+	if handlers.Unknown != nil {
+		return handlers.Unknown(message, delivery)
+	}
+	return nil
+}
+
+// Callback returns a callback for pulse.Connection.Consume, which calls
+// Handle, and acknowledges the message if it was handled successfully, or
+// else negatively acknowledges it, requeueing it if the Requeue policy says
+// so. Consume must be called with autoAck false.
+func (handlers *Handlers) Callback() func(message interface{}, delivery amqp.Delivery) {
+	return func(message interface{}, delivery amqp.Delivery) {
+		err := handlers.Handle(message, delivery)
+		if err == nil {
+			delivery.Ack(false)
+			return
+		}
+		requeue := handlers.Requeue
+		if requeue == nil {
+			requeue = DefaultRequeue
+		}
+		delivery.Nack(false, requeue(err, delivery))
+	}
+}
 `
 	return content
 }
@@ -188,9 +573,19 @@ func (entry *ExchangeEntry) generateAPICode(exchangeEntry string) string {
 		if rk.MultipleWords {
 			mwch = "#"
 		}
-		content += "\t" + utils.Normalise(rk.Name, keyNames) + " string `mwords:\"" + mwch + "\"`\n"
+		tags := "mwords:\"" + mwch + "\""
+		if rk.Constant != "" {
+			tags += " constant:\"" + rk.Constant + "\""
+		}
+		if rk.Required {
+			tags += " required:\"true\""
+		}
+		content += "\t" + utils.Normalise(rk.Name, keyNames) + " string `" + tags + "`\n"
 	}
 	content += "}\n"
+	content += "\n"
+	content += "// RoutingKey returns the routing key pattern of the binding. It panics if\n"
+	content += "// Validate returns an error, rather than return the wrong pattern.\n"
 	content += "func (binding " + exchangeEntry + ") RoutingKey() string {\n"
 	content += "\treturn generateRoutingKey(&binding)\n"
 	content += "}\n"
@@ -203,5 +598,214 @@ func (entry *ExchangeEntry) generateAPICode(exchangeEntry string) string {
 	content += "\treturn new(" + entry.Payload.TypeName + ")\n"
 	content += "}\n"
 	content += "\n"
+	content += "// Validate returns an error if a field of the binding has a value which\n"
+	content += "// would not result in the intended routing key pattern, e.g. a value\n"
+	content += "// containing a '.'.\n"
+	content += "func (binding " + exchangeEntry + ") Validate() error {\n"
+	content += "\treturn validateRoutingKey(&binding)\n"
+	content += "}\n"
+	content += "\n"
+	content += entry.generateParseCode(exchangeEntry)
+	content += entry.generatePublishCode(exchangeEntry)
 	return content
 }
+
+// generatePublishCode generates the schema of messages published to the
+// exchange of the entry, and the function for publishing them, where
+// exchangeEntry is the binding type name of the entry.
+func (entry *ExchangeEntry) generatePublishCode(exchangeEntry string) string {
+	exchangeName := entry.Parent.ExchangePrefix + entry.Exchange
+	schemaName := strings.ToLower(exchangeEntry[:1]) + exchangeEntry[1:] + "Schema"
+	schema := entry.Payload.messageSchema()
+	if strings.Contains(schema, "`") {
+		schema = strconv.Quote(schema)
+	} else {
+		schema = "`" + schema + "`"
+	}
+	return `// ` + schemaName + ` is the schema of messages for exchange
+// ` + exchangeName + `, with references resolved
+const ` + schemaName + ` = ` + schema + `
+
+// Publish` + exchangeEntry + ` publishes message with publisher, after checking it
+// against the schema of its exchange, to exchange
+// ` + exchangeName + `
+//
+// The routing key is made from the fields of binding, which may not contain
+// wildcards, and the message is CC'ed to ` + "`route.<route>`" + ` for each of the
+// given task specific routes.
+func Publish` + exchangeEntry + `(publisher Publisher, binding ` + exchangeEntry + `, message *` + entry.Payload.TypeName + `, routes ...string) error {
+	return publish(publisher, binding.ExchangeName(), &binding, message, ` + schemaName + `, routes)
+}
+
+`
+}
+
+// messageSchema returns subSchema, with references to other schemas
+// resolved, as a compact json document, which the generated Publish
+// functions check messages against with schemacheck.Validate.
+func (subSchema *JsonSubSchema) messageSchema() string {
+	data, err := json.Marshal(subSchema.resolved())
+	utils.ExitOnFail(err)
+	return string(data)
+}
+
+// resolved returns the keywords of subSchema which constrain documents,
+// with references to other schemas resolved.
+func (subSchema *JsonSubSchema) resolved() map[string]interface{} {
+	if subSchema.RefSubSchema != nil {
+		return subSchema.RefSubSchema.resolved()
+	}
+	c := map[string]interface{}{}
+	if subSchema.Type != nil {
+		c["type"] = *subSchema.Type
+	}
+	if len(subSchema.Enum) > 0 {
+		c["enum"] = subSchema.Enum
+	}
+	if subSchema.Format != nil {
+		c["format"] = *subSchema.Format
+	}
+	if subSchema.Pattern != nil {
+		c["pattern"] = *subSchema.Pattern
+	}
+	if subSchema.Minimum != nil {
+		c["minimum"] = *subSchema.Minimum
+	}
+	if subSchema.Maximum != nil {
+		c["maximum"] = *subSchema.Maximum
+	}
+	if subSchema.MinLength != nil {
+		c["minLength"] = *subSchema.MinLength
+	}
+	if subSchema.MaxLength != nil {
+		c["maxLength"] = *subSchema.MaxLength
+	}
+	if subSchema.MinItems != nil {
+		c["minItems"] = *subSchema.MinItems
+	}
+	if subSchema.MaxItems != nil {
+		c["maxItems"] = *subSchema.MaxItems
+	}
+	if subSchema.UniqueItems != nil {
+		c["uniqueItems"] = *subSchema.UniqueItems
+	}
+	if len(subSchema.Required) > 0 {
+		c["required"] = subSchema.Required
+	}
+	if subSchema.Properties != nil && len(subSchema.Properties.Properties) > 0 {
+		properties := map[string]interface{}{}
+		for name, property := range subSchema.Properties.Properties {
+			properties[name] = property.resolved()
+		}
+		c["properties"] = properties
+	}
+	if ap := subSchema.AdditionalProperties; ap != nil {
+		if ap.Boolean != nil {
+			c["additionalProperties"] = *ap.Boolean
+		} else if ap.Properties != nil {
+			c["additionalProperties"] = ap.Properties.resolved()
+		}
+	}
+	if subSchema.Items != nil {
+		c["items"] = subSchema.Items.resolved()
+	}
+	if subSchema.AdditionalItems != nil {
+		c["additionalItems"] = *subSchema.AdditionalItems
+	}
+	for keyword, items := range map[string]Items{"allOf": subSchema.AllOf, "anyOf": subSchema.AnyOf, "oneOf": subSchema.OneOf} {
+		if len(items) > 0 {
+			schemas := make([]interface{}, len(items))
+			for i := range items {
+				schemas[i] = items[i].resolved()
+			}
+			c[keyword] = schemas
+		}
+	}
+	return c
+}
+
+// generatePublishCode generates the Publisher interface, and the routing
+// key and schema checks used by the Publish functions of the entries.
+func (exchange *Exchange) generatePublishCode() string {
+	return `
+// Publisher publishes a message body to an exchange with a routing key,
+// CC'ed to further routing keys, e.g. ` + "`route.<route>`" + ` for task specific
+// routes. The Publish functions of this package publish through a
+// Publisher, such as a *pulsetest.Broker. On top of amqp, a Publisher would
+// publish body as an application/json message, with the cc routing keys in
+// its "CC" header.
+type Publisher interface {
+	Publish(exchange, routingKey string, cc []string, body []byte) error
+}
+
+// SchemaError is returned by the Publish functions when a message does not
+// conform to the schema of its exchange.
+type SchemaError struct {
+	Exchange string
+	Err      error
+}
+
+func (err *SchemaError) Error() string {
+	return fmt.Sprintf("message for exchange %v does not conform to its schema: %v", err.Exchange, err.Err)
+}
+
+// publish publishes message to exchange with publisher, with the routing key
+// of binding x, after checking the message against schema.
+func publish(publisher Publisher, exchange string, x interface{}, message interface{}, schema string, routes []string) error {
+	routingKey, err := publishRoutingKey(x)
+	if err != nil {
+		return err
+	}
+	cc := make([]string, len(routes))
+	for i, route := range routes {
+		for _, word := range strings.Split(route, ".") {
+			if word == "" || strings.ContainsAny(word, "*#") {
+				return fmt.Errorf("cannot publish to invalid route %q", route)
+			}
+		}
+		cc[i] = "route." + route
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if err := schemacheck.Validate(schema, body); err != nil {
+		return &SchemaError{Exchange: exchange, Err: err}
+	}
+	return publisher.Publish(exchange, routingKey, cc, body)
+}
+
+// publishRoutingKey returns the routing key for publishing a message with
+// the routing key fields of binding x. A routing key for publishing may not
+// contain wildcards, so fields which are not set are published as '_', as
+// the TaskCluster services do for values that are not present, except that
+// required fields must be set.
+func publishRoutingKey(x interface{}) (string, error) {
+	if err := validateRoutingKey(x); err != nil {
+		return "", err
+	}
+	val := reflect.ValueOf(x).Elem()
+	p := make([]string, 0, val.NumField())
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		if field.Tag.Get("mwords") == "" {
+			continue
+		}
+		value := val.Field(i).String()
+		if value == "" {
+			value = field.Tag.Get("constant")
+		}
+		switch {
+		case value == "" && field.Tag.Get("required") == "true":
+			return "", fmt.Errorf("%v.%v is required to publish a message", val.Type(), field.Name)
+		case value == "":
+			value = "_"
+		case strings.ContainsAny(value, "*#"):
+			return "", fmt.Errorf("%v.%v %q may not contain wildcards when publishing a message", val.Type(), field.Name, value)
+		}
+		p = append(p, value)
+	}
+	return strings.Join(p, "."), nil
+}
+`
+}
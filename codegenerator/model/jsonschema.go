@@ -28,8 +28,10 @@ type (
 		ID                   *string               `json:"id"`
 		Items                *JsonSubSchema        `json:"items"`
 		Maximum              *int                  `json:"maximum"`
+		MaxItems             *int                  `json:"maxItems"`
 		MaxLength            *int                  `json:"maxLength"`
 		Minimum              *int                  `json:"minimum"`
+		MinItems             *int                  `json:"minItems"`
 		MinLength            *int                  `json:"minLength"`
 		OneOf                Items                 `json:"oneOf"`
 		Pattern              *string               `json:"pattern"`
@@ -39,6 +41,7 @@ type (
 		Schema               *string               `json:"$schema"`
 		Title                *string               `json:"title"`
 		Type                 *string               `json:"type"`
+		UniqueItems          *bool                 `json:"uniqueItems"`
 
 		// non-json fields used for sorting/tracking
 		TypeName       string
@@ -207,6 +210,19 @@ func (jsonSubSchema *JsonSubSchema) TypeDefinition(withComments bool, extraPacka
 	return content, extraPackages, rawMessageTypes
 }
 
+// memberNames returns the go struct member names that TypeDefinition
+// generates for the properties of an object schema, keyed by property name.
+func (jsonSubSchema *JsonSubSchema) memberNames() map[string]string {
+	names := make(map[string]string)
+	if s := jsonSubSchema.Properties; s != nil {
+		members := make(map[string]bool, len(s.SortedPropertyNames))
+		for _, j := range s.SortedPropertyNames {
+			names[j] = utils.Normalise(j, members)
+		}
+	}
+	return names
+}
+
 func (p Properties) String() string {
 	result := ""
 	for _, i := range p.SortedPropertyNames {
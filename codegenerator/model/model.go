@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -41,9 +42,14 @@ type APIModel interface {
 // APIDefinition represents the definition of a REST API, comprising of the URL to the defintion
 // of the API in json format, together with a URL to a json schema to validate the definition
 type APIDefinition struct {
-	URL            string `json:"url"`
-	Name           string `json:"name"`
-	DocRoot        string `json:"docroot"`
+	URL     string `json:"url"`
+	Name    string `json:"name"`
+	DocRoot string `json:"docroot"`
+	// Outputs of API entries whose reference defines no output schema, by
+	// entry name. Each is either the url of a json schema to generate the
+	// response type from, or a go type, such as json.RawMessage, or a type
+	// declared in a hand-written file of the generated package.
+	Outputs        map[string]string `json:"outputs"`
 	Data           APIModel
 	schemaURLs     []string
 	schemas        map[string]*JsonSubSchema
@@ -249,31 +255,8 @@ func GenerateCode(goOutputDir, modelData string) {
 		content += newContent
 		content += jsonRawMessageImplementors(&apiDefs[i], rawMessageTypes)
 		content += timeManagement(&apiDefs[i])
-		extraPackagesString := ""
-		for j, k := range extraPackages {
-			if k {
-				extraPackagesString += "\t\"" + j + "\"\n"
-			}
-		}
-		content = strings.Replace(content, "%%{imports}", extraPackagesString, -1)
-		sourceFile := filepath.Join(apiDefs[i].PackagePath, apiDefs[i].PackageName+".go")
-		fmt.Println("Formatting source code " + sourceFile + "...")
-		// first run goimports to clean up unused imports
-		fixedImports, err := imports.Process(sourceFile, []byte(content), nil)
-		// only proceed, if that worked...
-		var formattedContent []byte
-		if err == nil {
-			// now run a standard system format
-			formattedContent, err = format.Source(fixedImports)
-		}
-		// in case of formatting failure from either of the above formatting
-		// steps, let's keep the unformatted version so we can troubleshoot
-		// more easily...
-		if err != nil {
-			utils.WriteStringToFile(content, sourceFile)
-		}
-		utils.ExitOnFail(err)
-		utils.WriteStringToFile(string(formattedContent), sourceFile)
+		extraPackages["github.com/taskcluster/taskcluster-client-go/relativetime"] = true
+		writeGoSource(content, extraPackages, filepath.Join(apiDefs[i].PackagePath, apiDefs[i].PackageName+".go"))
 	}
 
 	content := "The following file is an auto-generated static dump of the API models at time of code generation.\n"
@@ -290,6 +273,104 @@ func GenerateCode(goOutputDir, modelData string) {
 	utils.WriteStringToFile(content, modelData)
 }
 
+// GenerateWorkerPayloads generates a go package for each of the given worker
+// payload schemas, containing go types for the schema (and any schemas it
+// references) which can be registered with queue.RegisterPayload. Each spec
+// has the form <package>=<schema url>, e.g.
+// dockerworker=http://schemas.taskcluster.net/docker-worker/v1/payload.json#
+func GenerateWorkerPayloads(goOutputDir string, specs []string) {
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			fmt.Printf("\nFATAL: Worker payload schema '%v' is not of the form <package>=<schema url>, therefore exiting...\n\n", spec)
+			os.Exit(66)
+		}
+		url := parts[1]
+		apiDef := &APIDefinition{
+			URL:         url,
+			Name:        parts[0],
+			PackageName: strings.ToLower(parts[0]),
+			schemas:     make(map[string]*JsonSubSchema),
+		}
+		apiDef.cacheJsonSchema(&url)
+		apiDef.schemaURLs = make([]string, 0, len(apiDef.schemas))
+		for u := range apiDef.schemas {
+			apiDef.schemaURLs = append(apiDef.schemaURLs, u)
+		}
+		sort.Strings(apiDef.schemaURLs)
+		TypeName := make(map[string]bool)
+		for _, u := range apiDef.schemaURLs {
+			// worker payload schemas don't always have a title, so fall back
+			// to the name of the schema file, e.g. "payload"
+			title := strings.TrimSuffix(path.Base(strings.TrimSuffix(u, "#")), ".json")
+			if apiDef.schemas[u].Title != nil && *apiDef.schemas[u].Title != "" {
+				title = *apiDef.schemas[u].Title
+			}
+			apiDef.schemas[u].TypeName = utils.Normalise(title, TypeName)
+		}
+		apiDef.PackagePath = filepath.Join(goOutputDir, apiDef.PackageName)
+		err := os.MkdirAll(apiDef.PackagePath, 0755)
+		utils.ExitOnFail(err)
+		content := `
+// The following code is AUTO-GENERATED. Please DO NOT edit.
+// To update this generated code, run generatemodel with option
+// -p ` + spec + `
+//
+// This package was generated from the worker payload schema defined at
+// ` + url + `
+
+// Package ` + apiDef.PackageName + ` contains go types for the task payloads of workers
+// using the worker payload schema at ` + url + `
+// Register type ` + apiDef.schemas[url].TypeName + ` for the relevant worker types with
+// queue.RegisterPayload in order to build and fetch typed task payloads.
+package ` + apiDef.PackageName + `
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+%%{imports}
+)
+
+`
+		newContent, extraPackages, rawMessageTypes := generatePayloadTypes(apiDef)
+		content += newContent
+		content += jsonRawMessageImplementors(apiDef, rawMessageTypes)
+		content += timeManagement(apiDef)
+		extraPackages["github.com/taskcluster/taskcluster-client-go/relativetime"] = true
+		writeGoSource(content, extraPackages, filepath.Join(apiDef.PackagePath, apiDef.PackageName+".go"))
+	}
+}
+
+// writeGoSource substitutes the extra packages into the %%{imports}
+// placeholder of content, formats it, and writes it to sourceFile.
+func writeGoSource(content string, extraPackages map[string]bool, sourceFile string) {
+	extraPackagesString := ""
+	for j, k := range extraPackages {
+		if k {
+			extraPackagesString += "\t\"" + j + "\"\n"
+		}
+	}
+	content = strings.Replace(content, "%%{imports}", extraPackagesString, -1)
+	fmt.Println("Formatting source code " + sourceFile + "...")
+	// first run goimports to clean up unused imports
+	fixedImports, err := imports.Process(sourceFile, []byte(content), nil)
+	// only proceed, if that worked...
+	var formattedContent []byte
+	if err == nil {
+		// now run a standard system format
+		formattedContent, err = format.Source(fixedImports)
+	}
+	// in case of formatting failure from either of the above formatting
+	// steps, let's keep the unformatted version so we can troubleshoot
+	// more easily...
+	if err != nil {
+		utils.WriteStringToFile(content, sourceFile)
+	}
+	utils.ExitOnFail(err)
+	utils.WriteStringToFile(string(formattedContent), sourceFile)
+}
+
 func jsonRawMessageImplementors(apiDef *APIDefinition, rawMessageTypes map[string]bool) string {
 	// first sort the order of the rawMessageTypes since when we rebuild, we
 	// don't want to generate functions in a different order and introduce
@@ -362,6 +443,15 @@ func (t *Time) UnmarshalJSON(data []byte) (err error) {
 func (t Time) String() string {
 	return time.Time(t).UTC().Format("2006-01-02T15:04:05.000Z")
 }
+
+// FromNow returns the Time which is the given relative time expression from
+// now, e.g. "2 days 3 hours", "in 1 day" or "-30 minutes". See package
+// github.com/taskcluster/taskcluster-client-go/relativetime for the supported
+// syntax.
+func FromNow(expr string) (Time, error) {
+	t, err := relativetime.FromNow(expr)
+	return Time(t), err
+}
 `
 }
 
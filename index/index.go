@@ -130,8 +130,10 @@ import (
 	"time"
 
 	"github.com/taskcluster/httpbackoff"
+	"github.com/taskcluster/taskcluster-client-go/relativetime"
 	hawk "github.com/tent/hawk-go"
 	D "github.com/tj/go-debug"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -313,6 +315,107 @@ func (myIndex *Index) ListNamespaces(namespace string, payload *ListNamespacesRe
 	return responseObject.(*ListNamespacesResponse), callSummary
 }
 
+// ListNamespacesIterator pages through the results of ListNamespaces,
+// following continuation tokens transparently. See
+// Index.ListNamespacesIterator.
+type ListNamespacesIterator struct {
+	myIndex     *Index
+	ctx         context.Context
+	namespace   string
+	payload     ListNamespacesRequest
+	limit       int
+	count       int
+	pages       int
+	page        *ListNamespacesResponse
+	callSummary *CallSummary
+	err         error
+	done        bool
+}
+
+// ListNamespacesIterator returns an iterator over the pages of results of
+// ListNamespaces, for example:
+//
+//  iterator := myIndex.ListNamespacesIterator(context.Background(), namespace, nil, 0)
+//  for iterator.Next() {
+//  	for _, item := range iterator.Page().Namespaces {
+//  		// ...
+//  	}
+//  }
+//  if err := iterator.Err(); err != nil {
+//  	// handle error...
+//  }
+//
+// The payload may be nil, or give e.g. the page size or a continuation token
+// to start from. Iteration ends when there are no more results, when limit
+// results have been returned (if limit > 0), when a page cannot be fetched,
+// or when ctx is done, which is checked before fetching each page.
+func (myIndex *Index) ListNamespacesIterator(ctx context.Context, namespace string, payload *ListNamespacesRequest, limit int) *ListNamespacesIterator {
+	iterator := &ListNamespacesIterator{
+		myIndex:   myIndex,
+		ctx:       ctx,
+		namespace: namespace,
+		limit:     limit,
+	}
+	if payload != nil {
+		iterator.payload = *payload
+	}
+	return iterator
+}
+
+// Next fetches the next page of results, which is then available from Page.
+// It returns false when iteration has ended; check Err to see why.
+func (iterator *ListNamespacesIterator) Next() bool {
+	if iterator.done {
+		return false
+	}
+	select {
+	case <-iterator.ctx.Done():
+		iterator.err = iterator.ctx.Err()
+		iterator.done = true
+		return false
+	default:
+	}
+	if iterator.payload.Limit == 0 {
+		iterator.payload.Limit = 1000
+	}
+	if remaining := iterator.limit - iterator.count; iterator.limit > 0 && (iterator.payload.Limit == 0 || iterator.payload.Limit > remaining) {
+		iterator.payload.Limit = remaining
+	}
+	iterator.pages++
+	iterator.page, iterator.callSummary = iterator.myIndex.ListNamespaces(iterator.namespace, &iterator.payload)
+	if iterator.callSummary.Error != nil {
+		iterator.err = &PageError{Page: iterator.pages, CallSummary: iterator.callSummary}
+		iterator.done = true
+		return false
+	}
+	if iterator.limit > 0 && iterator.count+len(iterator.page.Namespaces) >= iterator.limit {
+		iterator.page.Namespaces = iterator.page.Namespaces[:iterator.limit-iterator.count]
+		iterator.done = true
+	}
+	iterator.count += len(iterator.page.Namespaces)
+	iterator.payload.ContinuationToken = iterator.page.ContinuationToken
+	if iterator.page.ContinuationToken == "" {
+		iterator.done = true
+	}
+	return true
+}
+
+// Page returns the page of results fetched by the last call to Next.
+func (iterator *ListNamespacesIterator) Page() *ListNamespacesResponse {
+	return iterator.page
+}
+
+// CallSummary returns the CallSummary of the last page request.
+func (iterator *ListNamespacesIterator) CallSummary() *CallSummary {
+	return iterator.callSummary
+}
+
+// Err returns the error which ended iteration, if any. This is a *PageError
+// if a page could not be fetched, or the error of ctx if it was done.
+func (iterator *ListNamespacesIterator) Err() error {
+	return iterator.err
+}
+
 // List the tasks immediately under a given namespace. This end-point
 // list up to 1000 tasks. If more tasks are present a
 // `continuationToken` will be returned, which can be given in the next
@@ -328,6 +431,107 @@ func (myIndex *Index) ListTasks(namespace string, payload *ListTasksRequest) (*L
 	return responseObject.(*ListTasksResponse), callSummary
 }
 
+// ListTasksIterator pages through the results of ListTasks,
+// following continuation tokens transparently. See
+// Index.ListTasksIterator.
+type ListTasksIterator struct {
+	myIndex     *Index
+	ctx         context.Context
+	namespace   string
+	payload     ListTasksRequest
+	limit       int
+	count       int
+	pages       int
+	page        *ListTasksResponse
+	callSummary *CallSummary
+	err         error
+	done        bool
+}
+
+// ListTasksIterator returns an iterator over the pages of results of
+// ListTasks, for example:
+//
+//  iterator := myIndex.ListTasksIterator(context.Background(), namespace, nil, 0)
+//  for iterator.Next() {
+//  	for _, item := range iterator.Page().Tasks {
+//  		// ...
+//  	}
+//  }
+//  if err := iterator.Err(); err != nil {
+//  	// handle error...
+//  }
+//
+// The payload may be nil, or give e.g. the page size or a continuation token
+// to start from. Iteration ends when there are no more results, when limit
+// results have been returned (if limit > 0), when a page cannot be fetched,
+// or when ctx is done, which is checked before fetching each page.
+func (myIndex *Index) ListTasksIterator(ctx context.Context, namespace string, payload *ListTasksRequest, limit int) *ListTasksIterator {
+	iterator := &ListTasksIterator{
+		myIndex:   myIndex,
+		ctx:       ctx,
+		namespace: namespace,
+		limit:     limit,
+	}
+	if payload != nil {
+		iterator.payload = *payload
+	}
+	return iterator
+}
+
+// Next fetches the next page of results, which is then available from Page.
+// It returns false when iteration has ended; check Err to see why.
+func (iterator *ListTasksIterator) Next() bool {
+	if iterator.done {
+		return false
+	}
+	select {
+	case <-iterator.ctx.Done():
+		iterator.err = iterator.ctx.Err()
+		iterator.done = true
+		return false
+	default:
+	}
+	if iterator.payload.Limit == 0 {
+		iterator.payload.Limit = 1000
+	}
+	if remaining := iterator.limit - iterator.count; iterator.limit > 0 && (iterator.payload.Limit == 0 || iterator.payload.Limit > remaining) {
+		iterator.payload.Limit = remaining
+	}
+	iterator.pages++
+	iterator.page, iterator.callSummary = iterator.myIndex.ListTasks(iterator.namespace, &iterator.payload)
+	if iterator.callSummary.Error != nil {
+		iterator.err = &PageError{Page: iterator.pages, CallSummary: iterator.callSummary}
+		iterator.done = true
+		return false
+	}
+	if iterator.limit > 0 && iterator.count+len(iterator.page.Tasks) >= iterator.limit {
+		iterator.page.Tasks = iterator.page.Tasks[:iterator.limit-iterator.count]
+		iterator.done = true
+	}
+	iterator.count += len(iterator.page.Tasks)
+	iterator.payload.ContinuationToken = iterator.page.ContinuationToken
+	if iterator.page.ContinuationToken == "" {
+		iterator.done = true
+	}
+	return true
+}
+
+// Page returns the page of results fetched by the last call to Next.
+func (iterator *ListTasksIterator) Page() *ListTasksResponse {
+	return iterator.page
+}
+
+// CallSummary returns the CallSummary of the last page request.
+func (iterator *ListTasksIterator) CallSummary() *CallSummary {
+	return iterator.callSummary
+}
+
+// Err returns the error which ended iteration, if any. This is a *PageError
+// if a page could not be fetched, or the error of ctx if it was done.
+func (iterator *ListTasksIterator) Err() error {
+	return iterator.err
+}
+
 // Insert a task into the index. Please see the introduction above, for how
 // to index successfully completed tasks automatically, using custom routes.
 //
@@ -358,9 +562,21 @@ func (myIndex *Index) FindArtifactFromTask(namespace string, name string) *CallS
 // **Warning** this api end-point is **not stable**.
 //
 // See http://docs.taskcluster.net/services/index/#ping
-func (myIndex *Index) Ping() *CallSummary {
-	_, callSummary := myIndex.apiCall(nil, "GET", "/ping", nil)
-	return callSummary
+func (myIndex *Index) Ping() (*json.RawMessage, *CallSummary) {
+	responseObject, callSummary := myIndex.apiCall(nil, "GET", "/ping", new(json.RawMessage))
+	return responseObject.(*json.RawMessage), callSummary
+}
+
+// PageError is the error returned by the Err method of an iterator when a
+// page of results could not be fetched.
+type PageError struct {
+	// Number of the page which could not be fetched, starting at 1
+	Page        int
+	CallSummary *CallSummary
+}
+
+func (err *PageError) Error() string {
+	return fmt.Sprintf("could not fetch page %v of results: %v", err.Page, err.CallSummary.Error)
 }
 
 type (
@@ -523,3 +739,12 @@ func (t *Time) UnmarshalJSON(data []byte) (err error) {
 func (t Time) String() string {
 	return time.Time(t).UTC().Format("2006-01-02T15:04:05.000Z")
 }
+
+// FromNow returns the Time which is the given relative time expression from
+// now, e.g. "2 days 3 hours", "in 1 day" or "-30 minutes". See package
+// github.com/taskcluster/taskcluster-client-go/relativetime for the supported
+// syntax.
+func FromNow(expr string) (Time, error) {
+	t, err := relativetime.FromNow(expr)
+	return Time(t), err
+}
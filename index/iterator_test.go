@@ -0,0 +1,99 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// fakeIndex serves namespaces "ns0" to "ns<total-1>" under any namespace,
+// using the index of the next namespace as continuation token.
+func fakeIndex(t *testing.T, total int, requests *[]ListNamespacesRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ListNamespacesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Could not decode request: %v", err)
+		}
+		*requests = append(*requests, req)
+		start, _ := strconv.Atoi(req.ContinuationToken)
+		var resp ListNamespacesResponse
+		for i := start; i < start+req.Limit && i < total; i++ {
+			resp.Namespaces = append(resp.Namespaces, struct {
+				Expires   Time   `json:"expires"`
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			}{Name: fmt.Sprintf("ns%v", i)})
+			if i+1 < total {
+				resp.ContinuationToken = strconv.Itoa(i + 1)
+			} else {
+				resp.ContinuationToken = ""
+			}
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}))
+}
+
+func TestIteratorFollowsContinuationTokens(t *testing.T) {
+	var requests []ListNamespacesRequest
+	server := fakeIndex(t, 7, &requests)
+	defer server.Close()
+	myIndex := New("", "")
+	myIndex.BaseURL = server.URL
+
+	names := []string{}
+	iterator := myIndex.ListNamespacesIterator(context.Background(), "buildbot.branches", &ListNamespacesRequest{Limit: 3}, 0)
+	for iterator.Next() {
+		for _, ns := range iterator.Page().Namespaces {
+			names = append(names, ns.Name)
+		}
+	}
+	if err := iterator.Err(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fmt.Sprint(names) != "[ns0 ns1 ns2 ns3 ns4 ns5 ns6]" || len(requests) != 3 {
+		t.Errorf("Expected 7 namespaces in 3 pages, but got %v in %v pages", names, len(requests))
+	}
+}
+
+func TestIteratorLimit(t *testing.T) {
+	var requests []ListNamespacesRequest
+	server := fakeIndex(t, 5000, &requests)
+	defer server.Close()
+	myIndex := New("", "")
+	myIndex.BaseURL = server.URL
+
+	count := 0
+	iterator := myIndex.ListNamespacesIterator(context.Background(), "buildbot.branches", nil, 1500)
+	for iterator.Next() {
+		count += len(iterator.Page().Namespaces)
+	}
+	if iterator.Err() != nil || count != 1500 {
+		t.Errorf("Expected 1500 namespaces without error, but got %v (%v)", count, iterator.Err())
+	}
+	if len(requests) != 2 || requests[0].Limit != 1000 || requests[1].Limit != 500 {
+		t.Errorf("Expected page sizes 1000 and 500, but got %v", requests)
+	}
+}
+
+func TestIteratorCancellation(t *testing.T) {
+	var requests []ListNamespacesRequest
+	server := fakeIndex(t, 5000, &requests)
+	defer server.Close()
+	myIndex := New("", "")
+	myIndex.BaseURL = server.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	iterator := myIndex.ListNamespacesIterator(ctx, "buildbot.branches", nil, 0)
+	if !iterator.Next() {
+		t.Fatalf("Expected first page, but got error %v", iterator.Err())
+	}
+	cancel()
+	if iterator.Next() || iterator.Err() != context.Canceled || len(requests) != 1 {
+		t.Errorf("Expected iteration to stop after cancellation, but got %v after %v requests", iterator.Err(), len(requests))
+	}
+}
@@ -0,0 +1,196 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/queue"
+)
+
+const (
+	// RoutePrefix is the prefix of task routes under which the index
+	// indexes tasks, i.e. a task with route `index.<namespace>` is indexed
+	// under `<namespace>` when it completes successfully.
+	RoutePrefix = "index."
+	// MaxNamespaceLength is the maximum length of a namespace, limited by
+	// the maximum length of a task route.
+	MaxNamespaceLength = 249 - len(RoutePrefix)
+)
+
+// Syntax of each key of a namespace
+var keyPattern = regexp.MustCompile(`^[a-zA-Z0-9_!~*'()%-]+$`)
+
+// ValidateNamespace returns an error if namespace is not a valid namespace
+// for indexing tasks with a task route: a dot separated list of keys,
+// each of which consists of the characters [a-zA-Z0-9_!~*'()%-].
+func ValidateNamespace(namespace string) error {
+	if len(namespace) > MaxNamespaceLength {
+		return fmt.Errorf("namespace %q is longer than %v characters", namespace, MaxNamespaceLength)
+	}
+	for i, key := range strings.Split(namespace, ".") {
+		if !keyPattern.MatchString(key) {
+			return fmt.Errorf("namespace %q has invalid key %q at position %v; keys must be non-empty and match %v", namespace, key, i+1, keyPattern)
+		}
+	}
+	return nil
+}
+
+// Routes returns the task routes to index a task under the given
+// namespaces, e.g. `index.mozilla-central.linux-64.release-build` for
+// namespace `mozilla-central.linux-64.release-build`.
+func Routes(namespaces ...string) ([]string, error) {
+	routes := make([]string, len(namespaces))
+	for i, namespace := range namespaces {
+		if err := ValidateNamespace(namespace); err != nil {
+			return nil, err
+		}
+		routes[i] = RoutePrefix + namespace
+	}
+	return routes, nil
+}
+
+// Namespaces returns the namespaces under which the index will index a task
+// with the given routes, ignoring routes which are not index routes, or
+// whose namespace is invalid.
+func Namespaces(routes []string) []string {
+	namespaces := []string{}
+	for _, route := range routes {
+		if strings.HasPrefix(route, RoutePrefix) && ValidateNamespace(route[len(RoutePrefix):]) == nil {
+			namespaces = append(namespaces, route[len(RoutePrefix):])
+		}
+	}
+	return namespaces
+}
+
+// Indexing holds the details the index reads from `extra.index` of a task
+// definition, when indexing it via its task routes.
+type Indexing struct {
+	// A task only replaces an indexed task with the same or a lower rank
+	Rank int `json:"rank"`
+	// Expiry of the index entries; the index defaults to one year after
+	// the task is indexed if this is the zero time
+	Expires time.Time `json:"-"`
+	// Informal data to store along with the taskId, which must marshal to
+	// a json object (less than 16 kb)
+	Data interface{} `json:"data,omitempty"`
+}
+
+// MarshalJSON formats Expires the way the TaskCluster services do, and
+// omits it if it is the zero time.
+func (indexing *Indexing) MarshalJSON() ([]byte, error) {
+	type plain Indexing
+	value := struct {
+		*plain
+		Expires *Time `json:"expires,omitempty"`
+	}{plain: (*plain)(indexing)}
+	if !indexing.Expires.IsZero() {
+		expires := Time(indexing.Expires)
+		value.Expires = &expires
+	}
+	return json.Marshal(&value)
+}
+
+// MergeExtra returns extra, which must be empty or a json object, with its
+// `index` property set to indexing. Other properties of extra are kept.
+func (indexing *Indexing) MergeExtra(extra json.RawMessage) (json.RawMessage, error) {
+	properties := map[string]json.RawMessage{}
+	if len(extra) > 0 {
+		if err := json.Unmarshal(extra, &properties); err != nil {
+			return nil, fmt.Errorf("extra must be a json object: %v", err)
+		}
+		if properties == nil {
+			properties = map[string]json.RawMessage{}
+		}
+	}
+	if indexing.Data != nil {
+		data, err := json.Marshal(indexing.Data)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal index data: %v", err)
+		}
+		if len(data) == 0 || data[0] != '{' {
+			return nil, fmt.Errorf("index data must be a json object, but is %s", data)
+		}
+	}
+	index, err := json.Marshal(indexing)
+	if err != nil {
+		return nil, err
+	}
+	properties["index"] = index
+	return json.Marshal(properties)
+}
+
+// AddTo adds index routes for the given namespaces to the task definition
+// (skipping routes it already has), and sets `extra.index` of the task
+// definition. For example:
+//
+//	indexing := &index.Indexing{
+//		Rank:    int(time.Now().Unix()),
+//		Expires: time.Time(td.Expires),
+//	}
+//	err := indexing.AddTo(td, "mozilla-central.linux-64.release-build", revision+".linux-64.release-build")
+//
+// Note the task needs scope `queue:route:index.<namespace>` for each
+// namespace.
+func (indexing *Indexing) AddTo(td *queue.TaskDefinition, namespaces ...string) error {
+	routes, err := Routes(namespaces...)
+	if err != nil {
+		return err
+	}
+	extra, err := indexing.MergeExtra(td.Extra)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(td.Routes))
+	for _, route := range td.Routes {
+		existing[route] = true
+	}
+	for _, route := range routes {
+		if !existing[route] {
+			td.Routes = append(td.Routes, route)
+			existing[route] = true
+		}
+	}
+	td.Extra = extra
+	return nil
+}
+
+// RouteStatus describes whether a task can be found in the index under the
+// namespace of one of its index routes.
+type RouteStatus struct {
+	Route     string
+	Namespace string
+	// The taskId currently indexed under Namespace, or "" if none is
+	IndexedTaskId string
+	// True if IndexedTaskId is the task that was checked
+	Reachable bool
+}
+
+// CheckRoutes looks up the namespace of each index route in routes (see
+// Namespaces), and reports whether task taskId is currently indexed under
+// it. A task might not be reachable under a route because it has not
+// completed successfully yet, or because another task with a higher rank
+// is indexed under the namespace. Routes which are not index routes are
+// ignored.
+func (myIndex *Index) CheckRoutes(taskId string, routes []string) ([]RouteStatus, error) {
+	statuses := []RouteStatus{}
+	for _, namespace := range Namespaces(routes) {
+		status := RouteStatus{
+			Route:     RoutePrefix + namespace,
+			Namespace: namespace,
+		}
+		indexedTask, callSummary := myIndex.FindTask(namespace)
+		switch {
+		case callSummary.Error == nil:
+			status.IndexedTaskId = indexedTask.TaskId
+			status.Reachable = indexedTask.TaskId == taskId
+		case callSummary.HttpResponse == nil || callSummary.HttpResponse.StatusCode != http.StatusNotFound:
+			return statuses, fmt.Errorf("could not find task indexed under %v: %v", namespace, callSummary.Error)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
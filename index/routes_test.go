@@ -0,0 +1,80 @@
+package index
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/queue"
+)
+
+func TestValidateNamespace(t *testing.T) {
+	for _, namespace := range []string{"mozilla-central.linux-64.release-build", "a", "x!~*'()%_-1"} {
+		if err := ValidateNamespace(namespace); err != nil {
+			t.Errorf("Expected %q to be valid, but got %v", namespace, err)
+		}
+	}
+	for _, namespace := range []string{"", "a..b", "a.", "a/b", "a b", strings.Repeat("a", MaxNamespaceLength+1)} {
+		if err := ValidateNamespace(namespace); err == nil {
+			t.Errorf("Expected %q to be invalid", namespace)
+		}
+	}
+}
+
+func TestAddTo(t *testing.T) {
+	td := &queue.TaskDefinition{
+		Extra:  json.RawMessage(`{"treeherder":{"symbol":"B"}}`),
+		Routes: []string{"tc-treeherder.mozilla-inbound", "index.a.b"},
+	}
+	indexing := &Indexing{
+		Rank:    12345,
+		Expires: time.Date(2016, 11, 4, 17, 54, 20, 0, time.UTC),
+		Data:    map[string]string{"hgRevision": "bcf29c305519"},
+	}
+	if err := indexing.AddTo(td, "a.b", "c"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if routes := strings.Join(td.Routes, " "); routes != "tc-treeherder.mozilla-inbound index.a.b index.c" {
+		t.Errorf("Unexpected routes %v", routes)
+	}
+	expected := `{"index":{"rank":12345,"data":{"hgRevision":"bcf29c305519"},"expires":"2016-11-04T17:54:20.000Z"},"treeherder":{"symbol":"B"}}`
+	if string(td.Extra) != expected {
+		t.Errorf("Expected extra %v but got %s", expected, td.Extra)
+	}
+	if err := indexing.AddTo(td, "bad..namespace"); err == nil {
+		t.Errorf("Expected invalid namespace to be rejected")
+	}
+	if _, err := (&Indexing{}).MergeExtra(json.RawMessage(`[]`)); err == nil {
+		t.Errorf("Expected extra which is not an object to be rejected")
+	}
+}
+
+func TestCheckRoutes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/task/mine":
+			w.Write([]byte(`{"taskId": "Gu3BJf0IQeuJE-HFKtYI2A"}`))
+		case "/task/theirs":
+			w.Write([]byte(`{"taskId": "XgvL0qtSR92cIWpcwdGKCA"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	myIndex := New("", "")
+	myIndex.BaseURL = server.URL
+
+	statuses, err := myIndex.CheckRoutes("Gu3BJf0IQeuJE-HFKtYI2A", []string{"index.mine", "tc-treeherder.x", "index.theirs", "index.missing"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(statuses) != 3 ||
+		!statuses[0].Reachable ||
+		statuses[1].Reachable || statuses[1].IndexedTaskId != "XgvL0qtSR92cIWpcwdGKCA" ||
+		statuses[2].Reachable || statuses[2].IndexedTaskId != "" {
+		t.Errorf("Unexpected route statuses %#v", statuses)
+	}
+}
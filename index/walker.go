@@ -0,0 +1,309 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// SkipNamespace can be returned by Walker.VisitNamespace to skip the
+// subtree below the visited namespace, without ending the walk.
+var SkipNamespace = errors.New("skip this namespace")
+
+// SkipTask can be returned by Walker.VisitTask to skip the visited task,
+// without ending the walk. It only makes a difference to Walker.Export,
+// which does not export skipped tasks.
+var SkipTask = errors.New("skip this task")
+
+// Order in which a Walker traverses the namespace tree
+type Order int
+
+const (
+	DepthFirst Order = iota
+	BreadthFirst
+)
+
+// IndexedNamespace is a namespace found by a Walker. It has the same fields
+// as the entries of ListNamespacesResponse.Namespaces.
+type IndexedNamespace struct {
+	// Date at which this entry, and by implication all entries below it,
+	// expires from the task index.
+	Expires Time `json:"expires"`
+	// Name of namespace within it's parent namespace.
+	Name string `json:"name"`
+	// Fully qualified name of the namespace
+	Namespace string `json:"namespace"`
+}
+
+// IndexedTask is an indexed task found by a Walker. It has the same fields
+// as the entries of ListTasksResponse.Tasks.
+type IndexedTask struct {
+	// Data that was reported with the task. This is an arbitrary JSON
+	// object.
+	Data json.RawMessage `json:"data"`
+	// Date at which this entry expires from the task index.
+	Expires Time `json:"expires"`
+	// Namespace of the indexed task
+	Namespace string `json:"namespace"`
+	// Rank of the indexed task
+	Rank int `json:"rank"`
+	// Unique task identifier
+	TaskId string `json:"taskId"`
+}
+
+// Walker traverses a subtree of the index, calling VisitNamespace for every
+// namespace and VisitTask for every indexed task found below the namespace
+// the walk starts from. For example, to find indexed tasks that expire
+// within a week:
+//
+//	walker := index.NewWalker(myIndex)
+//	walker.VisitTask = func(task *index.IndexedTask) error {
+//		if time.Time(task.Expires).Before(time.Now().Add(7 * 24 * time.Hour)) {
+//			fmt.Println(task.Namespace)
+//		}
+//		return nil
+//	}
+//	err := walker.Walk(context.Background(), "buildbot.branches")
+//
+// Up to Concurrency namespaces are listed at the same time. The visitor
+// functions are never called concurrently, so they need not be safe for
+// concurrent use. With a Concurrency of 1, namespaces are visited in exact
+// depth-first (pre-order) or breadth-first order, each followed by its
+// tasks. With higher concurrency, Order only determines which namespace is
+// visited next.
+type Walker struct {
+	Index *Index
+	Order Order
+	// Maximum number of namespaces to list concurrently
+	Concurrency int
+	// Called for each namespace, if not nil. Returning SkipNamespace skips
+	// the namespace's subtree, and any other error ends the walk.
+	VisitNamespace func(namespace *IndexedNamespace) error
+	// Called for each indexed task, if not nil. Returning SkipTask skips
+	// the task, and any other error ends the walk. Note that SkipNamespace is
+	// not special here, so it ends the walk.
+	VisitTask func(task *IndexedTask) error
+}
+
+// NewWalker returns a Walker which traverses the index depth-first, listing
+// up to 4 namespaces concurrently.
+func NewWalker(myIndex *Index) *Walker {
+	return &Walker{
+		Index:       myIndex,
+		Order:       DepthFirst,
+		Concurrency: 4,
+	}
+}
+
+// walk holds the state of a single call to Walker.Walk
+type walk struct {
+	walker *Walker
+	ctx    context.Context
+	cancel context.CancelFunc
+	// protects the fields below
+	mutex sync.Mutex
+	// signalled when frontier grows, or when pending reaches 0
+	cond *sync.Cond
+	// namespaces still to be visited, nil being the root namespace
+	frontier []*IndexedNamespace
+	root     string
+	// namespaces in frontier, or being listed
+	pending int
+	err     error
+	// serialises visitor calls
+	visit sync.Mutex
+}
+
+// Walk traverses the subtree below namespace, returning the first error
+// returned by a visitor, or encountered listing a namespace. The walk also
+// ends if ctx is done.
+func (walker *Walker) Walk(ctx context.Context, namespace string) error {
+	w := &walk{
+		walker:   walker,
+		frontier: []*IndexedNamespace{nil},
+		root:     namespace,
+		pending:  1,
+	}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	defer w.cancel()
+	w.cond = sync.NewCond(&w.mutex)
+	concurrency := walker.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				ns, ok := w.next()
+				if !ok {
+					return
+				}
+				children, err := w.list(ns)
+				w.done(children, err)
+			}
+		}()
+	}
+	workers.Wait()
+	return w.err
+}
+
+// next returns the next namespace to visit, or false if the walk is over
+func (w *walk) next() (*IndexedNamespace, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for len(w.frontier) == 0 && w.pending > 0 && w.err == nil {
+		w.cond.Wait()
+	}
+	if w.pending == 0 || w.err != nil {
+		return nil, false
+	}
+	var ns *IndexedNamespace
+	if w.walker.Order == BreadthFirst {
+		ns, w.frontier = w.frontier[0], w.frontier[1:]
+	} else {
+		ns, w.frontier = w.frontier[len(w.frontier)-1], w.frontier[:len(w.frontier)-1]
+	}
+	return ns, true
+}
+
+// done records that a namespace has been visited, adding its children to
+// the frontier
+func (w *walk) done(children []*IndexedNamespace, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err != nil && w.err == nil {
+		w.err = err
+		w.cancel()
+	}
+	if w.walker.Order == BreadthFirst {
+		w.frontier = append(w.frontier, children...)
+	} else {
+		// reversed, so that the first child is visited first
+		for i := len(children) - 1; i >= 0; i-- {
+			w.frontier = append(w.frontier, children[i])
+		}
+	}
+	w.pending += len(children) - 1
+	w.cond.Broadcast()
+}
+
+// list visits ns (unless it is the root namespace) and its tasks, and
+// returns its child namespaces
+func (w *walk) list(ns *IndexedNamespace) ([]*IndexedNamespace, error) {
+	namespace := w.root
+	if ns != nil {
+		namespace = ns.Namespace
+		if visit := w.walker.VisitNamespace; visit != nil {
+			switch err := w.call(func() error { return visit(ns) }); err {
+			case nil:
+			case SkipNamespace:
+				return nil, nil
+			default:
+				return nil, err
+			}
+		}
+	}
+	children := []*IndexedNamespace{}
+	namespaces := w.walker.Index.ListNamespacesIterator(w.ctx, namespace, nil, 0)
+	for namespaces.Next() {
+		for i := range namespaces.Page().Namespaces {
+			var child IndexedNamespace = namespaces.Page().Namespaces[i]
+			children = append(children, &child)
+		}
+	}
+	if err := namespaces.Err(); err != nil {
+		return nil, err
+	}
+	visit := w.walker.VisitTask
+	if visit == nil {
+		return children, nil
+	}
+	tasks := w.walker.Index.ListTasksIterator(w.ctx, namespace, nil, 0)
+	for tasks.Next() {
+		for i := range tasks.Page().Tasks {
+			var task IndexedTask = tasks.Page().Tasks[i]
+			if err := w.call(func() error { return visit(&task) }); err != nil && err != SkipTask {
+				return nil, err
+			}
+		}
+	}
+	return children, tasks.Err()
+}
+
+// call calls visitor, unless the walk has already ended
+func (w *walk) call(visitor func() error) error {
+	w.visit.Lock()
+	defer w.visit.Unlock()
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	return visitor()
+}
+
+// exportLine is a line of the JSON Lines export, describing either a
+// namespace or an indexed task
+type exportLine struct {
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name,omitempty"`
+	TaskId    string          `json:"taskId,omitempty"`
+	Rank      *int            `json:"rank,omitempty"`
+	Expires   Time            `json:"expires"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// Export walks the subtree below namespace, writing each namespace and
+// indexed task to out as a line of JSON (see http://jsonlines.org/), e.g.
+//
+//	{"kind":"namespace","namespace":"buildbot.branches.mozilla-central","name":"mozilla-central","expires":"2016-11-04T17:54:20.000Z"}
+//	{"kind":"task","namespace":"buildbot.branches.mozilla-central.linux","taskId":"Gu3BJf0IQeuJE-HFKtYI2A","rank":1446659660,"expires":"2016-11-04T17:54:20.000Z","data":{}}
+//
+// VisitNamespace and VisitTask, if set, are called before each line is
+// written, and can be used to filter the export: a namespace is only
+// exported if VisitNamespace returns nil, and a task is only exported if
+// VisitTask returns nil. VisitNamespace can return SkipNamespace to leave
+// out a namespace and its subtree, and VisitTask can return SkipTask to
+// leave out a task, without ending the export.
+func (walker *Walker) Export(ctx context.Context, namespace string, out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	w := *walker
+	w.VisitNamespace = func(ns *IndexedNamespace) error {
+		if walker.VisitNamespace != nil {
+			if err := walker.VisitNamespace(ns); err != nil {
+				return err
+			}
+		}
+		return encoder.Encode(&exportLine{
+			Kind:      "namespace",
+			Namespace: ns.Namespace,
+			Name:      ns.Name,
+			Expires:   ns.Expires,
+		})
+	}
+	w.VisitTask = func(task *IndexedTask) error {
+		if walker.VisitTask != nil {
+			switch err := walker.VisitTask(task); err {
+			case nil:
+			case SkipTask:
+				return nil
+			default:
+				return err
+			}
+		}
+		return encoder.Encode(&exportLine{
+			Kind:      "task",
+			Namespace: task.Namespace,
+			TaskId:    task.TaskId,
+			Rank:      &task.Rank,
+			Expires:   task.Expires,
+			Data:      task.Data,
+		})
+	}
+	return w.Walk(ctx, namespace)
+}
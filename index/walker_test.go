@@ -0,0 +1,155 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// fakeTree serves the namespace tree:
+//
+//	root
+//	├── a
+//	│   ├── a.x (task tx)
+//	│   └── a.y
+//	└── b (task tb)
+func fakeTree(t *testing.T) *httptest.Server {
+	children := map[string][]string{
+		"root":   {"root.a", "root.b"},
+		"root.a": {"root.a.x", "root.a.y"},
+	}
+	tasks := map[string][]string{
+		"root.a.x": {"tx"},
+		"root.b":   {"tb"},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.SplitN(r.URL.Path, "/", 3)
+		switch parts[1] {
+		case "namespaces":
+			resp := `{"namespaces": [`
+			for i, ns := range children[parts[2]] {
+				if i > 0 {
+					resp += ","
+				}
+				resp += `{"namespace": "` + ns + `", "name": "` + ns[strings.LastIndex(ns, ".")+1:] + `", "expires": "2016-11-04T17:54:20.000Z"}`
+			}
+			w.Write([]byte(resp + `]}`))
+		case "tasks":
+			resp := `{"tasks": [`
+			for i, taskId := range tasks[parts[2]] {
+				if i > 0 {
+					resp += ","
+				}
+				resp += `{"namespace": "` + parts[2] + `", "taskId": "` + taskId + `", "rank": 7, "data": {"x": 1}, "expires": "2016-11-04T17:54:20.000Z"}`
+			}
+			w.Write([]byte(resp + `]}`))
+		default:
+			t.Errorf("Unexpected request %v", r.URL.Path)
+		}
+	}))
+}
+
+func walkOrder(t *testing.T, order Order, concurrency int) string {
+	server := fakeTree(t)
+	defer server.Close()
+	myIndex := New("", "")
+	myIndex.BaseURL = server.URL
+	walker := NewWalker(myIndex)
+	walker.Order = order
+	walker.Concurrency = concurrency
+	visited := []string{}
+	walker.VisitNamespace = func(ns *IndexedNamespace) error {
+		visited = append(visited, ns.Namespace)
+		return nil
+	}
+	walker.VisitTask = func(task *IndexedTask) error {
+		visited = append(visited, task.TaskId)
+		return nil
+	}
+	if err := walker.Walk(context.Background(), "root"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return strings.Join(visited, " ")
+}
+
+func TestWalkOrder(t *testing.T) {
+	if order := walkOrder(t, DepthFirst, 1); order != "root.a root.a.x tx root.a.y root.b tb" {
+		t.Errorf("Unexpected depth-first order: %v", order)
+	}
+	if order := walkOrder(t, BreadthFirst, 1); order != "root.a root.b tb root.a.x tx root.a.y" {
+		t.Errorf("Unexpected breadth-first order: %v", order)
+	}
+	if order := walkOrder(t, DepthFirst, 3); len(strings.Fields(order)) != 6 {
+		t.Errorf("Expected 6 visits with concurrency, but got: %v", order)
+	}
+}
+
+func TestWalkSkipAndFail(t *testing.T) {
+	server := fakeTree(t)
+	defer server.Close()
+	myIndex := New("", "")
+	myIndex.BaseURL = server.URL
+	walker := NewWalker(myIndex)
+
+	failure := errors.New("failed")
+	walker.VisitNamespace = func(ns *IndexedNamespace) error {
+		if ns.Namespace == "root.a" {
+			return SkipNamespace
+		}
+		return nil
+	}
+	walker.VisitTask = func(task *IndexedTask) error {
+		if task.TaskId == "tx" {
+			t.Errorf("Task tx should have been skipped")
+		}
+		return failure
+	}
+	if err := walker.Walk(context.Background(), "root"); err != failure {
+		t.Errorf("Expected visitor error, but got %v", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	server := fakeTree(t)
+	defer server.Close()
+	myIndex := New("", "")
+	myIndex.BaseURL = server.URL
+	walker := NewWalker(myIndex)
+	walker.Concurrency = 1
+	walker.VisitNamespace = func(ns *IndexedNamespace) error {
+		if ns.Name == "y" {
+			return SkipNamespace
+		}
+		return nil
+	}
+	walker.VisitTask = func(task *IndexedTask) error {
+		if task.TaskId == "tb" {
+			return SkipTask
+		}
+		return nil
+	}
+
+	var out bytes.Buffer
+	if err := walker.Export(context.Background(), "root", &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[3], `"namespace":"root.b"`) {
+		t.Fatalf("Expected 4 lines, ending with namespace root.b, but got:\n%v", out.String())
+	}
+	if lines[2] != `{"kind":"task","namespace":"root.a.x","taskId":"tx","rank":7,"expires":"2016-11-04T17:54:20.000Z","data":{"x":1}}` {
+		t.Errorf("Unexpected task line: %v", lines[2])
+	}
+	for _, line := range lines {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			t.Errorf("Invalid json line %v: %v", line, err)
+		}
+	}
+}
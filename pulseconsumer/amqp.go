@@ -0,0 +1,75 @@
+package pulseconsumer
+
+import (
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/pulse-go/pulse"
+	"github.com/taskcluster/slugid-go/slugid"
+)
+
+// AMQP returns a Dialer which connects to the pulse (AMQP) broker at url,
+// e.g. amqps://<user>:<password>@pulse.mozilla.org:5671. As pulse requires,
+// queues are named queue/<user>/<queueName>, where an anonymous queue gets
+// a random name. Named queues are durable, while anonymous queues are
+// exclusive to their connection, and deleted when it is closed.
+func AMQP(url string) Dialer {
+	return func() (Connection, error) {
+		uri, err := amqp.ParseURI(url)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := amqp.Dial(url)
+		if err != nil {
+			return nil, err
+		}
+		return &amqpConnection{conn: conn, user: uri.Username}, nil
+	}
+}
+
+// amqpConnection is a Connection to an AMQP broker
+type amqpConnection struct {
+	conn *amqp.Connection
+	user string
+}
+
+func (c *amqpConnection) Consume(queueName string, prefetch int, bindings []pulse.Binding) (<-chan amqp.Delivery, error) {
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		return nil, err
+	}
+	durable := queueName != ""
+	if !durable {
+		queueName = slugid.Nice()
+	}
+	q, err := ch.QueueDeclare(
+		"queue/"+c.user+"/"+queueName,
+		durable,  // durable
+		!durable, // delete when unused
+		!durable, // exclusive
+		false,    // no-wait
+		nil,      // arguments
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, binding := range bindings {
+		if err := ch.QueueBind(q.Name, binding.RoutingKey(), binding.ExchangeName(), false, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ch.Consume(
+		q.Name,
+		"",    // consumer tag, generated by the broker
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // arguments
+	)
+}
+
+func (c *amqpConnection) Close() error {
+	return c.conn.Close()
+}
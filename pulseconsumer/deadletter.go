@@ -0,0 +1,133 @@
+package pulseconsumer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// DeadLetter is a message which could not be handled, with the metadata of
+// its delivery.
+type DeadLetter struct {
+	// Queue the message was consumed from (empty for an anonymous queue)
+	Queue string `json:"queue"`
+	// Exchange the message was published to
+	Exchange string `json:"exchange"`
+	// Primary routing key of the message
+	RoutingKey string `json:"routingKey"`
+	// Routing keys the message was CC'ed to, e.g. task specific routes
+	// such as `route.notify.by-email`
+	CC []string `json:"cc"`
+	// Whether the message had been delivered before
+	Redelivered bool       `json:"redelivered"`
+	ContentType string     `json:"contentType"`
+	MessageId   string     `json:"messageId"`
+	Timestamp   time.Time  `json:"timestamp"`
+	Headers     amqp.Table `json:"headers"`
+	// The message body, or the body as a json string if it is not valid
+	// json
+	Body json.RawMessage `json:"body"`
+	// Number of times handling the message was attempted
+	Attempts int `json:"attempts"`
+	// The error of each attempt
+	Errors []string `json:"errors"`
+	// When the message was dead-lettered
+	DeadLettered time.Time `json:"deadLettered"`
+}
+
+// newDeadLetter returns the DeadLetter for delivery from queue, which failed
+// to be handled with the given errors
+func newDeadLetter(queue string, delivery amqp.Delivery, errs []string) *DeadLetter {
+	d := &DeadLetter{
+		Queue:        queue,
+		Exchange:     delivery.Exchange,
+		RoutingKey:   delivery.RoutingKey,
+		CC:           []string{},
+		Redelivered:  delivery.Redelivered,
+		ContentType:  delivery.ContentType,
+		MessageId:    delivery.MessageId,
+		Timestamp:    delivery.Timestamp,
+		Headers:      delivery.Headers,
+		Body:         json.RawMessage(delivery.Body),
+		Attempts:     len(errs),
+		Errors:       errs,
+		DeadLettered: time.Now(),
+	}
+	cc, _ := delivery.Headers["CC"].([]interface{})
+	for _, key := range cc {
+		if k, ok := key.(string); ok {
+			d.CC = append(d.CC, k)
+		}
+	}
+	var v interface{}
+	if json.Unmarshal(delivery.Body, &v) != nil {
+		d.Body, _ = json.Marshal(string(delivery.Body))
+	}
+	return d
+}
+
+// DeadLetterSink receives the messages which a Supervisor could not handle.
+// If DeadLetter returns an error, the message is requeued instead.
+type DeadLetterSink interface {
+	DeadLetter(d *DeadLetter) error
+}
+
+// SinkFunc is a DeadLetterSink which calls the function.
+type SinkFunc func(d *DeadLetter) error
+
+func (f SinkFunc) DeadLetter(d *DeadLetter) error {
+	return f(d)
+}
+
+// FileSink is a DeadLetterSink which appends dead letters to the file at
+// Path, as one json document per line. The file is created if it does not
+// exist.
+type FileSink struct {
+	Path string
+	// serializes writes to the file
+	mutex sync.Mutex
+}
+
+func (f *FileSink) DeadLetter(d *DeadLetter) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	file, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadDeadLetters returns the dead letters written to the file at path by
+// a FileSink, e.g. to inspect or republish them.
+func ReadDeadLetters(path string) ([]*DeadLetter, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	letters := []*DeadLetter{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		d := new(DeadLetter)
+		if err := json.Unmarshal([]byte(line), d); err != nil {
+			return nil, err
+		}
+		letters = append(letters, d)
+	}
+	return letters, nil
+}
@@ -0,0 +1,310 @@
+// Package pulseconsumer provides a Supervisor for long-running consumers of
+// pulse messages, such as those of the queueevents package, which survive
+// broker restarts and misbehaving messages.
+//
+// A Supervisor consumes from a queue with the given bindings, and when the
+// connection is lost, reconnects with an exponential backoff, re-declaring
+// the queue and its bindings. Named queues are durable, so no messages are
+// missed while reconnecting. Messages are handled by a bounded number of
+// concurrent handlers, and a message whose handler fails
+// Supervisor.MaxAttempts times is passed to the dead-letter sink, such as a
+// FileSink, together with the delivery metadata and handler errors, rather
+// than being retried forever. Messages which cannot be decoded, or whose
+// handler returns a permanent error, e.g. a *queueevents.PermanentError, are
+// dead-lettered at once.
+//
+// For example:
+//
+//	handlers := &queueevents.Handlers{
+//		TaskCompleted: func(message *queueevents.TaskCompletedMessage, delivery amqp.Delivery) error {
+//			// handle message...
+//		},
+//	}
+//	supervisor := pulseconsumer.New(
+//		pulseconsumer.AMQP("amqps://<user>:<password>@pulse.mozilla.org:5671"),
+//		"task-completions",
+//		handlers.Handle,
+//		queueevents.TaskCompleted{WorkerType: "gaia"},
+//	)
+//	supervisor.Concurrency = 10
+//	supervisor.DeadLetters = &pulseconsumer.FileSink{Path: "dead-letters.json"}
+//	err := supervisor.Run(context.Background())
+package pulseconsumer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/pulse-go/pulse"
+	D "github.com/tj/go-debug"
+	"golang.org/x/net/context"
+)
+
+var (
+	// Used for logging based on DEBUG environment variable
+	// See github.com/tj/go-debug
+	debug = D.Debug("pulseconsumer")
+
+	// ErrConnectionLost is passed to Supervisor.OnDisconnect when the
+	// deliveries of a connection stop.
+	ErrConnectionLost = errors.New("connection to pulse lost")
+)
+
+// Connection is a connection to a pulse (AMQP) broker, as used by a
+// Supervisor. Connections to a real broker are made by the Dialer returned
+// by AMQP.
+type Connection interface {
+	// Consume declares the queue with the given name, or an anonymous
+	// queue if queueName is empty, binds it with bindings, and returns its
+	// deliveries, which must be acknowledged. At most prefetch deliveries
+	// are unacknowledged at a time. The returned channel is closed when the
+	// connection is lost or closed.
+	Consume(queueName string, prefetch int, bindings []pulse.Binding) (<-chan amqp.Delivery, error)
+	// Close closes the connection.
+	Close() error
+}
+
+// Dialer connects to a pulse broker.
+type Dialer func() (Connection, error)
+
+// Handler handles a message delivered to a Supervisor, where message is the
+// body decoded into the payload object of the first binding for the
+// exchange of the message, or nil if there is no such binding. Messages
+// which cannot be decoded are dead-lettered without calling the Handler, as
+// are messages for which it returns a PermanentError whose Permanent method
+// returns true. The Handle method of the generated Handlers types of the
+// events packages, e.g. queueevents.Handlers, is a Handler.
+type Handler func(message interface{}, delivery amqp.Delivery) error
+
+// PermanentError is implemented by errors which know whether handling a
+// message would fail again, such as the PermanentError and DecodeError
+// types of the events packages, e.g. *queueevents.PermanentError. Only the
+// error returned by the Handler is checked, not errors it wraps.
+type PermanentError interface {
+	error
+	Permanent() bool
+}
+
+// Supervisor consumes messages from a queue, reconnecting when the
+// connection is lost. Create one with New, and adjust its parameters if
+// required, before calling Run.
+type Supervisor struct {
+	// Connects to the broker, initially and after the connection is lost
+	Dial Dialer
+	// Name of the queue, which is durable, so that it keeps its messages
+	// while disconnected. If empty, an anonymous queue is used, which does
+	// not.
+	QueueName string
+	// Bindings of the queue, which are re-declared on every connection
+	Bindings []pulse.Binding
+	// Handles the messages
+	Handler Handler
+	// Maximum number of messages handled concurrently
+	Concurrency int
+	// Number of times a message is handled before it is dead-lettered, if
+	// the handler keeps failing
+	MaxAttempts int
+	// Delay between attempts to handle a message
+	RetryDelay time.Duration
+	// Receives messages which could not be handled, before they are
+	// acknowledged. If nil, such messages are discarded.
+	DeadLetters DeadLetterSink
+	// Interval before reconnecting after the first failure
+	InitialInterval time.Duration
+	// Upper bound for the interval between reconnection attempts
+	MaxInterval time.Duration
+	// Factor by which the reconnection interval grows after each failed
+	// attempt
+	Multiplier float64
+	// Called, if not nil, whenever the supervisor has (re)connected
+	OnConnect func()
+	// Called, if not nil, with the reason whenever connecting fails or the
+	// connection is lost, before waiting to reconnect
+	OnDisconnect func(err error)
+}
+
+// New returns a Supervisor which consumes messages from the queue with the
+// given name, bound with bindings, and handles them with handler.
+func New(dial Dialer, queueName string, handler Handler, bindings ...pulse.Binding) *Supervisor {
+	return &Supervisor{
+		Dial:            dial,
+		QueueName:       queueName,
+		Bindings:        bindings,
+		Handler:         handler,
+		Concurrency:     1,
+		MaxAttempts:     3,
+		RetryDelay:      time.Second,
+		InitialInterval: time.Second,
+		MaxInterval:     time.Minute,
+		Multiplier:      2,
+	}
+}
+
+// Run consumes and handles messages until ctx is done, reconnecting
+// whenever connecting fails or the connection is lost. Messages which are
+// being handled when ctx is done are left unacknowledged, so that the
+// broker redelivers them. Run only returns an error if the bindings are
+// invalid.
+func (s *Supervisor) Run(ctx context.Context) error {
+	for _, binding := range s.Bindings {
+		if v, ok := binding.(interface {
+			Validate() error
+		}); ok {
+			if err := v.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	interval := s.InitialInterval
+	for {
+		connected, err := s.session(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if connected {
+			interval = s.InitialInterval
+		}
+		debug("Disconnected (%v), reconnecting in %v", err, interval)
+		if s.OnDisconnect != nil {
+			s.OnDisconnect(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+		interval = time.Duration(float64(interval) * s.Multiplier)
+		if interval > s.MaxInterval {
+			interval = s.MaxInterval
+		}
+	}
+}
+
+// session connects, and handles messages until the connection is lost or
+// ctx is done. It reports whether it connected, and why it ended.
+func (s *Supervisor) session(ctx context.Context) (bool, error) {
+	conn, err := s.Dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	concurrency := s.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	deliveries, err := conn.Consume(s.QueueName, concurrency, s.Bindings)
+	if err != nil {
+		return false, err
+	}
+	debug("Connected, consuming from queue %q", s.QueueName)
+	if s.OnConnect != nil {
+		s.OnConnect()
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range deliveries {
+				s.handle(ctx, delivery)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true, ErrConnectionLost
+	case <-ctx.Done():
+		// closing the connection closes deliveries, which stops the
+		// handlers once they have finished with their current messages
+		conn.Close()
+		<-done
+		return true, ctx.Err()
+	}
+}
+
+// handle handles delivery, retrying up to s.MaxAttempts times, and
+// dead-letters it if all attempts fail. A message which cannot be decoded,
+// or whose handler returns a permanent error, is dead-lettered without
+// retrying.
+func (s *Supervisor) handle(ctx context.Context, delivery amqp.Delivery) {
+	message, err := s.decode(delivery)
+	if err != nil {
+		debug("Could not decode message from %v with routing key %v: %v", delivery.Exchange, delivery.RoutingKey, err)
+		s.deadLetter(delivery, []string{err.Error()})
+		return
+	}
+	errs := []string{}
+	for attempt := 1; ; attempt++ {
+		err := s.call(message, delivery)
+		if err == nil {
+			delivery.Ack(false)
+			return
+		}
+		debug("Attempt %v to handle message from %v with routing key %v failed: %v", attempt, delivery.Exchange, delivery.RoutingKey, err)
+		errs = append(errs, err.Error())
+		if attempt >= s.MaxAttempts || permanent(err) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			// leave the message unacknowledged, for redelivery
+			return
+		case <-time.After(s.RetryDelay):
+		}
+	}
+	s.deadLetter(delivery, errs)
+}
+
+// deadLetter passes delivery to s.DeadLetters, if any, and acknowledges it,
+// or requeues it if it could not be dead-lettered
+func (s *Supervisor) deadLetter(delivery amqp.Delivery, errs []string) {
+	if s.DeadLetters != nil {
+		if err := s.DeadLetters.DeadLetter(newDeadLetter(s.QueueName, delivery, errs)); err != nil {
+			debug("Could not dead-letter message, requeueing it: %v", err)
+			delivery.Nack(false, true)
+			return
+		}
+	}
+	delivery.Ack(false)
+}
+
+// permanent reports whether err is a PermanentError which is permanent
+func permanent(err error) bool {
+	p, ok := err.(PermanentError)
+	return ok && p.Permanent()
+}
+
+// call calls s.Handler, turning a panic into an error
+func (s *Supervisor) call(message interface{}, delivery amqp.Delivery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return s.Handler(message, delivery)
+}
+
+// decode returns the body of delivery decoded into the payload object of
+// the first binding for its exchange, or nil if there is no such binding.
+// It returns an error if the body is malformed.
+func (s *Supervisor) decode(delivery amqp.Delivery) (interface{}, error) {
+	for _, binding := range s.Bindings {
+		if binding.ExchangeName() == delivery.Exchange {
+			payload := binding.NewPayloadObject()
+			if err := json.Unmarshal(delivery.Body, payload); err != nil {
+				return nil, fmt.Errorf("could not decode message from exchange %v: %v", delivery.Exchange, err)
+			}
+			return payload, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,363 @@
+package pulseconsumer
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/pulse-go/pulse"
+	"github.com/taskcluster/taskcluster-client-go/pulsetest"
+	"github.com/taskcluster/taskcluster-client-go/queueevents"
+	"golang.org/x/net/context"
+)
+
+// testConn is a Connection to a pulsetest.Broker, which can be dropped to
+// simulate a broker restart
+type testConn struct {
+	broker     *pulsetest.Broker
+	queue      *pulsetest.Queue
+	deliveries chan amqp.Delivery
+	// protects closed, and sending to deliveries
+	mutex  sync.Mutex
+	closed bool
+}
+
+func (c *testConn) Consume(queueName string, prefetch int, bindings []pulse.Binding) (<-chan amqp.Delivery, error) {
+	c.deliveries = make(chan amqp.Delivery)
+	q, err := c.broker.Consume(queueName, c.deliver, prefetch, false, bindings...)
+	if err != nil {
+		return nil, err
+	}
+	c.queue = q
+	return c.deliveries, nil
+}
+
+func (c *testConn) deliver(message interface{}, delivery amqp.Delivery) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.closed {
+		c.deliveries <- delivery
+	}
+}
+
+func (c *testConn) Close() error {
+	if c.queue != nil {
+		c.queue.Cancel()
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.closed && c.deliveries != nil {
+		close(c.deliveries)
+	}
+	c.closed = true
+	return nil
+}
+
+// testBroker dials testConns to a pulsetest.Broker, failing while fail is
+// positive
+type testBroker struct {
+	*pulsetest.Broker
+	mutex sync.Mutex
+	conns []*testConn
+	fail  int
+}
+
+func (b *testBroker) dial() (Connection, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.fail > 0 {
+		b.fail--
+		return nil, errors.New("connection refused")
+	}
+	c := &testConn{broker: b.Broker}
+	b.conns = append(b.conns, c)
+	return c, nil
+}
+
+// restart drops all connections
+func (b *testBroker) restart() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, c := range b.conns {
+		c.Close()
+	}
+}
+
+func newTestSupervisor(b *testBroker, handler Handler) *Supervisor {
+	s := New(b.dial, "test", handler, queueevents.TaskCompleted{WorkerType: "gaia"})
+	s.RetryDelay = time.Millisecond
+	s.InitialInterval = time.Millisecond
+	s.MaxInterval = 10 * time.Millisecond
+	return s
+}
+
+func publish(t *testing.T, b *testBroker, taskId string, routes ...string) {
+	binding := queueevents.TaskCompleted{TaskId: taskId, RunId: "0", WorkerGroup: "wg", WorkerId: "w", ProvisionerId: "p", WorkerType: "gaia", SchedulerId: "-", TaskGroupId: taskId}
+	if err := b.PublishMessage(binding, &queueevents.TaskCompletedMessage{Version: 1, WorkerId: taskId}, routes...); err != nil {
+		t.Fatalf("Could not publish message: %v", err)
+	}
+}
+
+// run runs s until the returned function is called, returning once s has
+// connected
+func run(t *testing.T, s *Supervisor) func() {
+	connected := make(chan bool, 1)
+	onConnect := s.OnConnect
+	s.OnConnect = func() {
+		if onConnect != nil {
+			onConnect()
+		}
+		select {
+		case connected <- true:
+		default:
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+	<-connected
+	return func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Unexpected error from Run: %v", err)
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	b := &testBroker{Broker: pulsetest.NewBroker(), fail: 2}
+	handled := make(chan string, 10)
+	s := newTestSupervisor(b, func(message interface{}, delivery amqp.Delivery) error {
+		handled <- message.(*queueevents.TaskCompletedMessage).WorkerId
+		return nil
+	})
+	connected := make(chan bool, 10)
+	s.OnConnect = func() {
+		connected <- true
+	}
+	disconnects := make(chan error, 10)
+	s.OnDisconnect = func(err error) {
+		disconnects <- err
+	}
+	stop := run(t, s)
+	defer stop()
+
+	<-connected
+	if n := len(disconnects); n != 2 {
+		t.Errorf("Expected 2 failed connection attempts, but got %v", n)
+	}
+	publish(t, b, "task1")
+	if id := <-handled; id != "task1" {
+		t.Errorf("Expected task1 to be handled, but got %v", id)
+	}
+
+	b.restart()
+	// the named queue keeps messages published while reconnecting
+	publish(t, b, "task2")
+	<-connected
+	if id := <-handled; id != "task2" {
+		t.Errorf("Expected task2 to be handled after reconnecting, but got %v", id)
+	}
+	if err := b.Queue("test").WaitIdle(time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pulseconsumer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dead-letters.json")
+
+	b := &testBroker{Broker: pulsetest.NewBroker()}
+	var mutex sync.Mutex
+	attempts := map[string]int{}
+	// receives a value for each message handled successfully or
+	// dead-lettered
+	finished := make(chan bool, 3)
+	s := newTestSupervisor(b, func(message interface{}, delivery amqp.Delivery) error {
+		m := message.(*queueevents.TaskCompletedMessage)
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts[m.WorkerId]++
+		if m.WorkerId == "bad" {
+			return errors.New("database unavailable")
+		}
+		if m.WorkerId == "panic" {
+			panic("oops")
+		}
+		finished <- true
+		return nil
+	})
+	s.MaxAttempts = 3
+	sink := &FileSink{Path: path}
+	s.DeadLetters = SinkFunc(func(d *DeadLetter) error {
+		defer func() { finished <- true }()
+		return sink.DeadLetter(d)
+	})
+	stop := run(t, s)
+	publish(t, b, "bad", "notify.by-email")
+	publish(t, b, "good")
+	publish(t, b, "panic")
+	for i := 0; i < 3; i++ {
+		<-finished
+	}
+	if err := b.Queue("test").WaitIdle(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	if attempts["bad"] != 3 || attempts["panic"] != 3 || attempts["good"] != 1 {
+		t.Errorf("Expected failing messages to be attempted 3 times, and others once, but got %v", attempts)
+	}
+	letters, err := ReadDeadLetters(path)
+	if err != nil {
+		t.Fatalf("Could not read dead letters: %v", err)
+	}
+	if len(letters) != 2 {
+		t.Fatalf("Expected 2 dead letters, but got %v", len(letters))
+	}
+	d := letters[0]
+	if d.Queue != "test" || d.Exchange != "exchange/taskcluster-queue/v1/task-completed" || !strings.HasPrefix(d.RoutingKey, "primary.bad.") {
+		t.Errorf("Dead letter has wrong delivery metadata: %#v", d)
+	}
+	if len(d.CC) != 1 || d.CC[0] != "route.notify.by-email" {
+		t.Errorf("Expected dead letter to be CC'ed to route.notify.by-email, but got %v", d.CC)
+	}
+	if d.Attempts != 3 || len(d.Errors) != 3 || d.Errors[0] != "database unavailable" {
+		t.Errorf("Dead letter has wrong attempts %v or errors %v", d.Attempts, d.Errors)
+	}
+	if !strings.Contains(string(d.Body), `"workerId":"bad"`) {
+		t.Errorf("Dead letter has wrong body %s", d.Body)
+	}
+	if e := letters[1].Errors[0]; e != "handler panicked: oops" {
+		t.Errorf("Expected panic to be reported as error, but got %v", e)
+	}
+	if n := len(b.Queue("test").Discarded()); n != 0 {
+		t.Errorf("Expected dead-lettered messages to be acknowledged, but %v were discarded", n)
+	}
+}
+
+func TestDeadLetterSinkFailure(t *testing.T) {
+	b := &testBroker{Broker: pulsetest.NewBroker()}
+	s := newTestSupervisor(b, func(message interface{}, delivery amqp.Delivery) error {
+		return errors.New("always fails")
+	})
+	letters := make(chan *DeadLetter, 10)
+	fail := true
+	s.DeadLetters = SinkFunc(func(d *DeadLetter) error {
+		if fail {
+			fail = false
+			return errors.New("disk full")
+		}
+		letters <- d
+		return nil
+	})
+	stop := run(t, s)
+	defer stop()
+	publish(t, b, "task1")
+	// the message is requeued, so dead-lettered on the second delivery
+	if d := <-letters; !d.Redelivered {
+		t.Errorf("Expected message to be requeued when dead-lettering fails")
+	}
+}
+
+func TestPermanentErrors(t *testing.T) {
+	b := &testBroker{Broker: pulsetest.NewBroker()}
+	var mutex sync.Mutex
+	attempts := map[string]int{}
+	s := newTestSupervisor(b, func(message interface{}, delivery amqp.Delivery) error {
+		m := message.(*queueevents.TaskCompletedMessage)
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts[m.WorkerId]++
+		return &queueevents.PermanentError{Err: errors.New("task is malformed")}
+	})
+	s.MaxAttempts = 3
+	letters := make(chan *DeadLetter, 2)
+	s.DeadLetters = SinkFunc(func(d *DeadLetter) error {
+		letters <- d
+		return nil
+	})
+	stop := run(t, s)
+	defer stop()
+	publish(t, b, "permanent")
+	d := <-letters
+	if d.Attempts != 1 || d.Errors[0] != "task is malformed" {
+		t.Errorf("Expected permanent error to be dead-lettered after 1 attempt, but got %v attempts with errors %v", d.Attempts, d.Errors)
+	}
+	binding := queueevents.TaskCompleted{TaskId: "task", RunId: "0", WorkerGroup: "wg", WorkerId: "w", ProvisionerId: "p", WorkerType: "gaia", SchedulerId: "-", TaskGroupId: "task"}
+	if err := b.PublishMessage(binding, json.RawMessage(`{"version": "one"}`)); err != nil {
+		t.Fatalf("Could not publish message: %v", err)
+	}
+	d = <-letters
+	if d.Attempts != 1 || !strings.Contains(d.Errors[0], "could not decode message") {
+		t.Errorf("Expected malformed message to be dead-lettered without handling it, but got %v attempts with errors %v", d.Attempts, d.Errors)
+	}
+	if err := b.Queue("test").WaitIdle(time.Second); err != nil {
+		t.Error(err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if attempts["permanent"] != 1 || len(attempts) != 1 {
+		t.Errorf("Expected only the permanent failure to be handled, once, but got %v", attempts)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	b := &testBroker{Broker: pulsetest.NewBroker()}
+	var mutex sync.Mutex
+	running, max, total := 0, 0, 0
+	handled := make(chan bool, 12)
+	s := newTestSupervisor(b, func(message interface{}, delivery amqp.Delivery) error {
+		mutex.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mutex.Lock()
+		running--
+		total++
+		mutex.Unlock()
+		handled <- true
+		return nil
+	})
+	s.Concurrency = 3
+	stop := run(t, s)
+	for i := 0; i < 12; i++ {
+		publish(t, b, "task")
+	}
+	for i := 0; i < 12; i++ {
+		<-handled
+	}
+	if err := b.Queue("test").WaitIdle(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if total != 12 || max != 3 {
+		t.Errorf("Expected 12 messages to be handled, at most 3 concurrently, but %v were handled, up to %v concurrently", total, max)
+	}
+}
+
+func TestInvalidBindings(t *testing.T) {
+	b := &testBroker{Broker: pulsetest.NewBroker()}
+	s := New(b.dial, "test", nil, queueevents.TaskCompleted{WorkerType: "a.b"})
+	if err := s.Run(context.Background()); err == nil {
+		t.Error("Expected invalid binding to be reported")
+	}
+}
@@ -0,0 +1,436 @@
+// Package pulsetest provides an in-memory stand-in for a Pulse (AMQP)
+// broker, so that code consuming TaskCluster events, e.g. with the bindings
+// of package queueevents, can be tested without a live Pulse or RabbitMQ.
+//
+// Messages are routed with topic exchange semantics: a binding's routing key
+// pattern matches a message's routing key word by word, where `*` matches
+// exactly one word and `#` matches zero or more words. Messages are also
+// routed by their CC'ed routing keys, e.g. `route.<route>` for task specific
+// routes, and are delivered at most once per queue.
+//
+// Consume has the same shape as pulse.Connection.Consume, so the callbacks
+// under test are called just as they would be by the pulse package. For
+// example:
+//
+//	broker := pulsetest.NewBroker()
+//	handlers := &queueevents.Handlers{
+//		TaskCompleted: func(message *queueevents.TaskCompletedMessage, delivery amqp.Delivery) error {
+//			...
+//		},
+//	}
+//	queue, err := broker.Consume("my-queue", handlers.Callback(), 1, false, queueevents.TaskCompleted{WorkerType: "gaia"})
+//	...
+//	err = broker.PublishMessage(queueevents.TaskCompleted{TaskId: taskId, ..., WorkerType: "gaia"}, &queueevents.TaskCompletedMessage{...})
+//	...
+//	err = queue.WaitIdle(time.Second)
+//
+// Broker also implements the Publisher interface of the events packages, so
+// messages can be published with their generated Publish functions, e.g.
+// queueevents.PublishTaskCompleted(broker, binding, message), which check
+// the messages against the schemas of their exchanges.
+package pulsetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/pulse-go/pulse"
+)
+
+// Broker is an in-memory topic exchange broker. Exchanges need not be
+// declared; publishing to any exchange routes the message to the queues
+// bound to it.
+type Broker struct {
+	// protects the fields below
+	mutex  sync.Mutex
+	queues map[string]*Queue
+	// for naming anonymous queues
+	anonymous int
+}
+
+// NewBroker returns a Broker without any queues.
+func NewBroker() *Broker {
+	return &Broker{
+		queues: map[string]*Queue{},
+	}
+}
+
+// Queue is a queue of a Broker, with a single consumer.
+type Queue struct {
+	Name   string
+	broker *Broker
+	// protects the fields below
+	mutex sync.Mutex
+	// signalled when any of the fields below change
+	cond      *sync.Cond
+	bindings  []pulse.Binding
+	callback  func(interface{}, amqp.Delivery)
+	prefetch  int
+	autoAck   bool
+	ready     []amqp.Delivery
+	unacked   map[uint64]amqp.Delivery
+	discarded []amqp.Delivery
+	tag       uint64
+	busy      bool
+	// incremented whenever a consumer starts or is cancelled, so that the
+	// goroutine of a cancelled consumer knows to stop
+	consumer int
+}
+
+// Consume declares a queue with the given bindings, and calls callback for
+// each message routed to it, one at a time, in a separate goroutine. The
+// message passed to callback is the body decoded into the NewPayloadObject
+// of the first binding for the exchange of the message, or nil if the body
+// cannot be decoded.
+//
+// An empty queueName creates an anonymous queue, which is deleted when the
+// consumer is cancelled. A named queue keeps its messages while it has no
+// consumer, and consuming from it again adds any new bindings.
+//
+// Unless autoAck is true, messages must be acknowledged through the
+// delivery, and at most prefetch unacknowledged messages (if prefetch > 0)
+// are delivered at a time. Bindings with a Validate method (such as the
+// generated bindings) are validated first.
+func (broker *Broker) Consume(queueName string, callback func(interface{}, amqp.Delivery), prefetch int, autoAck bool, bindings ...pulse.Binding) (*Queue, error) {
+	for _, binding := range bindings {
+		if v, ok := binding.(interface {
+			Validate() error
+		}); ok {
+			if err := v.Validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	if queueName == "" {
+		broker.anonymous++
+		queueName = "anonymous-" + strconv.Itoa(broker.anonymous)
+	}
+	q := broker.queues[queueName]
+	if q == nil {
+		q = &Queue{
+			Name:    queueName,
+			broker:  broker,
+			unacked: map[uint64]amqp.Delivery{},
+		}
+		q.cond = sync.NewCond(&q.mutex)
+		broker.queues[queueName] = q
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.callback != nil {
+		return nil, fmt.Errorf("queue %v already has a consumer", queueName)
+	}
+	q.bindings = append(q.bindings, bindings...)
+	q.callback = callback
+	q.prefetch = prefetch
+	q.autoAck = autoAck
+	q.consumer++
+	go q.consume(q.consumer, callback)
+	return q, nil
+}
+
+// Queue returns the queue with the given name, or nil if there is none.
+func (broker *Broker) Queue(name string) *Queue {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	return broker.queues[name]
+}
+
+// Publish publishes body to exchange with the given routing key, CC'ed to
+// the cc routing keys, e.g. `route.notify.by-email`.
+func (broker *Broker) Publish(exchange, routingKey string, cc []string, body []byte) error {
+	if exchange == "" {
+		return errors.New("cannot publish to an unnamed exchange")
+	}
+	for _, key := range append([]string{routingKey}, cc...) {
+		if key == "" || strings.ContainsAny(key, "*#") {
+			return fmt.Errorf("cannot publish with routing key %q", key)
+		}
+	}
+	delivery := amqp.Delivery{
+		ContentType: "application/json",
+		Exchange:    exchange,
+		RoutingKey:  routingKey,
+		Body:        body,
+		Timestamp:   time.Now(),
+	}
+	if len(cc) > 0 {
+		header := make([]interface{}, len(cc))
+		for i, key := range cc {
+			header[i] = key
+		}
+		delivery.Headers = amqp.Table{"CC": header}
+	}
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	for _, q := range broker.queues {
+		q.route(delivery, append([]string{routingKey}, cc...))
+	}
+	return nil
+}
+
+// PublishMessage publishes message, e.g. a *queueevents.TaskCompletedMessage,
+// to the exchange of binding, e.g. a queueevents.TaskCompleted with the
+// routing key fields of the message set. Empty fields, which would be
+// wildcards in a binding, are published as `_`, as the TaskCluster services
+// do for values that are not present. The message is also CC'ed to
+// `route.<route>` for each of the given task specific routes.
+func (broker *Broker) PublishMessage(binding pulse.Binding, message interface{}, routes ...string) error {
+	if v, ok := binding.(interface {
+		Validate() error
+	}); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	routingKey := binding.RoutingKey()
+	if strings.HasPrefix(routingKey, "route.") {
+		return fmt.Errorf("cannot publish to CC'ed routing key %v; pass routes instead", routingKey)
+	}
+	words := strings.Split(routingKey, ".")
+	for i, word := range words {
+		if word == "*" || word == "#" {
+			words[i] = "_"
+		}
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	cc := make([]string, len(routes))
+	for i, route := range routes {
+		cc[i] = "route." + route
+	}
+	return broker.Publish(binding.ExchangeName(), strings.Join(words, "."), cc, body)
+}
+
+// route enqueues delivery if any of the given routing keys match a binding
+func (q *Queue) route(delivery amqp.Delivery, keys []string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, binding := range q.bindings {
+		if binding.ExchangeName() != delivery.Exchange {
+			continue
+		}
+		for _, key := range keys {
+			if Match(binding.RoutingKey(), key) {
+				q.ready = append(q.ready, delivery)
+				q.cond.Broadcast()
+				return
+			}
+		}
+	}
+}
+
+// Match reports whether routingKey matches the topic exchange routing key
+// pattern, where `*` matches exactly one word and `#` matches zero or more
+// words.
+func Match(pattern, routingKey string) bool {
+	return match(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func match(pattern, words []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			for i := 0; i <= len(words); i++ {
+				if match(pattern[1:], words[i:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(words) == 0 {
+				return false
+			}
+		default:
+			if len(words) == 0 || words[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, words = pattern[1:], words[1:]
+	}
+	return len(words) == 0
+}
+
+// consume delivers messages to callback until consumer is cancelled
+func (q *Queue) consume(consumer int, callback func(interface{}, amqp.Delivery)) {
+	for {
+		q.mutex.Lock()
+		for q.consumer == consumer && (len(q.ready) == 0 || !q.autoAck && q.prefetch > 0 && len(q.unacked) >= q.prefetch) {
+			q.cond.Wait()
+		}
+		if q.consumer != consumer {
+			q.mutex.Unlock()
+			return
+		}
+		delivery := q.ready[0]
+		q.ready = q.ready[1:]
+		q.tag++
+		delivery.DeliveryTag = q.tag
+		delivery.Acknowledger = q
+		delivery.ConsumerTag = q.Name
+		if !q.autoAck {
+			q.unacked[q.tag] = delivery
+		}
+		q.busy = true
+		q.mutex.Unlock()
+
+		callback(q.decode(delivery), delivery)
+
+		q.mutex.Lock()
+		q.busy = false
+		q.cond.Broadcast()
+		q.mutex.Unlock()
+	}
+}
+
+// decode returns the body of delivery decoded into the payload object of
+// the first binding for its exchange, or nil
+func (q *Queue) decode(delivery amqp.Delivery) interface{} {
+	q.mutex.Lock()
+	bindings := q.bindings
+	q.mutex.Unlock()
+	for _, binding := range bindings {
+		if binding.ExchangeName() == delivery.Exchange {
+			payload := binding.NewPayloadObject()
+			if err := json.Unmarshal(delivery.Body, payload); err != nil {
+				return nil
+			}
+			return payload
+		}
+	}
+	return nil
+}
+
+// Ack implements amqp.Acknowledger.
+func (q *Queue) Ack(tag uint64, multiple bool) error {
+	return q.settle(tag, multiple, func(delivery amqp.Delivery) {})
+}
+
+// Nack implements amqp.Acknowledger. Requeued messages are redelivered
+// before any other messages of the queue; other messages are discarded,
+// and can be inspected with Discarded.
+func (q *Queue) Nack(tag uint64, multiple bool, requeue bool) error {
+	var requeued []amqp.Delivery
+	err := q.settle(tag, multiple, func(delivery amqp.Delivery) {
+		if requeue {
+			delivery.Redelivered = true
+			requeued = append(requeued, delivery)
+		} else {
+			q.discarded = append(q.discarded, delivery)
+		}
+	})
+	if len(requeued) > 0 {
+		q.mutex.Lock()
+		q.ready = append(requeued, q.ready...)
+		q.cond.Broadcast()
+		q.mutex.Unlock()
+	}
+	return err
+}
+
+// Reject implements amqp.Acknowledger.
+func (q *Queue) Reject(tag uint64, requeue bool) error {
+	return q.Nack(tag, false, requeue)
+}
+
+// settle removes the unacknowledged message with the given delivery tag
+// (and those before it, if multiple) and calls f for each
+func (q *Queue) settle(tag uint64, multiple bool, f func(amqp.Delivery)) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if _, ok := q.unacked[tag]; !ok {
+		return fmt.Errorf("queue %v has no unacknowledged message with delivery tag %v", q.Name, tag)
+	}
+	for t := uint64(1); t <= tag; t++ {
+		if delivery, ok := q.unacked[t]; ok && (t == tag || multiple) {
+			delete(q.unacked, t)
+			f(delivery)
+		}
+	}
+	q.cond.Broadcast()
+	return nil
+}
+
+// Cancel stops the consumer of the queue, requeueing any unacknowledged
+// messages. An anonymous queue is deleted, while a named queue keeps
+// receiving messages until it is consumed from again.
+func (q *Queue) Cancel() {
+	q.broker.mutex.Lock()
+	defer q.broker.mutex.Unlock()
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.callback == nil {
+		return
+	}
+	q.consumer++
+	q.callback = nil
+	requeued := []amqp.Delivery{}
+	for t := uint64(1); t <= q.tag; t++ {
+		if delivery, ok := q.unacked[t]; ok {
+			delete(q.unacked, t)
+			delivery.Redelivered = true
+			requeued = append(requeued, delivery)
+		}
+	}
+	q.ready = append(requeued, q.ready...)
+	if strings.HasPrefix(q.Name, "anonymous-") {
+		delete(q.broker.queues, q.Name)
+	}
+	q.cond.Broadcast()
+}
+
+// Len returns the number of messages waiting to be delivered.
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.ready)
+}
+
+// Unacked returns the number of delivered messages which have not been
+// acknowledged yet.
+func (q *Queue) Unacked() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.unacked)
+}
+
+// Discarded returns the messages which were negatively acknowledged
+// without being requeued.
+func (q *Queue) Discarded() []amqp.Delivery {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]amqp.Delivery{}, q.discarded...)
+}
+
+// WaitIdle waits until all messages of the queue have been delivered and
+// acknowledged, and the callback has returned, or until the consumer is
+// cancelled. It returns an error if this takes longer than timeout.
+func (q *Queue) WaitIdle(timeout time.Duration) error {
+	timedOut := false
+	timer := time.AfterFunc(timeout, func() {
+		q.mutex.Lock()
+		timedOut = true
+		q.cond.Broadcast()
+		q.mutex.Unlock()
+	})
+	defer timer.Stop()
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for q.callback != nil && (len(q.ready) > 0 || len(q.unacked) > 0 || q.busy) {
+		if timedOut {
+			return fmt.Errorf("queue %v still has %v ready and %v unacknowledged messages after %v", q.Name, len(q.ready), len(q.unacked), timeout)
+		}
+		q.cond.Wait()
+	}
+	return nil
+}
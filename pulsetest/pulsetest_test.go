@@ -0,0 +1,242 @@
+package pulsetest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/taskcluster-client-go/purgecacheevents"
+	"github.com/taskcluster/taskcluster-client-go/queueevents"
+)
+
+var _ queueevents.Publisher = NewBroker()
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		pattern, routingKey string
+		match               bool
+	}{
+		{"a.b.c", "a.b.c", true},
+		{"a.*.c", "a.b.c", true},
+		{"a.*.c", "a.c", false},
+		{"a.#", "a", true},
+		{"a.#", "a.b.c", true},
+		{"#", "a.b", true},
+		{"a.#.c", "a.c", true},
+		{"a.#.c", "a.b.b.c", true},
+		{"a.#.c", "a.b.b.d", false},
+		{"*.*", "a", false},
+		{"a.b", "a.b.c", false},
+	} {
+		if match := Match(test.pattern, test.routingKey); match != test.match {
+			t.Errorf("Match(%q, %q) returned %v", test.pattern, test.routingKey, match)
+		}
+	}
+}
+
+func taskCompleted(taskId string) (queueevents.TaskCompleted, *queueevents.TaskCompletedMessage) {
+	binding := queueevents.TaskCompleted{
+		TaskId:        taskId,
+		RunId:         "0",
+		WorkerGroup:   "us-west-2",
+		WorkerId:      "i-0a1b2c3d",
+		ProvisionerId: "aws-provisioner",
+		WorkerType:    "gaia",
+		SchedulerId:   "-",
+		TaskGroupId:   taskId,
+	}
+	message := &queueevents.TaskCompletedMessage{WorkerGroup: "us-west-2", WorkerId: "i-0a1b2c3d"}
+	message.Status.TaskId = taskId
+	return binding, message
+}
+
+func TestConsumeTypedMessages(t *testing.T) {
+	broker := NewBroker()
+	var mutex sync.Mutex
+	completed := []string{}
+	routes := [][]string{}
+	handlers := &queueevents.Handlers{
+		TaskCompleted: func(message *queueevents.TaskCompletedMessage, delivery amqp.Delivery) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			completed = append(completed, message.Status.TaskId)
+			routes = append(routes, queueevents.CCRoutes(delivery))
+			return nil
+		},
+	}
+	queue, err := broker.Consume("", handlers.Callback(), 1, false,
+		queueevents.TaskCompleted{WorkerType: "gaia"},
+		queueevents.CCRoute{Binding: queueevents.TaskCompleted{}, Route: "notify.#"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	binding, message := taskCompleted("task1")
+	if err := broker.PublishMessage(binding, message); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// only matches by CC'ed route
+	binding, message = taskCompleted("task2")
+	binding.WorkerType = "other"
+	if err := broker.PublishMessage(binding, message, "notify.by-email", "notify.by-irc"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// matches no binding
+	binding, message = taskCompleted("task3")
+	binding.WorkerType = "other"
+	if err := broker.PublishMessage(binding, message, "index.gecko"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := queue.WaitIdle(time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(completed) != 2 || completed[0] != "task1" || completed[1] != "task2" {
+		t.Errorf("Unexpected completed tasks %v", completed)
+	}
+	if len(routes[1]) != 2 || routes[1][0] != "notify.by-email" {
+		t.Errorf("Unexpected CC'ed routes %v", routes)
+	}
+}
+
+func TestRequeueAndDiscard(t *testing.T) {
+	broker := NewBroker()
+	var mutex sync.Mutex
+	attempts := map[bool]int{}
+	handlers := &queueevents.Handlers{
+		TaskCompleted: func(message *queueevents.TaskCompletedMessage, delivery amqp.Delivery) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			attempts[delivery.Redelivered]++
+			return errors.New("try again")
+		},
+	}
+	queue, err := broker.Consume("retries", handlers.Callback(), 1, false, queueevents.TaskCompleted{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	binding, message := taskCompleted("task1")
+	if err := broker.PublishMessage(binding, message); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := queue.WaitIdle(time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if attempts[false] != 1 || attempts[true] != 1 {
+		t.Errorf("Expected one delivery and one redelivery, but got %v", attempts)
+	}
+	discarded := queue.Discarded()
+	if len(discarded) != 1 || discarded[0].RoutingKey != "primary.task1.0.us-west-2.i-0a1b2c3d.aws-provisioner.gaia.-.task1._" {
+		t.Errorf("Unexpected discarded messages %v", discarded)
+	}
+}
+
+func TestNamedQueueKeepsMessagesWithoutConsumer(t *testing.T) {
+	broker := NewBroker()
+	delivered := make(chan amqp.Delivery, 10)
+	callback := func(message interface{}, delivery amqp.Delivery) {
+		delivered <- delivery
+	}
+	queue, err := broker.Consume("durable", callback, 0, false, queueevents.TaskCompleted{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	binding, message := taskCompleted("task1")
+	broker.PublishMessage(binding, message)
+	<-delivered
+	queue.Cancel()
+	broker.PublishMessage(binding, message)
+	if queue.Len() != 2 {
+		t.Fatalf("Expected unacknowledged and new message to be queued, but queue has %v", queue.Len())
+	}
+
+	if _, err := broker.Consume("durable", callback, 0, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := broker.Consume("durable", callback, 0, true); err == nil {
+		t.Error("Expected error consuming from queue with a consumer")
+	}
+	if d := <-delivered; !d.Redelivered {
+		t.Error("Expected unacknowledged message to be redelivered")
+	}
+	if d := <-delivered; d.Redelivered {
+		t.Error("Expected new message not to be redelivered")
+	}
+	if err := queue.WaitIdle(time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestGeneratedPublish(t *testing.T) {
+	broker := NewBroker()
+	messages := make(chan *purgecacheevents.PurgeCacheMessage, 1)
+	handlers := &purgecacheevents.Handlers{
+		PurgeCache: func(message *purgecacheevents.PurgeCacheMessage, delivery amqp.Delivery) error {
+			messages <- message
+			return nil
+		},
+	}
+	if _, err := broker.Consume("", handlers.Callback(), 1, false, purgecacheevents.PurgeCache{WorkerType: "gaia"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	binding := purgecacheevents.PurgeCache{ProvisionerId: "aws-provisioner", WorkerType: "gaia"}
+	message := &purgecacheevents.PurgeCacheMessage{Version: 1, ProvisionerId: "aws-provisioner", WorkerType: "gaia", CacheName: "level-3-checkouts"}
+	if err := purgecacheevents.PublishPurgeCache(broker, binding, message); err != nil {
+		t.Fatalf("Could not publish message: %v", err)
+	}
+	if m := <-messages; m.CacheName != "level-3-checkouts" {
+		t.Errorf("Expected published message to be delivered, but got %#v", m)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	broker := NewBroker()
+	deliveries := make(chan amqp.Delivery, 10)
+	queue, err := broker.Consume("", func(message interface{}, delivery amqp.Delivery) {
+		deliveries <- delivery
+	}, 2, false, queueevents.TaskCompleted{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, taskId := range []string{"task1", "task2", "task3"} {
+		binding, message := taskCompleted(taskId)
+		broker.PublishMessage(binding, message)
+	}
+	first, second := <-deliveries, <-deliveries
+	select {
+	case <-deliveries:
+		t.Fatal("Expected no more than 2 unacknowledged messages")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := first.Ack(false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	third := <-deliveries
+	if err := third.Ack(true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := second.Ack(false); err == nil {
+		t.Error("Expected error acknowledging message twice")
+	}
+	if err := queue.WaitIdle(time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestInvalidBindings(t *testing.T) {
+	broker := NewBroker()
+	if _, err := broker.Consume("", func(interface{}, amqp.Delivery) {}, 1, true, queueevents.TaskCompleted{WorkerType: "a.b"}); err == nil {
+		t.Error("Expected error consuming with invalid binding")
+	}
+	if err := broker.PublishMessage(queueevents.CCRoute{Binding: queueevents.TaskCompleted{}, Route: "x"}, struct{}{}); err == nil {
+		t.Error("Expected error publishing to CC'ed route")
+	}
+	if err := broker.Publish("exchange/x", "a.*", nil, []byte("{}")); err == nil {
+		t.Error("Expected error publishing with wildcard routing key")
+	}
+}
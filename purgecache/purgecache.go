@@ -47,6 +47,7 @@ import (
 	"time"
 
 	"github.com/taskcluster/httpbackoff"
+	"github.com/taskcluster/taskcluster-client-go/relativetime"
 	hawk "github.com/tent/hawk-go"
 	D "github.com/tj/go-debug"
 )
@@ -224,9 +225,9 @@ func (purgeCache *PurgeCache) PurgeCache(provisionerId string, workerType string
 // **Warning** this api end-point is **not stable**.
 //
 // See http://docs.taskcluster.net/services/purge-cache/#ping
-func (purgeCache *PurgeCache) Ping() *CallSummary {
-	_, callSummary := purgeCache.apiCall(nil, "GET", "/ping", nil)
-	return callSummary
+func (purgeCache *PurgeCache) Ping() (*json.RawMessage, *CallSummary) {
+	responseObject, callSummary := purgeCache.apiCall(nil, "GET", "/ping", new(json.RawMessage))
+	return responseObject.(*json.RawMessage), callSummary
 }
 
 type (
@@ -276,3 +277,12 @@ func (t *Time) UnmarshalJSON(data []byte) (err error) {
 func (t Time) String() string {
 	return time.Time(t).UTC().Format("2006-01-02T15:04:05.000Z")
 }
+
+// FromNow returns the Time which is the given relative time expression from
+// now, e.g. "2 days 3 hours", "in 1 day" or "-30 minutes". See package
+// github.com/taskcluster/taskcluster-client-go/relativetime for the supported
+// syntax.
+func FromNow(expr string) (Time, error) {
+	t, err := relativetime.FromNow(expr)
+	return Time(t), err
+}
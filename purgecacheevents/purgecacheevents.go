@@ -38,13 +38,28 @@
 //
 // In addition, this means that you will also get objects in your callback method like *queueevents.TaskDefinedMessage
 // rather than just interface{}.
+//
+// Since the RoutingKey method of a binding cannot report errors, it panics if a field value is not a
+// valid routing key word, e.g. "a.b", rather than return the wrong routing key pattern. Check bindings
+// with ValidateBindings before subscribing with them, to get an error instead:
+//
+//  binding := queueevents.TaskDefined{WorkerType: workerType}
+//  if err := queueevents.ValidateBindings(binding); err != nil {
+//  	// handle error...
+//  }
 package purgecacheevents
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/taskcluster-client-go/schemacheck"
+	"github.com/taskcluster/taskcluster-client-go/relativetime"
 )
 
 // When a cache purge is requested  a message will be posted on this
@@ -53,11 +68,13 @@ import (
 //
 // See http://docs.taskcluster.net/services/purge-cache/#purgeCache
 type PurgeCache struct {
-	RoutingKeyKind string `mwords:"*"`
-	ProvisionerId  string `mwords:"*"`
-	WorkerType     string `mwords:"*"`
+	RoutingKeyKind string `mwords:"*" constant:"primary" required:"true"`
+	ProvisionerId  string `mwords:"*" required:"true"`
+	WorkerType     string `mwords:"*" required:"true"`
 }
 
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Validate returns an error, rather than return the wrong pattern.
 func (binding PurgeCache) RoutingKey() string {
 	return generateRoutingKey(&binding)
 }
@@ -70,7 +87,47 @@ func (binding PurgeCache) NewPayloadObject() interface{} {
 	return new(PurgeCacheMessage)
 }
 
+// Validate returns an error if a field of the binding has a value which
+// would not result in the intended routing key pattern, e.g. a value
+// containing a '.'.
+func (binding PurgeCache) Validate() error {
+	return validateRoutingKey(&binding)
+}
+
+// ParsePurgeCache returns the PurgeCache binding with its fields set from
+// the primary routing key of a message from its exchange, such as
+// delivery.RoutingKey, so that they can be read without decoding the message
+// body.
+func ParsePurgeCache(routingKey string) (*PurgeCache, error) {
+	binding := new(PurgeCache)
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// purgeCacheSchema is the schema of messages for exchange
+// exchange/taskcluster-purge-cache/v1/purge-cache, with references resolved
+const purgeCacheSchema = `{"additionalProperties":false,"properties":{"cacheName":{"type":"string"},"provisionerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"version":{"enum":[1],"type":"integer"},"workerType":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["version","provisionerId","workerType","cacheName"],"type":"object"}`
+
+// PublishPurgeCache publishes message with publisher, after checking it
+// against the schema of its exchange, to exchange
+// exchange/taskcluster-purge-cache/v1/purge-cache
+//
+// The routing key is made from the fields of binding, which may not contain
+// wildcards, and the message is CC'ed to `route.<route>` for each of the
+// given task specific routes.
+func PublishPurgeCache(publisher Publisher, binding PurgeCache, message *PurgeCacheMessage, routes ...string) error {
+	return publish(publisher, binding.ExchangeName(), &binding, message, purgeCacheSchema, routes)
+}
+
+// generateRoutingKey returns the routing key pattern of binding x. It panics
+// if validateRoutingKey returns an error, so that a binding with an invalid
+// field value is never bound with the wrong pattern.
 func generateRoutingKey(x interface{}) string {
+	if err := validateRoutingKey(x); err != nil {
+		panic(err)
+	}
 	val := reflect.ValueOf(x).Elem()
 	p := make([]string, 0, val.NumField())
 	for i := 0; i < val.NumField(); i++ {
@@ -79,7 +136,11 @@ func generateRoutingKey(x interface{}) string {
 		tag := typeField.Tag
 		if t := tag.Get("mwords"); t != "" {
 			if v := valueField.Interface(); v == "" {
-				p = append(p, t)
+				if c := tag.Get("constant"); c != "" {
+					p = append(p, c)
+				} else {
+					p = append(p, t)
+				}
 			} else {
 				p = append(p, v.(string))
 			}
@@ -88,6 +149,382 @@ func generateRoutingKey(x interface{}) string {
 	return strings.Join(p, ".")
 }
 
+// validateRoutingKey returns an error if a field of binding x has a value
+// which would not result in the intended routing key pattern: a single-word
+// field containing a '.', a '*' or '#' which is not a whole word (or a '#'
+// in a single-word field), a constant field with a value other than its
+// constant, or a required field with value '_', which is only used for
+// values that are not present.
+func validateRoutingKey(x interface{}) error {
+	val := reflect.ValueOf(x).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		mwords := field.Tag.Get("mwords")
+		value := val.Field(i).String()
+		if mwords == "" || value == "" {
+			continue
+		}
+		if mwords == "*" && strings.Contains(value, ".") {
+			return fmt.Errorf("%v.%v %q may not contain a '.', since it is a single word of the routing key", val.Type(), field.Name, value)
+		}
+		if c := field.Tag.Get("constant"); c != "" && value != c {
+			return fmt.Errorf("%v.%v is always %q, but is %q", val.Type(), field.Name, c, value)
+		}
+		if field.Tag.Get("required") == "true" && value == "_" {
+			return fmt.Errorf("%v.%v is required, so is never %q", val.Type(), field.Name, value)
+		}
+		for _, word := range strings.Split(value, ".") {
+			if word == "" || word != "*" && word != "#" && strings.ContainsAny(word, "*#") || word == "#" && mwords == "*" {
+				return fmt.Errorf("%v.%v %q has invalid word %q", val.Type(), field.Name, value, word)
+			}
+		}
+	}
+	return nil
+}
+
+// CCRoute is a binding for messages from the exchange of Binding which are
+// CC'ed to the task specific route `route.<Route>`, i.e. messages about
+// tasks with Route in their TaskDefinition.Routes. Route may contain the
+// wildcards * and #, and the routing key fields of Binding are ignored, e.g.
+//
+//  purgecacheevents.CCRoute{Binding: purgecacheevents.PurgeCache{}, Route: "notify.by-email"}
+type CCRoute struct {
+	Binding interface {
+		ExchangeName() string
+		NewPayloadObject() interface{}
+	}
+	Route string
+}
+
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Route is not a valid route pattern.
+func (binding CCRoute) RoutingKey() string {
+	if err := validateRoute(binding.Route); err != nil {
+		panic(err)
+	}
+	return "route." + binding.Route
+}
+
+func (binding CCRoute) ExchangeName() string {
+	return binding.Binding.ExchangeName()
+}
+
+func (binding CCRoute) NewPayloadObject() interface{} {
+	return binding.Binding.NewPayloadObject()
+}
+
+// Validate returns an error if Binding is not set, or Route is not a valid
+// route pattern.
+func (binding CCRoute) Validate() error {
+	if binding.Binding == nil {
+		return errors.New("CCRoute has no Binding")
+	}
+	return validateRoute(binding.Route)
+}
+
+// validateRoute returns an error if route is not a valid route pattern.
+func validateRoute(route string) error {
+	for _, word := range strings.Split(route, ".") {
+		if word == "" || word != "*" && word != "#" && strings.ContainsAny(word, "*#") {
+			return fmt.Errorf("CCRoute has invalid route %q", route)
+		}
+	}
+	return nil
+}
+
+// ValidateBindings returns the first error returned by the Validate method
+// of the given bindings, if any. Since the RoutingKey method of a binding
+// panics if it is not valid, call ValidateBindings before passing bindings
+// to pulse.Connection.Consume. Bindings without a Validate method are
+// skipped.
+func ValidateBindings(bindings ...interface{}) error {
+	for _, binding := range bindings {
+		if v, ok := binding.(interface {
+			Validate() error
+		}); ok {
+			if err := v.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseRoutingKey sets the fields of binding x from the words of routingKey,
+// i.e. it is the inverse of generateRoutingKey. A multi-word field gets all
+// words not taken by the other fields, which may be none.
+func parseRoutingKey(routingKey string, x interface{}) error {
+	if strings.HasPrefix(routingKey, "route.") {
+		return &CCRouteError{RoutingKey: routingKey}
+	}
+	val := reflect.ValueOf(x).Elem()
+	fields := []int{}
+	multi := -1
+	for i := 0; i < val.NumField(); i++ {
+		switch val.Type().Field(i).Tag.Get("mwords") {
+		case "#":
+			multi = len(fields)
+			fields = append(fields, i)
+		case "*":
+			fields = append(fields, i)
+		}
+	}
+	words := strings.Split(routingKey, ".")
+	if multi == -1 && len(words) != len(fields) || multi >= 0 && len(words) < len(fields)-1 {
+		return fmt.Errorf("routing key %q has %v words, which does not match %v", routingKey, len(words), val.Type())
+	}
+	// number of fields after the multi-word field
+	after := len(fields) - 1 - multi
+	for j, i := range fields {
+		switch {
+		case multi == -1 || j < multi:
+			val.Field(i).SetString(words[j])
+		case j == multi:
+			val.Field(i).SetString(strings.Join(words[j:len(words)-after], "."))
+		default:
+			val.Field(i).SetString(words[len(words)-len(fields)+j])
+		}
+		if c := val.Type().Field(i).Tag.Get("constant"); c != "" && val.Field(i).String() != c {
+			return fmt.Errorf("routing key %q does not match %v, which always has %v %q", routingKey, val.Type(), val.Type().Field(i).Name, c)
+		}
+	}
+	return nil
+}
+
+// CCRouteError is returned when parsing a routing key which is a task
+// specific route that a message was CC'ed to, e.g. `route.notify.by-email`,
+// rather than a primary routing key.
+type CCRouteError struct {
+	RoutingKey string
+}
+
+func (err *CCRouteError) Error() string {
+	return fmt.Sprintf("routing key %q is a CC'ed task specific route, not a primary routing key", err.RoutingKey)
+}
+
+// CCRoutes returns the task specific routes, without their `route.` prefix,
+// that a delivered message was CC'ed to.
+func CCRoutes(delivery amqp.Delivery) []string {
+	routes := []string{}
+	cc, _ := delivery.Headers["CC"].([]interface{})
+	for _, key := range cc {
+		if route, ok := key.(string); ok && strings.HasPrefix(route, "route.") {
+			routes = append(routes, strings.TrimPrefix(route, "route."))
+		}
+	}
+	return routes
+}
+
+// ParseRoutingKey returns the binding of the given exchange, e.g. *PurgeCache,
+// with its fields set from routingKey, which must be the primary routing key
+// of a message from the exchange, such as delivery.RoutingKey.
+func ParseRoutingKey(exchange, routingKey string) (interface{}, error) {
+	var binding interface{}
+	switch exchange {
+	case "exchange/taskcluster-purge-cache/v1/purge-cache":
+		binding = new(PurgeCache)
+	default:
+		return nil, fmt.Errorf("unknown exchange %v", exchange)
+	}
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// Handlers dispatches pulse messages from the exchanges of this package to
+// type-safe handler functions, and acknowledges them according to the
+// result. Set a handler for each exchange of interest, and pass
+// handlers.Callback() to pulse.Connection.Consume with autoAck false, e.g.
+//
+//  handlers := &purgecacheevents.Handlers{
+//  	PurgeCache: func(message *purgecacheevents.PurgeCacheMessage, delivery amqp.Delivery) error {
+//  		// handle message...
+//  	},
+//  }
+//  conn.Consume("my-queue", handlers.Callback(), 1, false, purgecacheevents.PurgeCache{})
+//
+// A handler returning nil acknowledges the message. A handler returning an
+// error negatively acknowledges it, requeueing it if the Requeue policy says
+// so.
+type Handlers struct {
+	// Handles messages from exchange exchange/taskcluster-purge-cache/v1/purge-cache
+	PurgeCache func(message *PurgeCacheMessage, delivery amqp.Delivery) error
+	// Handles messages from exchanges without a handler, if not nil;
+	// otherwise such messages are acknowledged and dropped
+	Unknown func(message interface{}, delivery amqp.Delivery) error
+	// Decides whether a message that could not be handled is requeued (true)
+	// or discarded (false); DefaultRequeue is used if nil
+	Requeue func(err error, delivery amqp.Delivery) bool
+}
+
+// DecodeError is returned by Handlers.Handle when a message body cannot be
+// decoded into the message type of its exchange.
+type DecodeError struct {
+	Exchange string
+	Err      error
+}
+
+func (err *DecodeError) Error() string {
+	return fmt.Sprintf("could not decode message from exchange %v: %v", err.Exchange, err.Err)
+}
+
+// Permanent reports that decoding the message would fail again, so that
+// consumers such as pulseconsumer.Supervisor do not retry it.
+func (err *DecodeError) Permanent() bool {
+	return true
+}
+
+// PermanentError can be returned by a handler to signal that handling the
+// message would fail again, so it should not be requeued.
+type PermanentError struct {
+	Err error
+}
+
+func (err *PermanentError) Error() string {
+	return err.Err.Error()
+}
+
+// Permanent reports that handling the message would fail again, so that
+// consumers such as pulseconsumer.Supervisor do not retry it.
+func (err *PermanentError) Permanent() bool {
+	return true
+}
+
+// DefaultRequeue requeues a message that could not be handled, unless err is
+// a *DecodeError or *PermanentError, or the message has already been
+// redelivered, so that each message is retried at most once.
+func DefaultRequeue(err error, delivery amqp.Delivery) bool {
+	switch err.(type) {
+	case *DecodeError, *PermanentError:
+		return false
+	}
+	return !delivery.Redelivered
+}
+
+// Handle calls the handler for the exchange of the delivery, decoding
+// delivery.Body if message is not already of the message type of the
+// exchange, and returns the handler's error. Handle does not acknowledge the
+// message, so it can also be used when consuming with autoAck.
+func (handlers *Handlers) Handle(message interface{}, delivery amqp.Delivery) error {
+	switch delivery.Exchange {
+	case "exchange/taskcluster-purge-cache/v1/purge-cache":
+		if handlers.PurgeCache != nil {
+			m, ok := message.(*PurgeCacheMessage)
+			if !ok {
+				m = new(PurgeCacheMessage)
+				if err := json.Unmarshal(delivery.Body, m); err != nil {
+					return &DecodeError{Exchange: delivery.Exchange, Err: err}
+				}
+			}
+			return handlers.PurgeCache(m, delivery)
+		}
+	}
+	if handlers.Unknown != nil {
+		return handlers.Unknown(message, delivery)
+	}
+	return nil
+}
+
+// Callback returns a callback for pulse.Connection.Consume, which calls
+// Handle, and acknowledges the message if it was handled successfully, or
+// else negatively acknowledges it, requeueing it if the Requeue policy says
+// so. Consume must be called with autoAck false.
+func (handlers *Handlers) Callback() func(message interface{}, delivery amqp.Delivery) {
+	return func(message interface{}, delivery amqp.Delivery) {
+		err := handlers.Handle(message, delivery)
+		if err == nil {
+			delivery.Ack(false)
+			return
+		}
+		requeue := handlers.Requeue
+		if requeue == nil {
+			requeue = DefaultRequeue
+		}
+		delivery.Nack(false, requeue(err, delivery))
+	}
+}
+
+// Publisher publishes a message body to an exchange with a routing key,
+// CC'ed to further routing keys, e.g. `route.<route>` for task specific
+// routes. The Publish functions of this package publish through a
+// Publisher, such as a *pulsetest.Broker. On top of amqp, a Publisher would
+// publish body as an application/json message, with the cc routing keys in
+// its "CC" header.
+type Publisher interface {
+	Publish(exchange, routingKey string, cc []string, body []byte) error
+}
+
+// SchemaError is returned by the Publish functions when a message does not
+// conform to the schema of its exchange.
+type SchemaError struct {
+	Exchange string
+	Err      error
+}
+
+func (err *SchemaError) Error() string {
+	return fmt.Sprintf("message for exchange %v does not conform to its schema: %v", err.Exchange, err.Err)
+}
+
+// publish publishes message to exchange with publisher, with the routing key
+// of binding x, after checking the message against schema.
+func publish(publisher Publisher, exchange string, x interface{}, message interface{}, schema string, routes []string) error {
+	routingKey, err := publishRoutingKey(x)
+	if err != nil {
+		return err
+	}
+	cc := make([]string, len(routes))
+	for i, route := range routes {
+		for _, word := range strings.Split(route, ".") {
+			if word == "" || strings.ContainsAny(word, "*#") {
+				return fmt.Errorf("cannot publish to invalid route %q", route)
+			}
+		}
+		cc[i] = "route." + route
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if err := schemacheck.Validate(schema, body); err != nil {
+		return &SchemaError{Exchange: exchange, Err: err}
+	}
+	return publisher.Publish(exchange, routingKey, cc, body)
+}
+
+// publishRoutingKey returns the routing key for publishing a message with
+// the routing key fields of binding x. A routing key for publishing may not
+// contain wildcards, so fields which are not set are published as '_', as
+// the TaskCluster services do for values that are not present, except that
+// required fields must be set.
+func publishRoutingKey(x interface{}) (string, error) {
+	if err := validateRoutingKey(x); err != nil {
+		return "", err
+	}
+	val := reflect.ValueOf(x).Elem()
+	p := make([]string, 0, val.NumField())
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		if field.Tag.Get("mwords") == "" {
+			continue
+		}
+		value := val.Field(i).String()
+		if value == "" {
+			value = field.Tag.Get("constant")
+		}
+		switch {
+		case value == "" && field.Tag.Get("required") == "true":
+			return "", fmt.Errorf("%v.%v is required to publish a message", val.Type(), field.Name)
+		case value == "":
+			value = "_"
+		case strings.ContainsAny(value, "*#"):
+			return "", fmt.Errorf("%v.%v %q may not contain wildcards when publishing a message", val.Type(), field.Name, value)
+		}
+		p = append(p, value)
+	}
+	return strings.Join(p, "."), nil
+}
+
 type (
 	// Message reporting that a specific cache should be purged
 	//
@@ -148,3 +585,12 @@ func (t *Time) UnmarshalJSON(data []byte) (err error) {
 func (t Time) String() string {
 	return time.Time(t).UTC().Format("2006-01-02T15:04:05.000Z")
 }
+
+// FromNow returns the Time which is the given relative time expression from
+// now, e.g. "2 days 3 hours", "in 1 day" or "-30 minutes". See package
+// github.com/taskcluster/taskcluster-client-go/relativetime for the supported
+// syntax.
+func FromNow(expr string) (Time, error) {
+	t, err := relativetime.FromNow(expr)
+	return Time(t), err
+}
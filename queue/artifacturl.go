@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	hawk "github.com/tent/hawk-go"
+)
+
+// ArtifactURL returns the url of artifact name of run runId of task taskId,
+// which can be fetched with a normal http client. If the artifact is not
+// public (its name does not start with "public/") and myQueue.Authenticate
+// is true, the url is signed with myQueue's credentials (including
+// myQueue.Certificate, if set), and is valid for the given duration.
+//
+// The url is that of the GetArtifact end-point, which redirects to the
+// artifact if it is stored externally.
+func (myQueue *Queue) ArtifactURL(taskId string, runId int, name string, duration time.Duration) (*url.URL, error) {
+	u, err := url.Parse(myQueue.BaseURL + "/task/" + url.QueryEscape(taskId) + "/runs/" + strconv.Itoa(runId) + "/artifacts/" + url.QueryEscape(name))
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(name, "public/") || !myQueue.Authenticate {
+		return u, nil
+	}
+	credentials := &hawk.Credentials{
+		ID:   myQueue.ClientId,
+		Key:  myQueue.AccessToken,
+		Hash: sha256.New,
+	}
+	auth, err := hawk.NewURLAuth(u.String(), credentials, duration)
+	if err != nil {
+		return nil, err
+	}
+	if myQueue.Certificate != "" {
+		auth.Ext = base64.StdEncoding.EncodeToString([]byte("{\"certificate\":" + myQueue.Certificate + "}"))
+	}
+	query := u.Query()
+	query.Set("bewit", auth.Bewit())
+	u.RawQuery = query.Encode()
+	return u, nil
+}
@@ -0,0 +1,24 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArtifactURL(t *testing.T) {
+	myQueue := New("clientId", "accessToken")
+	u, err := myQueue.ArtifactURL("Gu3BJf0IQeuJE-HFKtYI2A", 1, "public/build/target.tar.bz2", time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "https://queue.taskcluster.net/v1/task/Gu3BJf0IQeuJE-HFKtYI2A/runs/1/artifacts/public%2Fbuild%2Ftarget.tar.bz2"; u.String() != expected {
+		t.Errorf("Expected public artifact url %v but got %v", expected, u)
+	}
+	u, err = myQueue.ArtifactURL("Gu3BJf0IQeuJE-HFKtYI2A", 1, "private/secret.txt", time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if u.Query().Get("bewit") == "" {
+		t.Errorf("Expected private artifact url to be signed, but got %v", u)
+	}
+}
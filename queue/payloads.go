@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/taskcluster/taskcluster-client-go/schemacheck"
+)
+
+// AnyWorkerType can be passed as workerType to RegisterPayload, to register a
+// payload type for all worker types of a provisioner that have no payload
+// type registered themselves.
+const AnyWorkerType = "*"
+
+var (
+	// protects payloadTypes
+	payloadTypesMutex sync.RWMutex
+	// registered payload types, keyed by <provisionerId>/<workerType>
+	payloadTypes = map[string]reflect.Type{}
+)
+
+// UnregisteredPayloadError is returned by DecodePayload when no payload type
+// has been registered for the provisionerId and workerType of a task.
+type UnregisteredPayloadError struct {
+	ProvisionerId string
+	WorkerType    string
+}
+
+func (err *UnregisteredPayloadError) Error() string {
+	return fmt.Sprintf("no payload type registered for worker type %v/%v", err.ProvisionerId, err.WorkerType)
+}
+
+// RegisterPayload registers the type of prototype as the type of the task
+// payloads of workers of workerType of provisionerId, replacing any type
+// previously registered. Pointers are dereferenced, so that e.g. the payload
+// types generated by generatemodel -p can be registered with:
+//
+//	queue.RegisterPayload("aws-provisioner", "b2gtest", (*dockerworker.DockerWorkerPayload)(nil))
+//
+// Registered types are used by CheckPayload, and so by TaskBuilder.Build and
+// scheduler.TaskGraphBuilder.Build, to check payloads, and by DecodePayload
+// to decode the payloads of fetched tasks. It is safe to call
+// RegisterPayload concurrently, but types would typically be registered by
+// an init function.
+func RegisterPayload(provisionerId, workerType string, prototype interface{}) {
+	t := reflect.TypeOf(prototype)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		panic("queue: RegisterPayload called with nil interface for " + provisionerId + "/" + workerType)
+	}
+	payloadTypesMutex.Lock()
+	defer payloadTypesMutex.Unlock()
+	payloadTypes[provisionerId+"/"+workerType] = t
+}
+
+// PayloadType returns the payload type registered for workerType of
+// provisionerId, falling back to the type registered for AnyWorkerType of
+// provisionerId, or nil if neither has been registered.
+func PayloadType(provisionerId, workerType string) reflect.Type {
+	payloadTypesMutex.RLock()
+	defer payloadTypesMutex.RUnlock()
+	if t, ok := payloadTypes[provisionerId+"/"+workerType]; ok {
+		return t
+	}
+	return payloadTypes[provisionerId+"/"+AnyWorkerType]
+}
+
+// DecodePayload decodes payload into a new value of the payload type
+// registered for workerType of provisionerId, and returns a pointer to it.
+// If no type is registered, an *UnregisteredPayloadError is returned.
+func DecodePayload(provisionerId, workerType string, payload json.RawMessage) (interface{}, error) {
+	t := PayloadType(provisionerId, workerType)
+	if t == nil {
+		return nil, &UnregisteredPayloadError{ProvisionerId: provisionerId, WorkerType: workerType}
+	}
+	value := reflect.New(t)
+	if err := json.Unmarshal(payload, value.Interface()); err != nil {
+		return nil, fmt.Errorf("payload does not match type %v registered for worker type %v/%v: %v", t, provisionerId, workerType, err)
+	}
+	return value.Interface(), nil
+}
+
+// TypedPayload decodes the payload of the task definition with
+// DecodePayload, returning a pointer to a value of the registered payload
+// type.
+func (td *TaskDefinition) TypedPayload() (interface{}, error) {
+	return DecodePayload(td.ProvisionerId, td.WorkerType, td.Payload)
+}
+
+// TypedPayload decodes the payload of a task definition returned by
+// Queue.Task with DecodePayload, returning a pointer to a value of the
+// registered payload type. For example:
+//
+//	td, callSummary := myQueue.Task(taskId)
+//	...
+//	payload, err := td.TypedPayload()
+//	if err != nil {
+//		// handle error...
+//	}
+//	image := payload.(*dockerworker.DockerWorkerPayload).Image
+func (td *TaskDefinition1) TypedPayload() (interface{}, error) {
+	return DecodePayload(td.ProvisionerId, td.WorkerType, td.Payload)
+}
+
+// CheckPayload returns an error if payload does not decode to the payload
+// type registered for workerType of provisionerId, including if it has
+// properties which the type has no field for, e.g. because of a typo. If no
+// type is registered, payload is not checked.
+func CheckPayload(provisionerId, workerType string, payload json.RawMessage) error {
+	t := PayloadType(provisionerId, workerType)
+	if t == nil {
+		return nil
+	}
+	value := reflect.New(t).Interface()
+	err := json.Unmarshal(payload, value)
+	if err == nil {
+		err = schemacheck.CheckFields(payload, value)
+	}
+	if err != nil {
+		return fmt.Errorf("payload does not match type %v registered for worker type %v/%v: %v", t, provisionerId, workerType, err)
+	}
+	return nil
+}
+
+// checkPayload returns an error if payload, as marshaled to data, does not
+// suit the payload type registered for workerType of provisionerId (if any).
+// Payloads of a different struct type are rejected, while other values, such
+// as maps and json.RawMessages, are checked with CheckPayload.
+func checkPayload(provisionerId, workerType string, payload interface{}, data json.RawMessage) error {
+	t := PayloadType(provisionerId, workerType)
+	if t == nil {
+		return nil
+	}
+	pt := reflect.TypeOf(payload)
+	for pt.Kind() == reflect.Ptr {
+		pt = pt.Elem()
+	}
+	if pt.Kind() == reflect.Struct && pt != t {
+		return fmt.Errorf("payload is of type %v, but worker type %v/%v takes payloads of type %v", pt, provisionerId, workerType, t)
+	}
+	return CheckPayload(provisionerId, workerType, data)
+}
@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testPayload struct {
+	Image      string   `json:"image"`
+	Command    []string `json:"command"`
+	MaxRunTime int      `json:"maxRunTime"`
+}
+
+type otherPayload struct {
+	Script string `json:"script"`
+}
+
+func TestPayloadRoundTrip(t *testing.T) {
+	RegisterPayload("payload-test", "docker", (*testPayload)(nil))
+	payload := &testPayload{
+		Image:      "ubuntu:14.04",
+		Command:    []string{"echo", "hello"},
+		MaxRunTime: 600,
+	}
+	_, td, err := NewTaskBuilder("payload-test", "docker").
+		Metadata("Hello", "Says hello", "me@example.com", "https://example.com/").
+		Payload(payload).
+		Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// simulate fetching the task with Queue.Task
+	data, err := json.Marshal(td)
+	if err != nil {
+		t.Fatalf("Could not marshal task definition: %v", err)
+	}
+	fetched := new(TaskDefinition1)
+	if err := json.Unmarshal(data, fetched); err != nil {
+		t.Fatalf("Could not unmarshal task definition: %v", err)
+	}
+	typed, err := fetched.TypedPayload()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(typed, payload) {
+		t.Errorf("Expected payload %#v but got %#v", payload, typed)
+	}
+}
+
+func TestPayloadTypeFallsBackToAnyWorkerType(t *testing.T) {
+	RegisterPayload("payload-fallback", AnyWorkerType, otherPayload{})
+	RegisterPayload("payload-fallback", "docker", &testPayload{})
+	if pt := PayloadType("payload-fallback", "docker"); pt != reflect.TypeOf(testPayload{}) {
+		t.Errorf("Expected testPayload for docker worker type, but got %v", pt)
+	}
+	if pt := PayloadType("payload-fallback", "generic"); pt != reflect.TypeOf(otherPayload{}) {
+		t.Errorf("Expected otherPayload for other worker types, but got %v", pt)
+	}
+	_, err := DecodePayload("payload-unknown", "docker", json.RawMessage(`{}`))
+	if _, ok := err.(*UnregisteredPayloadError); !ok {
+		t.Errorf("Expected *UnregisteredPayloadError but got %v", err)
+	}
+}
+
+func TestTaskBuilderChecksRegisteredPayload(t *testing.T) {
+	RegisterPayload("payload-check", "docker", testPayload{})
+	for _, payload := range []interface{}{
+		&otherPayload{Script: "echo hello"},
+		json.RawMessage(`{"image": 14.04}`),
+		map[string]interface{}{"image": "ubuntu:14.04", "maxRunTimeSeconds": 600},
+	} {
+		_, _, err := NewTaskBuilder("payload-check", "docker").
+			Metadata("Hello", "Says hello", "me@example.com", "https://example.com/").
+			Payload(payload).
+			Build()
+		if err == nil || !strings.Contains(err.Error(), "payload-check/docker") {
+			t.Errorf("Expected payload %T to be rejected, but got %v", payload, err)
+		}
+	}
+	_, _, err := NewTaskBuilder("payload-check", "docker").
+		Metadata("Hello", "Says hello", "me@example.com", "https://example.com/").
+		Payload(map[string]interface{}{"image": "ubuntu:14.04"}).
+		Build()
+	if err != nil {
+		t.Errorf("Expected map payload matching registered type to be accepted, but got %v", err)
+	}
+}
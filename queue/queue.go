@@ -50,6 +50,7 @@ import (
 	"time"
 
 	"github.com/taskcluster/httpbackoff"
+	"github.com/taskcluster/taskcluster-client-go/relativetime"
 	hawk "github.com/tent/hawk-go"
 	D "github.com/tj/go-debug"
 )
@@ -587,9 +588,9 @@ func (myQueue *Queue) PendingTasks(provisionerId string, workerType string) (*Co
 // **Warning** this api end-point is **not stable**.
 //
 // See http://docs.taskcluster.net/queue/api-docs/#ping
-func (myQueue *Queue) Ping() *CallSummary {
-	_, callSummary := myQueue.apiCall(nil, "GET", "/ping", nil)
-	return callSummary
+func (myQueue *Queue) Ping() (*json.RawMessage, *CallSummary) {
+	responseObject, callSummary := myQueue.apiCall(nil, "GET", "/ping", new(json.RawMessage))
+	return responseObject.(*json.RawMessage), callSummary
 }
 
 type (
@@ -1204,3 +1205,12 @@ func (t *Time) UnmarshalJSON(data []byte) (err error) {
 func (t Time) String() string {
 	return time.Time(t).UTC().Format("2006-01-02T15:04:05.000Z")
 }
+
+// FromNow returns the Time which is the given relative time expression from
+// now, e.g. "2 days 3 hours", "in 1 day" or "-30 minutes". See package
+// github.com/taskcluster/taskcluster-client-go/relativetime for the supported
+// syntax.
+func FromNow(expr string) (Time, error) {
+	t, err := relativetime.FromNow(expr)
+	return Time(t), err
+}
@@ -0,0 +1,319 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/slugid-go/slugid"
+)
+
+const (
+	// MaxDeadline is the furthest into the future, relative to its creation
+	// time, that the deadline of a task may be.
+	MaxDeadline = 5 * 24 * time.Hour
+	// DefaultDeadline is the deadline used by TaskBuilder, relative to the
+	// creation time of the task, if none is specified.
+	DefaultDeadline = 24 * time.Hour
+	// DefaultExpiry is the expiry used by TaskBuilder, relative to the
+	// deadline of the task, if none is specified. This matches the default
+	// applied by the queue.
+	DefaultExpiry = 365 * 24 * time.Hour
+)
+
+var (
+	// Syntax of taskIds and taskGroupIds
+	slugIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$`)
+	// Syntax of provisionerIds, workerTypes and schedulerIds
+	identifierPattern = regexp.MustCompile(`^([a-zA-Z0-9-_]{1,22})$`)
+	// Syntax of scopes
+	scopePattern = regexp.MustCompile(`^[\x20-\x7e]*$`)
+)
+
+// TaskDefinitionErrors lists all of the problems found when building a task
+// definition with TaskBuilder.Build.
+type TaskDefinitionErrors []error
+
+func (errs TaskDefinitionErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = "  * " + err.Error()
+	}
+	return fmt.Sprintf("invalid task definition (%v problems):\n%v", len(errs), strings.Join(lines, "\n"))
+}
+
+// TaskBuilder builds a TaskDefinition with sane defaults, validating the
+// result against the constraints of the queue's create-task-request schema.
+// Calls can be chained, and all problems are reported together by Build.
+// For example:
+//
+//	taskId, td, err := queue.NewTaskBuilder("aws-provisioner", "b2gtest").
+//		Metadata("Build", "Builds the thing", "me@example.com", "https://example.com/task.yml").
+//		Payload(dockerWorkerPayload).
+//		Deadline(3 * time.Hour).
+//		Build()
+//	if err != nil {
+//		// handle invalid task definition...
+//	}
+//	tsr, callSummary := myQueue.CreateTask(taskId, td)
+//
+// Unless specified, the builder generates a taskId, uses the taskId as
+// taskGroupId, sets created to the time Build is called, deadline to
+// DefaultDeadline after that, and expires to DefaultExpiry after the
+// deadline.
+type TaskBuilder struct {
+	taskId   string
+	created  time.Time
+	deadline time.Duration
+	expires  time.Duration
+	payload  interface{}
+	extra    interface{}
+	tags     map[string]string
+	td       TaskDefinition
+	errs     TaskDefinitionErrors
+}
+
+// NewTaskBuilder returns a TaskBuilder for a task to be run by the given
+// provisionerId and workerType.
+func NewTaskBuilder(provisionerId string, workerType string) *TaskBuilder {
+	b := &TaskBuilder{
+		deadline: DefaultDeadline,
+		expires:  DefaultExpiry,
+		tags:     map[string]string{},
+	}
+	b.td.ProvisionerId = provisionerId
+	b.td.WorkerType = workerType
+	b.td.SchedulerId = "-"
+	b.td.Retries = 5
+	b.td.Priority = json.RawMessage(`"normal"`)
+	b.td.Routes = []string{}
+	b.td.Scopes = []string{}
+	return b
+}
+
+// TaskId sets the taskId, rather than generating a new slugid.
+func (b *TaskBuilder) TaskId(taskId string) *TaskBuilder {
+	b.taskId = taskId
+	return b
+}
+
+// TaskGroupId sets the taskGroupId, which otherwise defaults to the taskId.
+func (b *TaskBuilder) TaskGroupId(taskGroupId string) *TaskBuilder {
+	b.td.TaskGroupId = taskGroupId
+	return b
+}
+
+// SchedulerId sets the schedulerId, which otherwise defaults to "-".
+func (b *TaskBuilder) SchedulerId(schedulerId string) *TaskBuilder {
+	b.td.SchedulerId = schedulerId
+	return b
+}
+
+// Metadata sets the (required) task metadata.
+func (b *TaskBuilder) Metadata(name, description, owner, source string) *TaskBuilder {
+	b.td.Metadata.Name = name
+	b.td.Metadata.Description = description
+	b.td.Metadata.Owner = owner
+	b.td.Metadata.Source = source
+	return b
+}
+
+// Payload sets the (required) worker-specific payload of the task. Payload
+// can be any value that can be marshaled to a json object, including a
+// json.RawMessage. If a payload type has been registered for the worker type
+// with RegisterPayload, Build checks that the payload is of that type, or
+// decodes to it.
+func (b *TaskBuilder) Payload(payload interface{}) *TaskBuilder {
+	b.payload = payload
+	return b
+}
+
+// Created sets the creation time of the task, rather than using the time at
+// which Build is called.
+func (b *TaskBuilder) Created(created time.Time) *TaskBuilder {
+	b.created = created
+	return b
+}
+
+// Deadline sets the deadline of the task, relative to its creation time. It
+// may be no more than MaxDeadline.
+func (b *TaskBuilder) Deadline(d time.Duration) *TaskBuilder {
+	b.deadline = d
+	return b
+}
+
+// Expires sets the expiry of the task, relative to its deadline.
+func (b *TaskBuilder) Expires(d time.Duration) *TaskBuilder {
+	b.expires = d
+	return b
+}
+
+// Priority sets the priority of the task, "normal" (the default) or "high".
+func (b *TaskBuilder) Priority(priority string) *TaskBuilder {
+	switch priority {
+	case "normal", "high":
+	default:
+		b.errs = append(b.errs, fmt.Errorf("priority must be \"normal\" or \"high\" but is %q", priority))
+	}
+	b.td.Priority = json.RawMessage(`"` + priority + `"`)
+	return b
+}
+
+// Retries sets the number of times to retry the task in case of
+// infrastructure issues (0-50, default 5).
+func (b *TaskBuilder) Retries(retries int) *TaskBuilder {
+	b.td.Retries = retries
+	return b
+}
+
+// Routes adds task specific routes.
+func (b *TaskBuilder) Routes(routes ...string) *TaskBuilder {
+	b.td.Routes = append(b.td.Routes, routes...)
+	return b
+}
+
+// Scopes adds scopes that the task is authorized to use.
+func (b *TaskBuilder) Scopes(scopes ...string) *TaskBuilder {
+	b.td.Scopes = append(b.td.Scopes, scopes...)
+	return b
+}
+
+// Tag sets an arbitrary key-value tag on the task.
+func (b *TaskBuilder) Tag(key, value string) *TaskBuilder {
+	b.tags[key] = value
+	return b
+}
+
+// Extra sets the extra data of the task. Extra can be any value that can be
+// marshaled to a json object.
+func (b *TaskBuilder) Extra(extra interface{}) *TaskBuilder {
+	b.extra = extra
+	return b
+}
+
+// Build validates the task definition, and returns it together with its
+// taskId. If any problems are found, they are all returned together as
+// TaskDefinitionErrors.
+func (b *TaskBuilder) Build() (string, *TaskDefinition, error) {
+	errs := append(TaskDefinitionErrors{}, b.errs...)
+	problem := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+	td := b.td
+
+	taskId := b.taskId
+	if taskId == "" {
+		taskId = slugid.Nice()
+	}
+	if !slugIdPattern.MatchString(taskId) {
+		problem("taskId %q is not a valid slugid", taskId)
+	}
+	if td.TaskGroupId == "" {
+		td.TaskGroupId = taskId
+	}
+	if !slugIdPattern.MatchString(td.TaskGroupId) {
+		problem("taskGroupId %q is not a valid slugid", td.TaskGroupId)
+	}
+	for _, id := range []struct{ name, value string }{
+		{"provisionerId", td.ProvisionerId},
+		{"workerType", td.WorkerType},
+		{"schedulerId", td.SchedulerId},
+	} {
+		if !identifierPattern.MatchString(id.value) {
+			problem("%v %q must be 1-22 characters from [a-zA-Z0-9-_]", id.name, id.value)
+		}
+	}
+
+	created := b.created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	if b.deadline <= 0 {
+		problem("deadline must be after creation time, but is %v after it", b.deadline)
+	}
+	if b.deadline > MaxDeadline {
+		problem("deadline may be no more than %v after creation time, but is %v after it", MaxDeadline, b.deadline)
+	}
+	if b.expires < 0 {
+		problem("expires may not be before deadline, but is %v after it", b.expires)
+	}
+	deadline := created.Add(b.deadline)
+	td.Created = Time(created)
+	td.Deadline = Time(deadline)
+	td.Expires = Time(deadline.Add(b.expires))
+
+	for _, field := range []struct {
+		name      string
+		value     string
+		maxLength int
+	}{
+		{"name", td.Metadata.Name, 255},
+		{"description", td.Metadata.Description, 32768},
+		{"owner", td.Metadata.Owner, 255},
+		{"source", td.Metadata.Source, 4096},
+	} {
+		if field.value == "" {
+			problem("metadata %v is required", field.name)
+		}
+		if len(field.value) > field.maxLength {
+			problem("metadata %v may be no more than %v characters", field.name, field.maxLength)
+		}
+	}
+
+	if td.Retries < 0 || td.Retries > 50 {
+		problem("retries must be between 0 and 50, but is %v", td.Retries)
+	}
+	for _, route := range td.Routes {
+		if len(route) < 1 || len(route) > 249 {
+			problem("route %q must be 1-249 characters", route)
+		}
+	}
+	for _, scope := range td.Scopes {
+		if !scopePattern.MatchString(scope) {
+			problem("scope %q must consist of printable ASCII characters", scope)
+		}
+	}
+	for key, value := range b.tags {
+		if len(value) > 4096 {
+			problem("tag %q may be no more than 4096 characters", key)
+		}
+	}
+
+	var err error
+	if b.payload == nil {
+		problem("payload is required")
+	} else if td.Payload, err = marshalObject(b.payload); err != nil {
+		problem("payload: %v", err)
+	} else if err = checkPayload(td.ProvisionerId, td.WorkerType, b.payload, td.Payload); err != nil {
+		problem("%v", err)
+	}
+	extra := b.extra
+	if extra == nil {
+		extra = map[string]interface{}{}
+	}
+	if td.Extra, err = marshalObject(extra); err != nil {
+		problem("extra: %v", err)
+	}
+	if td.Tags, err = json.Marshal(b.tags); err != nil {
+		problem("tags: %v", err)
+	}
+
+	if len(errs) > 0 {
+		return taskId, &td, errs
+	}
+	return taskId, &td, nil
+}
+
+// marshalObject marshals v, and checks that the result is a json object
+func marshalObject(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || data[0] != '{' {
+		return nil, fmt.Errorf("must be a json object, but is %s", data)
+	}
+	return json.RawMessage(data), nil
+}
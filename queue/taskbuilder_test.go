@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskBuilderDefaults(t *testing.T) {
+	created := time.Date(2015, 11, 5, 12, 0, 0, 0, time.UTC)
+	taskId, td, err := NewTaskBuilder("win-provisioner", "win2008-worker").
+		Metadata("[TC] Pete", "Stuff", "pmoore@mozilla.com", "http://everywhere.com/").
+		Payload(map[string]interface{}{"features": map[string]bool{"relengApiProxy": true}}).
+		Created(created).
+		Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if td.TaskGroupId != taskId {
+		t.Errorf("Expected taskGroupId to default to taskId %v, but was %v", taskId, td.TaskGroupId)
+	}
+	if d := time.Time(td.Deadline); !d.Equal(created.Add(DefaultDeadline)) {
+		t.Errorf("Unexpected deadline %v", d)
+	}
+	if e := time.Time(td.Expires); !e.Equal(created.Add(DefaultDeadline + DefaultExpiry)) {
+		t.Errorf("Unexpected expires %v", e)
+	}
+	data, err := json.Marshal(td)
+	if err != nil {
+		t.Fatalf("Could not marshal task definition: %v", err)
+	}
+	for _, expected := range []string{
+		`"payload":{"features":{"relengApiProxy":true}}`,
+		`"priority":"normal"`,
+		`"extra":{}`,
+		`"tags":{}`,
+		`"routes":[]`,
+		`"created":"2015-11-05T12:00:00.000Z"`,
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %v in task definition, but got %s", expected, data)
+		}
+	}
+}
+
+func TestTaskBuilderReportsAllProblems(t *testing.T) {
+	_, _, err := NewTaskBuilder("win.provisioner", "").
+		TaskGroupId("not-a-slug").
+		Payload([]string{"not", "an", "object"}).
+		Deadline(6 * 24 * time.Hour).
+		Retries(51).
+		Priority("urgent").
+		Build()
+	errs, ok := err.(TaskDefinitionErrors)
+	if !ok {
+		t.Fatalf("Expected TaskDefinitionErrors but got %v", err)
+	}
+	for _, expected := range []string{
+		"priority", "taskGroupId", "provisionerId", "workerType",
+		"deadline", "metadata name", "metadata owner", "retries", "payload",
+	} {
+		if !strings.Contains(errs.Error(), expected) {
+			t.Errorf("Expected a problem with %v to be reported, but got:\n%v", expected, errs)
+		}
+	}
+}
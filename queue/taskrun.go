@@ -0,0 +1,294 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ExceptionReason is the reason given when resolving a run as `exception`.
+// See TaskExceptionRequest for a description of when each reason should be
+// reported.
+type ExceptionReason string
+
+const (
+	// The worker had to shutdown prematurely; the queue will retry the task.
+	WorkerShutdown ExceptionReason = "worker-shutdown"
+	// The task payload is invalid, or references resources that do not exist.
+	MalformedPayload ExceptionReason = "malformed-payload"
+	// A resource needed by the task is temporarily unavailable.
+	ResourceUnavailable ExceptionReason = "resource-unavailable"
+	// The worker experienced an unhandled internal error.
+	InternalError ExceptionReason = "internal-error"
+)
+
+// ErrAlreadyResolved is returned (via CallSummary.Error) when a TaskRun is
+// resolved more than once.
+var ErrAlreadyResolved = errors.New("task run has already been resolved")
+
+// TaskException is an error which, when returned by the function passed to
+// TaskRun.Run, causes the run to be resolved as `exception` with the given
+// Reason. Any other non-nil error causes the run to be reported as `failed`.
+type TaskException struct {
+	Reason ExceptionReason
+	Err    error
+}
+
+func (e *TaskException) Error() string {
+	if e.Err == nil {
+		return "task exception: " + string(e.Reason)
+	}
+	return "task exception: " + string(e.Reason) + ": " + e.Err.Error()
+}
+
+// Exception returns an error which will cause TaskRun.Run to resolve the run
+// as `exception` with the given reason, e.g.
+//
+//	return queue.Exception(queue.MalformedPayload, err)
+func Exception(reason ExceptionReason, err error) error {
+	return &TaskException{Reason: reason, Err: err}
+}
+
+// ArtifactError reports the artifacts that could not be created or uploaded
+// for a run. A run with failed artifacts is never reported as `completed`.
+// Its message lists the artifacts ordered by name.
+type ArtifactError struct {
+	Errors map[string]error
+}
+
+func (e *ArtifactError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name, err := range e.Errors {
+		names = append(names, fmt.Sprintf("%v (%v)", name, err))
+	}
+	sort.Strings(names)
+	return "failed to upload artifacts: " + strings.Join(names, ", ")
+}
+
+// TaskRun is a handle to a claimed run of a task. It holds a Queue object
+// authenticated with the temporary credentials issued for the claim, tracks
+// artifact uploads for the run, and guarantees the run is resolved at most
+// once, and only after all artifact uploads have finished.
+//
+// A TaskRun is safe for concurrent use.
+type TaskRun struct {
+	// Queue client using the temporary credentials of the claim
+	Queue  *Queue
+	TaskId string
+	RunId  int
+	// The response of the original claim, which includes the task definition
+	Claim *TaskClaimResponse
+
+	mutex          sync.Mutex
+	resolved       bool
+	uploads        sync.WaitGroup
+	artifactErrors map[string]error
+	// outcome of resolving the run, set before finished is closed
+	resolution        *TaskStatusResponse
+	resolutionSummary *CallSummary
+	// closed once the run has been resolved, which happens some time after
+	// resolved is set, since uploads are waited for first
+	finished chan struct{}
+}
+
+// ClaimRun claims run runId of task taskId on behalf of the given worker, and
+// returns a TaskRun for managing the lifecycle of the claimed run.
+//
+// Required scopes:
+//   - queue:claim-task, and
+//   - assume:worker-type:<provisionerId>/<workerType>, and
+//   - assume:worker-id:<workerGroup>/<workerId>
+func (myQueue *Queue) ClaimRun(taskId string, runId int, workerGroup string, workerId string) (*TaskRun, *CallSummary) {
+	tcr, callSummary := myQueue.ClaimTask(taskId, strconv.Itoa(runId), &TaskClaimRequest{
+		WorkerGroup: workerGroup,
+		WorkerId:    workerId,
+	})
+	if callSummary.Error != nil {
+		return nil, callSummary
+	}
+	runQueue := New(tcr.Credentials.ClientId, tcr.Credentials.AccessToken)
+	runQueue.Certificate = tcr.Credentials.Certificate
+	runQueue.BaseURL = myQueue.BaseURL
+	return &TaskRun{
+		Queue:          runQueue,
+		TaskId:         taskId,
+		RunId:          tcr.RunId,
+		Claim:          tcr,
+		artifactErrors: make(map[string]error),
+		finished:       make(chan struct{}),
+	}, callSummary
+}
+
+func (run *TaskRun) runId() string {
+	return strconv.Itoa(run.RunId)
+}
+
+// queue returns the current run-scoped Queue, which changes on Reclaim
+func (run *TaskRun) queue() *Queue {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+	return run.Queue
+}
+
+// Reclaim reclaims the run, and replaces run.Queue with a Queue using the
+// new temporary credentials issued by the queue.
+func (run *TaskRun) Reclaim() (*TaskClaimResponse1, *CallSummary) {
+	current := run.queue()
+	tcr, callSummary := current.ReclaimTask(run.TaskId, run.runId())
+	if callSummary.Error != nil {
+		return tcr, callSummary
+	}
+	runQueue := New(tcr.Credentials.ClientId, tcr.Credentials.AccessToken)
+	runQueue.Certificate = tcr.Credentials.Certificate
+	runQueue.BaseURL = current.BaseURL
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+	run.Queue = runQueue
+	return tcr, callSummary
+}
+
+// CreateArtifact creates artifact name for this run, and then calls upload
+// (if not nil) with the response from the queue, e.g. to PUT the artifact
+// content to the signed S3 URL. This happens in a separate go routine; the
+// run will not be resolved until all artifacts have finished uploading.
+// Creating artifacts after the run has been resolved is not possible.
+func (run *TaskRun) CreateArtifact(name string, payload *PostArtifactRequest, upload func(*PostArtifactResponse) error) error {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+	if run.resolved {
+		return ErrAlreadyResolved
+	}
+	run.uploads.Add(1)
+	go func() {
+		defer run.uploads.Done()
+		par, callSummary := run.queue().CreateArtifact(run.TaskId, run.runId(), name, payload)
+		err := callSummary.Error
+		if err == nil && upload != nil {
+			err = upload(par)
+		}
+		if err != nil {
+			run.mutex.Lock()
+			run.artifactErrors[name] = err
+			run.mutex.Unlock()
+		}
+	}()
+	return nil
+}
+
+// Completed resolves the run as `completed`. If any artifact failed to
+// upload, the run is instead resolved as `exception` with reason
+// `resource-unavailable`, and callSummary.Error is an *ArtifactError.
+func (run *TaskRun) Completed() (*TaskStatusResponse, *CallSummary) {
+	return run.resolve("completed", "")
+}
+
+// Failed resolves the run as `failed`. Use this when the task specific code
+// behaved unexpectedly, for example it exited non-zero.
+func (run *TaskRun) Failed() (*TaskStatusResponse, *CallSummary) {
+	return run.resolve("failed", "")
+}
+
+// Exception resolves the run as `exception` with the given reason.
+func (run *TaskRun) Exception(reason ExceptionReason) (*TaskStatusResponse, *CallSummary) {
+	return run.resolve("exception", reason)
+}
+
+// Run calls f, and resolves the run according to its outcome:
+//
+//   - nil                    => completed
+//   - *TaskException         => exception, with the given reason
+//   - any other error        => failed
+//   - panic                  => exception, with reason internal-error
+//
+// In all cases, outstanding artifact uploads are waited for before the run
+// is resolved. The error (or recovered panic) from f is not returned; only
+// the outcome of resolving the run. If f has already resolved the run
+// itself, e.g. with Failed, the run is not resolved again, and the outcome
+// of that resolution is returned.
+func (run *TaskRun) Run(f func(run *TaskRun) error) (tsr *TaskStatusResponse, callSummary *CallSummary) {
+	defer func() {
+		if r := recover(); r != nil {
+			debug("Task %v run %v panicked: %v", run.TaskId, run.RunId, r)
+			if run.Resolved() {
+				tsr, callSummary = run.outcome()
+				return
+			}
+			tsr, callSummary = run.Exception(InternalError)
+		}
+	}()
+	err := f(run)
+	if run.Resolved() {
+		debug("Task %v run %v was resolved by f, which returned %v", run.TaskId, run.RunId, err)
+		return run.outcome()
+	}
+	switch e := err.(type) {
+	case nil:
+		return run.Completed()
+	case *TaskException:
+		return run.Exception(e.Reason)
+	default:
+		debug("Task %v run %v failed: %v", run.TaskId, run.RunId, err)
+		return run.Failed()
+	}
+}
+
+// outcome returns the outcome of resolving the run, waiting for the
+// resolution to finish, e.g. if it was started on another go routine
+func (run *TaskRun) outcome() (*TaskStatusResponse, *CallSummary) {
+	<-run.finished
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+	return run.resolution, run.resolutionSummary
+}
+
+// Resolved returns true if the run has been resolved via this TaskRun.
+func (run *TaskRun) Resolved() bool {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+	return run.resolved
+}
+
+func (run *TaskRun) resolve(state string, reason ExceptionReason) (*TaskStatusResponse, *CallSummary) {
+	run.mutex.Lock()
+	if run.resolved {
+		run.mutex.Unlock()
+		return nil, &CallSummary{Error: ErrAlreadyResolved}
+	}
+	// mark as resolved before waiting, so that no new artifacts can be added
+	run.resolved = true
+	run.mutex.Unlock()
+
+	run.uploads.Wait()
+
+	var artifactError error
+	if len(run.artifactErrors) > 0 {
+		artifactError = &ArtifactError{Errors: run.artifactErrors}
+		if state != "exception" {
+			state, reason = "exception", ResourceUnavailable
+		}
+	}
+
+	var tsr *TaskStatusResponse
+	var callSummary *CallSummary
+	switch state {
+	case "completed":
+		tsr, callSummary = run.queue().ReportCompleted(run.TaskId, run.runId())
+	case "failed":
+		tsr, callSummary = run.queue().ReportFailed(run.TaskId, run.runId())
+	default:
+		tsr, callSummary = run.queue().ReportException(run.TaskId, run.runId(), &TaskExceptionRequest{
+			Reason: string(reason),
+		})
+	}
+	if callSummary.Error == nil && artifactError != nil {
+		callSummary.Error = artifactError
+	}
+	run.mutex.Lock()
+	run.resolution, run.resolutionSummary = tsr, callSummary
+	run.mutex.Unlock()
+	close(run.finished)
+	return tsr, callSummary
+}
@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeQueue records the requests made against it, and responds with minimal
+// valid responses for the claim, artifact and resolution end-points.
+type fakeQueue struct {
+	sync.Mutex
+	requests []string
+}
+
+func (fq *fakeQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fq.Lock()
+	fq.requests = append(fq.requests, r.Method+" "+r.URL.Path)
+	fq.Unlock()
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/claim"):
+		w.Write([]byte(`{"runId": 0, "credentials": {"clientId": "c", "accessToken": "a", "certificate": "{}"}}`))
+	case strings.Contains(r.URL.Path, "/artifacts/"):
+		// give uploads a chance to still be in flight at resolution time
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"storageType": "s3"}`))
+	default:
+		w.Write([]byte(`{"status": {"taskId": "abc"}}`))
+	}
+}
+
+func (fq *fakeQueue) lastRequest() string {
+	fq.Lock()
+	defer fq.Unlock()
+	return fq.requests[len(fq.requests)-1]
+}
+
+func claimTestRun(t *testing.T) (*TaskRun, *fakeQueue, func()) {
+	fq := &fakeQueue{}
+	server := httptest.NewServer(fq)
+	myQueue := New("", "")
+	myQueue.BaseURL = server.URL
+	run, cs := myQueue.ClaimRun("abc", 0, "wg", "wi")
+	if cs.Error != nil {
+		server.Close()
+		t.Fatalf("Could not claim run: %v", cs.Error)
+	}
+	if run.Queue.Certificate != "{}" {
+		t.Errorf("Expected run-scoped queue to use temporary credentials, but certificate is %q", run.Queue.Certificate)
+	}
+	return run, fq, server.Close
+}
+
+func TestRunResolutions(t *testing.T) {
+	tests := []struct {
+		f        func(*TaskRun) error
+		expected string
+		body     string
+	}{
+		{func(*TaskRun) error { return nil }, "/completed", ""},
+		{func(*TaskRun) error { return errors.New("exit code 1") }, "/failed", ""},
+		{func(*TaskRun) error { return Exception(MalformedPayload, nil) }, "/exception", "malformed-payload"},
+		{func(*TaskRun) error { panic("oops") }, "/exception", "internal-error"},
+		// runs resolved by f are not resolved again
+		{func(run *TaskRun) error { run.Failed(); return nil }, "/failed", ""},
+		{func(run *TaskRun) error { run.Exception(MalformedPayload); panic("oops") }, "/exception", "malformed-payload"},
+	}
+	for _, test := range tests {
+		run, fq, closeServer := claimTestRun(t)
+		tsr, cs := run.Run(test.f)
+		closeServer()
+		if cs.Error != nil {
+			t.Fatalf("Unexpected error resolving run: %v", cs.Error)
+		}
+		if tsr.Status.TaskId != "abc" {
+			t.Errorf("Expected task status for task abc, but got %q", tsr.Status.TaskId)
+		}
+		if last := fq.lastRequest(); !strings.HasSuffix(last, test.expected) {
+			t.Errorf("Expected run to be resolved via %v, but last request was %v", test.expected, last)
+		}
+		if !strings.Contains(cs.HttpRequestBody, test.body) {
+			t.Errorf("Expected request body to contain %q, but got %q", test.body, cs.HttpRequestBody)
+		}
+	}
+}
+
+func TestArtifactErrorOrder(t *testing.T) {
+	err := &ArtifactError{Errors: map[string]error{
+		"public/logs/live.log": errors.New("timeout"),
+		"public/build.zip":     errors.New("disk full"),
+		"public/image.tar":     errors.New("forbidden"),
+	}}
+	expected := "failed to upload artifacts: public/build.zip (disk full), public/image.tar (forbidden), public/logs/live.log (timeout)"
+	if msg := err.Error(); msg != expected {
+		t.Errorf("Expected %q, but got %q", expected, msg)
+	}
+}
+
+func TestResolveOnlyOnce(t *testing.T) {
+	run, _, closeServer := claimTestRun(t)
+	defer closeServer()
+	if _, cs := run.Completed(); cs.Error != nil {
+		t.Fatalf("Unexpected error resolving run: %v", cs.Error)
+	}
+	if _, cs := run.Failed(); cs.Error != ErrAlreadyResolved {
+		t.Errorf("Expected ErrAlreadyResolved, but got %v", cs.Error)
+	}
+	if err := run.CreateArtifact("public/x", nil, nil); err != ErrAlreadyResolved {
+		t.Errorf("Expected ErrAlreadyResolved when creating artifact, but got %v", err)
+	}
+}
+
+func TestArtifactsUploadedBeforeResolution(t *testing.T) {
+	run, fq, closeServer := claimTestRun(t)
+	defer closeServer()
+	req := PostArtifactRequest(json.RawMessage(`{"storageType": "s3"}`))
+	uploaded := false
+	err := run.CreateArtifact("public/build.tar.gz", &req, func(*PostArtifactResponse) error {
+		uploaded = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating artifact: %v", err)
+	}
+	failing := run.CreateArtifact("public/log.txt", &req, func(*PostArtifactResponse) error {
+		return errors.New("S3 unavailable")
+	})
+	if failing != nil {
+		t.Fatalf("Unexpected error creating artifact: %v", failing)
+	}
+	_, cs := run.Completed()
+	if !uploaded {
+		t.Error("Run was resolved before artifact upload finished")
+	}
+	if _, ok := cs.Error.(*ArtifactError); !ok {
+		t.Errorf("Expected *ArtifactError, but got %v", cs.Error)
+	}
+	if last := fq.lastRequest(); !strings.HasSuffix(last, "/exception") {
+		t.Errorf("Expected run with failed artifact to be resolved as exception, but last request was %v", last)
+	}
+	if !strings.Contains(cs.HttpRequestBody, "resource-unavailable") {
+		t.Errorf("Expected reason resource-unavailable, but request body was %v", cs.HttpRequestBody)
+	}
+}
+
+func TestRunWaitsForResolutionInFlight(t *testing.T) {
+	run, fq, closeServer := claimTestRun(t)
+	defer closeServer()
+	req := PostArtifactRequest(json.RawMessage(`{"storageType": "s3"}`))
+	tsr, cs := run.Run(func(run *TaskRun) error {
+		if err := run.CreateArtifact("public/build.tar.gz", &req, nil); err != nil {
+			return err
+		}
+		// resolve on another go routine, and return while the artifact
+		// upload is still holding up the resolution
+		go run.Completed()
+		for !run.Resolved() {
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+	if tsr == nil || cs == nil {
+		t.Fatalf("Expected outcome of in-flight resolution, but got %v, %v", tsr, cs)
+	}
+	if cs.Error != nil {
+		t.Fatalf("Unexpected error resolving run: %v", cs.Error)
+	}
+	if last := fq.lastRequest(); !strings.HasSuffix(last, "/completed") {
+		t.Errorf("Expected run to be resolved via /completed, but last request was %v", last)
+	}
+}
@@ -0,0 +1,101 @@
+package queueevents
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+// acknowledger records how a delivery was acknowledged
+type acknowledger struct {
+	acked, nacked, requeued bool
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.nacked, a.requeued = true, requeue
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func deliver(handlers *Handlers, message interface{}, exchange, body string, redelivered bool) *acknowledger {
+	a := new(acknowledger)
+	handlers.Callback()(message, amqp.Delivery{
+		Acknowledger: a,
+		Exchange:     exchange,
+		Body:         []byte(body),
+		Redelivered:  redelivered,
+	})
+	return a
+}
+
+func TestHandlersDispatchAndAcknowledge(t *testing.T) {
+	var completed *TaskCompletedMessage
+	failure := errors.New("database unavailable")
+	handlers := &Handlers{
+		TaskCompleted: func(message *TaskCompletedMessage, delivery amqp.Delivery) error {
+			completed = message
+			return nil
+		},
+		TaskFailed: func(message *TaskFailedMessage, delivery amqp.Delivery) error {
+			return failure
+		},
+		TaskException: func(message *TaskExceptionMessage, delivery amqp.Delivery) error {
+			return &PermanentError{Err: failure}
+		},
+	}
+	exchange := TaskCompleted{}.ExchangeName()
+
+	// already decoded message, as passed by pulse
+	message := &TaskCompletedMessage{RunId: 2}
+	if a := deliver(handlers, message, exchange, `{}`, false); !a.acked || completed != message {
+		t.Errorf("Expected decoded message to be handled and acked, but got %#v, %#v", a, completed)
+	}
+	// undecoded message
+	if a := deliver(handlers, nil, exchange, `{"runId": 3, "status": {"taskId": "abc"}}`, false); !a.acked || completed.RunId != 3 || completed.Status.TaskId != "abc" {
+		t.Errorf("Expected body to be decoded, handled and acked, but got %#v, %#v", a, completed)
+	}
+	if a := deliver(handlers, nil, exchange, `not json`, false); !a.nacked || a.requeued {
+		t.Errorf("Expected undecodable message to be discarded, but got %#v", a)
+	}
+
+	failed := TaskFailed{}.ExchangeName()
+	if a := deliver(handlers, nil, failed, `{}`, false); !a.nacked || !a.requeued {
+		t.Errorf("Expected failed message to be requeued, but got %#v", a)
+	}
+	if a := deliver(handlers, nil, failed, `{}`, true); !a.nacked || a.requeued {
+		t.Errorf("Expected redelivered failed message to be discarded, but got %#v", a)
+	}
+	if a := deliver(handlers, nil, TaskException{}.ExchangeName(), `{}`, false); !a.nacked || a.requeued {
+		t.Errorf("Expected permanently failed message to be discarded, but got %#v", a)
+	}
+
+	handlers.Requeue = func(err error, delivery amqp.Delivery) bool { return true }
+	if a := deliver(handlers, nil, failed, `{}`, true); !a.nacked || !a.requeued {
+		t.Errorf("Expected custom requeue policy to requeue message, but got %#v", a)
+	}
+}
+
+func TestHandlersUnknownMessages(t *testing.T) {
+	handlers := &Handlers{}
+	// no handler for exchange, and no Unknown handler
+	if a := deliver(handlers, nil, TaskPending{}.ExchangeName(), `{}`, false); !a.acked {
+		t.Errorf("Expected unhandled message to be acked, but got %#v", a)
+	}
+	var unknown string
+	handlers.Unknown = func(message interface{}, delivery amqp.Delivery) error {
+		unknown = delivery.Exchange
+		return errors.New("unexpected message")
+	}
+	if a := deliver(handlers, nil, "exchange/build/normalized", `{}`, false); !a.nacked || !a.requeued || unknown != "exchange/build/normalized" {
+		t.Errorf("Expected Unknown to handle message, but got %#v, %q", a, unknown)
+	}
+}
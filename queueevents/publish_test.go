@@ -0,0 +1,178 @@
+package queueevents
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// published records a message published with recorder
+type published struct {
+	exchange, routingKey string
+	cc                   []string
+	body                 []byte
+}
+
+// recorder is a Publisher which records the messages published with it
+type recorder struct {
+	messages []published
+	err      error
+}
+
+func (r *recorder) Publish(exchange, routingKey string, cc []string, body []byte) error {
+	r.messages = append(r.messages, published{exchange, routingKey, cc, body})
+	return r.err
+}
+
+const completedMessage = `{
+	"version": 1,
+	"runId": 0,
+	"workerGroup": "us-west-2",
+	"workerId": "i-0123456789",
+	"status": {
+		"taskId": "fN1SbArXTPSVFNUvaOlinQ",
+		"provisionerId": "aws-provisioner",
+		"workerType": "gaia",
+		"schedulerId": "-",
+		"taskGroupId": "fN1SbArXTPSVFNUvaOlinQ",
+		"deadline": "2015-10-21T16:00:00.000Z",
+		"expires": "2016-10-21T16:00:00.000Z",
+		"retriesLeft": 5,
+		"state": "completed",
+		"runs": [{
+			"runId": 0,
+			"state": "completed",
+			"reasonCreated": "scheduled",
+			"reasonResolved": "completed",
+			"workerGroup": "us-west-2",
+			"workerId": "i-0123456789",
+			"takenUntil": "2015-10-21T15:20:00.000Z",
+			"scheduled": "2015-10-21T15:00:00.000Z",
+			"started": "2015-10-21T15:00:01.000Z",
+			"resolved": "2015-10-21T15:10:00.000Z"
+		}]
+	}
+}`
+
+func newCompletedMessage(t *testing.T) *TaskCompletedMessage {
+	message := new(TaskCompletedMessage)
+	if err := json.Unmarshal([]byte(completedMessage), message); err != nil {
+		t.Fatalf("Could not unmarshal message: %v", err)
+	}
+	return message
+}
+
+func completedBinding() TaskCompleted {
+	return TaskCompleted{
+		TaskId:        "fN1SbArXTPSVFNUvaOlinQ",
+		RunId:         "0",
+		WorkerGroup:   "us-west-2",
+		WorkerId:      "i-0123456789",
+		ProvisionerId: "aws-provisioner",
+		WorkerType:    "gaia",
+		SchedulerId:   "-",
+		TaskGroupId:   "fN1SbArXTPSVFNUvaOlinQ",
+	}
+}
+
+func TestPublish(t *testing.T) {
+	r := new(recorder)
+	message := newCompletedMessage(t)
+	if err := PublishTaskCompleted(r, completedBinding(), message, "notify.by-email", "index.gaia.latest"); err != nil {
+		t.Fatalf("Could not publish message: %v", err)
+	}
+	if len(r.messages) != 1 {
+		t.Fatalf("Expected 1 published message, but got %v", len(r.messages))
+	}
+	p := r.messages[0]
+	if p.exchange != "exchange/taskcluster-queue/v1/task-completed" {
+		t.Errorf("Published to wrong exchange %v", p.exchange)
+	}
+	if expected := "primary.fN1SbArXTPSVFNUvaOlinQ.0.us-west-2.i-0123456789.aws-provisioner.gaia.-.fN1SbArXTPSVFNUvaOlinQ._"; p.routingKey != expected {
+		t.Errorf("Expected routing key %v, but got %v", expected, p.routingKey)
+	}
+	if expected := []string{"route.notify.by-email", "route.index.gaia.latest"}; !reflect.DeepEqual(p.cc, expected) {
+		t.Errorf("Expected CC %v, but got %v", expected, p.cc)
+	}
+	decoded := new(TaskCompletedMessage)
+	if err := json.Unmarshal(p.body, decoded); err != nil || !reflect.DeepEqual(decoded, message) {
+		t.Errorf("Published body %s does not match message (%v)", p.body, err)
+	}
+	// published messages can be parsed by the consuming side
+	binding, err := ParseTaskCompleted(p.routingKey)
+	if err != nil || binding.Reserved != "_" || binding.WorkerType != "gaia" {
+		t.Errorf("Could not parse published routing key: %#v, %v", binding, err)
+	}
+}
+
+func TestPublishInvalidRoutingKey(t *testing.T) {
+	missing := completedBinding()
+	missing.WorkerId = ""
+	wildcard := completedBinding()
+	wildcard.WorkerType = "*"
+	dotted := completedBinding()
+	dotted.TaskId = "a.b"
+	for _, test := range []struct {
+		binding TaskCompleted
+		routes  []string
+		err     string
+	}{
+		{missing, nil, "WorkerId is required"},
+		{wildcard, nil, "may not contain wildcards"},
+		{dotted, nil, "may not contain a '.'"},
+		{completedBinding(), []string{"notify.#"}, "invalid route"},
+		{completedBinding(), []string{"notify..by-email"}, "invalid route"},
+	} {
+		r := new(recorder)
+		err := PublishTaskCompleted(r, test.binding, newCompletedMessage(t), test.routes...)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected error containing %q for %#v, %v, but got %v", test.err, test.binding, test.routes, err)
+		}
+		if len(r.messages) != 0 {
+			t.Errorf("Expected nothing to be published for %#v, %v", test.binding, test.routes)
+		}
+	}
+}
+
+func TestPublishInvalidMessage(t *testing.T) {
+	for _, test := range []struct {
+		change func(m *TaskCompletedMessage)
+		err    string
+	}{
+		{func(m *TaskCompletedMessage) { m.Version = 2 }, "version: "},
+		{func(m *TaskCompletedMessage) { m.WorkerId = "" }, "workerId: "},
+		{func(m *TaskCompletedMessage) { m.Status.State = "done" }, "status.state: "},
+		{func(m *TaskCompletedMessage) { m.Status.TaskId = "not-a-slug" }, "status.taskId: "},
+		{func(m *TaskCompletedMessage) { m.Status.RetriesLeft = -1 }, "status.retriesLeft: "},
+		{func(m *TaskCompletedMessage) { m.Status.Runs = nil }, "status.runs: "},
+		{func(m *TaskCompletedMessage) { m.Status.Runs[0].State = "" }, "status.runs.0.state: "},
+	} {
+		r := new(recorder)
+		message := newCompletedMessage(t)
+		test.change(message)
+		err := PublishTaskCompleted(r, completedBinding(), message)
+		if _, ok := err.(*SchemaError); !ok || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected *SchemaError containing %q, but got %v", test.err, err)
+		}
+		if len(r.messages) != 0 {
+			t.Errorf("Expected invalid message not to be published, for error %q", test.err)
+		}
+	}
+
+	// optional properties which are not set are not checked
+	message := newCompletedMessage(t)
+	message.Status.Runs[0].ReasonResolved = ""
+	message.Status.Runs[0].WorkerId = ""
+	if err := PublishTaskCompleted(new(recorder), completedBinding(), message); err != nil {
+		t.Errorf("Expected optional properties which are not set to be ignored, but got %v", err)
+	}
+}
+
+func TestPublishError(t *testing.T) {
+	r := &recorder{err: errors.New("connection closed")}
+	if err := PublishTaskCompleted(r, completedBinding(), newCompletedMessage(t)); err != r.err {
+		t.Errorf("Expected publisher error to be returned, but got %v", err)
+	}
+}
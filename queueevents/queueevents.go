@@ -85,13 +85,28 @@
 //
 // In addition, this means that you will also get objects in your callback method like *queueevents.TaskDefinedMessage
 // rather than just interface{}.
+//
+// Since the RoutingKey method of a binding cannot report errors, it panics if a field value is not a
+// valid routing key word, e.g. "a.b", rather than return the wrong routing key pattern. Check bindings
+// with ValidateBindings before subscribing with them, to get an error instead:
+//
+//  binding := queueevents.TaskDefined{WorkerType: workerType}
+//  if err := queueevents.ValidateBindings(binding); err != nil {
+//  	// handle error...
+//  }
 package queueevents
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/taskcluster-client-go/schemacheck"
+	"github.com/taskcluster/taskcluster-client-go/relativetime"
 )
 
 // When a task is created or just defined a message is posted to this
@@ -105,18 +120,20 @@ import (
 //
 // See http://docs.taskcluster.net/queue/exchanges/#taskDefined
 type TaskDefined struct {
-	RoutingKeyKind string `mwords:"*"`
-	TaskId         string `mwords:"*"`
+	RoutingKeyKind string `mwords:"*" constant:"primary" required:"true"`
+	TaskId         string `mwords:"*" required:"true"`
 	RunId          string `mwords:"*"`
 	WorkerGroup    string `mwords:"*"`
 	WorkerId       string `mwords:"*"`
-	ProvisionerId  string `mwords:"*"`
-	WorkerType     string `mwords:"*"`
-	SchedulerId    string `mwords:"*"`
-	TaskGroupId    string `mwords:"*"`
+	ProvisionerId  string `mwords:"*" required:"true"`
+	WorkerType     string `mwords:"*" required:"true"`
+	SchedulerId    string `mwords:"*" required:"true"`
+	TaskGroupId    string `mwords:"*" required:"true"`
 	Reserved       string `mwords:"#"`
 }
 
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Validate returns an error, rather than return the wrong pattern.
 func (binding TaskDefined) RoutingKey() string {
 	return generateRoutingKey(&binding)
 }
@@ -129,6 +146,40 @@ func (binding TaskDefined) NewPayloadObject() interface{} {
 	return new(TaskDefinedMessage)
 }
 
+// Validate returns an error if a field of the binding has a value which
+// would not result in the intended routing key pattern, e.g. a value
+// containing a '.'.
+func (binding TaskDefined) Validate() error {
+	return validateRoutingKey(&binding)
+}
+
+// ParseTaskDefined returns the TaskDefined binding with its fields set from
+// the primary routing key of a message from its exchange, such as
+// delivery.RoutingKey, so that they can be read without decoding the message
+// body.
+func ParseTaskDefined(routingKey string) (*TaskDefined, error) {
+	binding := new(TaskDefined)
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// taskDefinedSchema is the schema of messages for exchange
+// exchange/taskcluster-queue/v1/task-defined, with references resolved
+const taskDefinedSchema = `{"additionalProperties":false,"properties":{"status":{"additionalProperties":false,"properties":{"deadline":{"format":"date-time","type":"string"},"expires":{"format":"date-time","type":"string"},"provisionerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"retriesLeft":{"maximum":999,"minimum":0,"type":"integer"},"runs":{"items":{"additionalProperties":false,"properties":{"reasonCreated":{"enum":["scheduled","retry","rerun","exception"],"type":"string"},"reasonResolved":{"enum":["completed","failed","deadline-exceeded","canceled","claim-expired","worker-shutdown","malformed-payload","resource-unavailable","internal-error"],"type":"string"},"resolved":{"format":"date-time","type":"string"},"runId":{"maximum":1000,"minimum":0,"type":"integer"},"scheduled":{"format":"date-time","type":"string"},"started":{"format":"date-time","type":"string"},"state":{"enum":["pending","running","completed","failed","exception"],"type":"string"},"takenUntil":{"format":"date-time","type":"string"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["runId","state","reasonCreated","scheduled"],"type":"object"},"type":"array"},"schedulerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"state":{"enum":["unscheduled","pending","running","completed","failed","exception"],"type":"string"},"taskGroupId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"taskId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"workerType":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["taskId","provisionerId","workerType","schedulerId","taskGroupId","deadline","expires","retriesLeft","state","runs"],"type":"object"},"version":{"enum":[1],"type":"integer"}},"required":["version","status"],"type":"object"}`
+
+// PublishTaskDefined publishes message with publisher, after checking it
+// against the schema of its exchange, to exchange
+// exchange/taskcluster-queue/v1/task-defined
+//
+// The routing key is made from the fields of binding, which may not contain
+// wildcards, and the message is CC'ed to `route.<route>` for each of the
+// given task specific routes.
+func PublishTaskDefined(publisher Publisher, binding TaskDefined, message *TaskDefinedMessage, routes ...string) error {
+	return publish(publisher, binding.ExchangeName(), &binding, message, taskDefinedSchema, routes)
+}
+
 // When a task becomes `pending` a message is posted to this exchange.
 //
 // This is useful for workers who doesn't want to constantly poll the queue
@@ -139,18 +190,20 @@ func (binding TaskDefined) NewPayloadObject() interface{} {
 //
 // See http://docs.taskcluster.net/queue/exchanges/#taskPending
 type TaskPending struct {
-	RoutingKeyKind string `mwords:"*"`
-	TaskId         string `mwords:"*"`
-	RunId          string `mwords:"*"`
+	RoutingKeyKind string `mwords:"*" constant:"primary" required:"true"`
+	TaskId         string `mwords:"*" required:"true"`
+	RunId          string `mwords:"*" required:"true"`
 	WorkerGroup    string `mwords:"*"`
 	WorkerId       string `mwords:"*"`
-	ProvisionerId  string `mwords:"*"`
-	WorkerType     string `mwords:"*"`
-	SchedulerId    string `mwords:"*"`
-	TaskGroupId    string `mwords:"*"`
+	ProvisionerId  string `mwords:"*" required:"true"`
+	WorkerType     string `mwords:"*" required:"true"`
+	SchedulerId    string `mwords:"*" required:"true"`
+	TaskGroupId    string `mwords:"*" required:"true"`
 	Reserved       string `mwords:"#"`
 }
 
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Validate returns an error, rather than return the wrong pattern.
 func (binding TaskPending) RoutingKey() string {
 	return generateRoutingKey(&binding)
 }
@@ -163,23 +216,59 @@ func (binding TaskPending) NewPayloadObject() interface{} {
 	return new(TaskPendingMessage)
 }
 
+// Validate returns an error if a field of the binding has a value which
+// would not result in the intended routing key pattern, e.g. a value
+// containing a '.'.
+func (binding TaskPending) Validate() error {
+	return validateRoutingKey(&binding)
+}
+
+// ParseTaskPending returns the TaskPending binding with its fields set from
+// the primary routing key of a message from its exchange, such as
+// delivery.RoutingKey, so that they can be read without decoding the message
+// body.
+func ParseTaskPending(routingKey string) (*TaskPending, error) {
+	binding := new(TaskPending)
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// taskPendingSchema is the schema of messages for exchange
+// exchange/taskcluster-queue/v1/task-pending, with references resolved
+const taskPendingSchema = `{"additionalProperties":false,"properties":{"runId":{"maximum":1000,"minimum":0,"type":"integer"},"status":{"additionalProperties":false,"properties":{"deadline":{"format":"date-time","type":"string"},"expires":{"format":"date-time","type":"string"},"provisionerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"retriesLeft":{"maximum":999,"minimum":0,"type":"integer"},"runs":{"items":{"additionalProperties":false,"properties":{"reasonCreated":{"enum":["scheduled","retry","rerun","exception"],"type":"string"},"reasonResolved":{"enum":["completed","failed","deadline-exceeded","canceled","claim-expired","worker-shutdown","malformed-payload","resource-unavailable","internal-error"],"type":"string"},"resolved":{"format":"date-time","type":"string"},"runId":{"maximum":1000,"minimum":0,"type":"integer"},"scheduled":{"format":"date-time","type":"string"},"started":{"format":"date-time","type":"string"},"state":{"enum":["pending","running","completed","failed","exception"],"type":"string"},"takenUntil":{"format":"date-time","type":"string"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["runId","state","reasonCreated","scheduled"],"type":"object"},"type":"array"},"schedulerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"state":{"enum":["unscheduled","pending","running","completed","failed","exception"],"type":"string"},"taskGroupId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"taskId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"workerType":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["taskId","provisionerId","workerType","schedulerId","taskGroupId","deadline","expires","retriesLeft","state","runs"],"type":"object"},"version":{"enum":[1],"type":"integer"}},"required":["version","status","runId"],"type":"object"}`
+
+// PublishTaskPending publishes message with publisher, after checking it
+// against the schema of its exchange, to exchange
+// exchange/taskcluster-queue/v1/task-pending
+//
+// The routing key is made from the fields of binding, which may not contain
+// wildcards, and the message is CC'ed to `route.<route>` for each of the
+// given task specific routes.
+func PublishTaskPending(publisher Publisher, binding TaskPending, message *TaskPendingMessage, routes ...string) error {
+	return publish(publisher, binding.ExchangeName(), &binding, message, taskPendingSchema, routes)
+}
+
 // Whenever a task is claimed by a worker, a run is started on the worker,
 // and a message is posted on this exchange.
 //
 // See http://docs.taskcluster.net/queue/exchanges/#taskRunning
 type TaskRunning struct {
-	RoutingKeyKind string `mwords:"*"`
-	TaskId         string `mwords:"*"`
-	RunId          string `mwords:"*"`
-	WorkerGroup    string `mwords:"*"`
-	WorkerId       string `mwords:"*"`
-	ProvisionerId  string `mwords:"*"`
-	WorkerType     string `mwords:"*"`
-	SchedulerId    string `mwords:"*"`
-	TaskGroupId    string `mwords:"*"`
+	RoutingKeyKind string `mwords:"*" constant:"primary" required:"true"`
+	TaskId         string `mwords:"*" required:"true"`
+	RunId          string `mwords:"*" required:"true"`
+	WorkerGroup    string `mwords:"*" required:"true"`
+	WorkerId       string `mwords:"*" required:"true"`
+	ProvisionerId  string `mwords:"*" required:"true"`
+	WorkerType     string `mwords:"*" required:"true"`
+	SchedulerId    string `mwords:"*" required:"true"`
+	TaskGroupId    string `mwords:"*" required:"true"`
 	Reserved       string `mwords:"#"`
 }
 
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Validate returns an error, rather than return the wrong pattern.
 func (binding TaskRunning) RoutingKey() string {
 	return generateRoutingKey(&binding)
 }
@@ -192,6 +281,40 @@ func (binding TaskRunning) NewPayloadObject() interface{} {
 	return new(TaskRunningMessage)
 }
 
+// Validate returns an error if a field of the binding has a value which
+// would not result in the intended routing key pattern, e.g. a value
+// containing a '.'.
+func (binding TaskRunning) Validate() error {
+	return validateRoutingKey(&binding)
+}
+
+// ParseTaskRunning returns the TaskRunning binding with its fields set from
+// the primary routing key of a message from its exchange, such as
+// delivery.RoutingKey, so that they can be read without decoding the message
+// body.
+func ParseTaskRunning(routingKey string) (*TaskRunning, error) {
+	binding := new(TaskRunning)
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// taskRunningSchema is the schema of messages for exchange
+// exchange/taskcluster-queue/v1/task-running, with references resolved
+const taskRunningSchema = `{"additionalProperties":false,"properties":{"runId":{"maximum":1000,"minimum":0,"type":"integer"},"status":{"additionalProperties":false,"properties":{"deadline":{"format":"date-time","type":"string"},"expires":{"format":"date-time","type":"string"},"provisionerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"retriesLeft":{"maximum":999,"minimum":0,"type":"integer"},"runs":{"items":{"additionalProperties":false,"properties":{"reasonCreated":{"enum":["scheduled","retry","rerun","exception"],"type":"string"},"reasonResolved":{"enum":["completed","failed","deadline-exceeded","canceled","claim-expired","worker-shutdown","malformed-payload","resource-unavailable","internal-error"],"type":"string"},"resolved":{"format":"date-time","type":"string"},"runId":{"maximum":1000,"minimum":0,"type":"integer"},"scheduled":{"format":"date-time","type":"string"},"started":{"format":"date-time","type":"string"},"state":{"enum":["pending","running","completed","failed","exception"],"type":"string"},"takenUntil":{"format":"date-time","type":"string"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["runId","state","reasonCreated","scheduled"],"type":"object"},"type":"array"},"schedulerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"state":{"enum":["unscheduled","pending","running","completed","failed","exception"],"type":"string"},"taskGroupId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"taskId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"workerType":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["taskId","provisionerId","workerType","schedulerId","taskGroupId","deadline","expires","retriesLeft","state","runs"],"type":"object"},"takenUntil":{"format":"date-time","type":"string"},"version":{"enum":[1],"type":"integer"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["version","status","runId","workerGroup","workerId","takenUntil"],"type":"object"}`
+
+// PublishTaskRunning publishes message with publisher, after checking it
+// against the schema of its exchange, to exchange
+// exchange/taskcluster-queue/v1/task-running
+//
+// The routing key is made from the fields of binding, which may not contain
+// wildcards, and the message is CC'ed to `route.<route>` for each of the
+// given task specific routes.
+func PublishTaskRunning(publisher Publisher, binding TaskRunning, message *TaskRunningMessage, routes ...string) error {
+	return publish(publisher, binding.ExchangeName(), &binding, message, taskRunningSchema, routes)
+}
+
 // Whenever the `createArtifact` end-point is called, the queue will create
 // a record of the artifact and post a message on this exchange. All of this
 // happens before the queue returns a signed URL for the caller to upload
@@ -213,18 +336,20 @@ func (binding TaskRunning) NewPayloadObject() interface{} {
 //
 // See http://docs.taskcluster.net/queue/exchanges/#artifactCreated
 type ArtifactCreated struct {
-	RoutingKeyKind string `mwords:"*"`
-	TaskId         string `mwords:"*"`
-	RunId          string `mwords:"*"`
-	WorkerGroup    string `mwords:"*"`
-	WorkerId       string `mwords:"*"`
-	ProvisionerId  string `mwords:"*"`
-	WorkerType     string `mwords:"*"`
-	SchedulerId    string `mwords:"*"`
-	TaskGroupId    string `mwords:"*"`
+	RoutingKeyKind string `mwords:"*" constant:"primary" required:"true"`
+	TaskId         string `mwords:"*" required:"true"`
+	RunId          string `mwords:"*" required:"true"`
+	WorkerGroup    string `mwords:"*" required:"true"`
+	WorkerId       string `mwords:"*" required:"true"`
+	ProvisionerId  string `mwords:"*" required:"true"`
+	WorkerType     string `mwords:"*" required:"true"`
+	SchedulerId    string `mwords:"*" required:"true"`
+	TaskGroupId    string `mwords:"*" required:"true"`
 	Reserved       string `mwords:"#"`
 }
 
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Validate returns an error, rather than return the wrong pattern.
 func (binding ArtifactCreated) RoutingKey() string {
 	return generateRoutingKey(&binding)
 }
@@ -237,6 +362,40 @@ func (binding ArtifactCreated) NewPayloadObject() interface{} {
 	return new(ArtifactCreatedMessage)
 }
 
+// Validate returns an error if a field of the binding has a value which
+// would not result in the intended routing key pattern, e.g. a value
+// containing a '.'.
+func (binding ArtifactCreated) Validate() error {
+	return validateRoutingKey(&binding)
+}
+
+// ParseArtifactCreated returns the ArtifactCreated binding with its fields set from
+// the primary routing key of a message from its exchange, such as
+// delivery.RoutingKey, so that they can be read without decoding the message
+// body.
+func ParseArtifactCreated(routingKey string) (*ArtifactCreated, error) {
+	binding := new(ArtifactCreated)
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// artifactCreatedSchema is the schema of messages for exchange
+// exchange/taskcluster-queue/v1/artifact-created, with references resolved
+const artifactCreatedSchema = `{"additionalProperties":false,"properties":{"artifact":{"additionalProperties":false,"properties":{"contentType":{"maxLength":255,"type":"string"},"expires":{"format":"date-time","type":"string"},"name":{"maxLength":1024,"type":"string"},"storageType":{"enum":["s3","azure","reference","error"],"type":"string"}},"required":["storageType","name","expires","contentType"],"type":"object"},"runId":{"maximum":1000,"minimum":0,"type":"integer"},"status":{"additionalProperties":false,"properties":{"deadline":{"format":"date-time","type":"string"},"expires":{"format":"date-time","type":"string"},"provisionerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"retriesLeft":{"maximum":999,"minimum":0,"type":"integer"},"runs":{"items":{"additionalProperties":false,"properties":{"reasonCreated":{"enum":["scheduled","retry","rerun","exception"],"type":"string"},"reasonResolved":{"enum":["completed","failed","deadline-exceeded","canceled","claim-expired","worker-shutdown","malformed-payload","resource-unavailable","internal-error"],"type":"string"},"resolved":{"format":"date-time","type":"string"},"runId":{"maximum":1000,"minimum":0,"type":"integer"},"scheduled":{"format":"date-time","type":"string"},"started":{"format":"date-time","type":"string"},"state":{"enum":["pending","running","completed","failed","exception"],"type":"string"},"takenUntil":{"format":"date-time","type":"string"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["runId","state","reasonCreated","scheduled"],"type":"object"},"type":"array"},"schedulerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"state":{"enum":["unscheduled","pending","running","completed","failed","exception"],"type":"string"},"taskGroupId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"taskId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"workerType":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["taskId","provisionerId","workerType","schedulerId","taskGroupId","deadline","expires","retriesLeft","state","runs"],"type":"object"},"version":{"enum":[1],"type":"integer"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["version","status","runId","workerGroup","workerId","artifact"],"type":"object"}`
+
+// PublishArtifactCreated publishes message with publisher, after checking it
+// against the schema of its exchange, to exchange
+// exchange/taskcluster-queue/v1/artifact-created
+//
+// The routing key is made from the fields of binding, which may not contain
+// wildcards, and the message is CC'ed to `route.<route>` for each of the
+// given task specific routes.
+func PublishArtifactCreated(publisher Publisher, binding ArtifactCreated, message *ArtifactCreatedMessage, routes ...string) error {
+	return publish(publisher, binding.ExchangeName(), &binding, message, artifactCreatedSchema, routes)
+}
+
 // When a task is successfully completed by a worker a message is posted
 // this exchange.
 // This message is routed using the `runId`, `workerGroup` and `workerId`
@@ -245,18 +404,20 @@ func (binding ArtifactCreated) NewPayloadObject() interface{} {
 //
 // See http://docs.taskcluster.net/queue/exchanges/#taskCompleted
 type TaskCompleted struct {
-	RoutingKeyKind string `mwords:"*"`
-	TaskId         string `mwords:"*"`
-	RunId          string `mwords:"*"`
-	WorkerGroup    string `mwords:"*"`
-	WorkerId       string `mwords:"*"`
-	ProvisionerId  string `mwords:"*"`
-	WorkerType     string `mwords:"*"`
-	SchedulerId    string `mwords:"*"`
-	TaskGroupId    string `mwords:"*"`
+	RoutingKeyKind string `mwords:"*" constant:"primary" required:"true"`
+	TaskId         string `mwords:"*" required:"true"`
+	RunId          string `mwords:"*" required:"true"`
+	WorkerGroup    string `mwords:"*" required:"true"`
+	WorkerId       string `mwords:"*" required:"true"`
+	ProvisionerId  string `mwords:"*" required:"true"`
+	WorkerType     string `mwords:"*" required:"true"`
+	SchedulerId    string `mwords:"*" required:"true"`
+	TaskGroupId    string `mwords:"*" required:"true"`
 	Reserved       string `mwords:"#"`
 }
 
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Validate returns an error, rather than return the wrong pattern.
 func (binding TaskCompleted) RoutingKey() string {
 	return generateRoutingKey(&binding)
 }
@@ -269,24 +430,60 @@ func (binding TaskCompleted) NewPayloadObject() interface{} {
 	return new(TaskCompletedMessage)
 }
 
+// Validate returns an error if a field of the binding has a value which
+// would not result in the intended routing key pattern, e.g. a value
+// containing a '.'.
+func (binding TaskCompleted) Validate() error {
+	return validateRoutingKey(&binding)
+}
+
+// ParseTaskCompleted returns the TaskCompleted binding with its fields set from
+// the primary routing key of a message from its exchange, such as
+// delivery.RoutingKey, so that they can be read without decoding the message
+// body.
+func ParseTaskCompleted(routingKey string) (*TaskCompleted, error) {
+	binding := new(TaskCompleted)
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// taskCompletedSchema is the schema of messages for exchange
+// exchange/taskcluster-queue/v1/task-completed, with references resolved
+const taskCompletedSchema = `{"additionalProperties":false,"properties":{"runId":{"maximum":1000,"minimum":0,"type":"integer"},"status":{"additionalProperties":false,"properties":{"deadline":{"format":"date-time","type":"string"},"expires":{"format":"date-time","type":"string"},"provisionerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"retriesLeft":{"maximum":999,"minimum":0,"type":"integer"},"runs":{"items":{"additionalProperties":false,"properties":{"reasonCreated":{"enum":["scheduled","retry","rerun","exception"],"type":"string"},"reasonResolved":{"enum":["completed","failed","deadline-exceeded","canceled","claim-expired","worker-shutdown","malformed-payload","resource-unavailable","internal-error"],"type":"string"},"resolved":{"format":"date-time","type":"string"},"runId":{"maximum":1000,"minimum":0,"type":"integer"},"scheduled":{"format":"date-time","type":"string"},"started":{"format":"date-time","type":"string"},"state":{"enum":["pending","running","completed","failed","exception"],"type":"string"},"takenUntil":{"format":"date-time","type":"string"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["runId","state","reasonCreated","scheduled"],"type":"object"},"type":"array"},"schedulerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"state":{"enum":["unscheduled","pending","running","completed","failed","exception"],"type":"string"},"taskGroupId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"taskId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"workerType":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["taskId","provisionerId","workerType","schedulerId","taskGroupId","deadline","expires","retriesLeft","state","runs"],"type":"object"},"version":{"enum":[1],"type":"integer"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["version","status","runId","workerGroup","workerId"],"type":"object"}`
+
+// PublishTaskCompleted publishes message with publisher, after checking it
+// against the schema of its exchange, to exchange
+// exchange/taskcluster-queue/v1/task-completed
+//
+// The routing key is made from the fields of binding, which may not contain
+// wildcards, and the message is CC'ed to `route.<route>` for each of the
+// given task specific routes.
+func PublishTaskCompleted(publisher Publisher, binding TaskCompleted, message *TaskCompletedMessage, routes ...string) error {
+	return publish(publisher, binding.ExchangeName(), &binding, message, taskCompletedSchema, routes)
+}
+
 // When a task ran, but failed to complete successfully a message is posted
 // to this exchange. This is same as worker ran task-specific code, but the
 // task specific code exited non-zero.
 //
 // See http://docs.taskcluster.net/queue/exchanges/#taskFailed
 type TaskFailed struct {
-	RoutingKeyKind string `mwords:"*"`
-	TaskId         string `mwords:"*"`
+	RoutingKeyKind string `mwords:"*" constant:"primary" required:"true"`
+	TaskId         string `mwords:"*" required:"true"`
 	RunId          string `mwords:"*"`
 	WorkerGroup    string `mwords:"*"`
 	WorkerId       string `mwords:"*"`
-	ProvisionerId  string `mwords:"*"`
-	WorkerType     string `mwords:"*"`
-	SchedulerId    string `mwords:"*"`
-	TaskGroupId    string `mwords:"*"`
+	ProvisionerId  string `mwords:"*" required:"true"`
+	WorkerType     string `mwords:"*" required:"true"`
+	SchedulerId    string `mwords:"*" required:"true"`
+	TaskGroupId    string `mwords:"*" required:"true"`
 	Reserved       string `mwords:"#"`
 }
 
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Validate returns an error, rather than return the wrong pattern.
 func (binding TaskFailed) RoutingKey() string {
 	return generateRoutingKey(&binding)
 }
@@ -299,6 +496,40 @@ func (binding TaskFailed) NewPayloadObject() interface{} {
 	return new(TaskFailedMessage)
 }
 
+// Validate returns an error if a field of the binding has a value which
+// would not result in the intended routing key pattern, e.g. a value
+// containing a '.'.
+func (binding TaskFailed) Validate() error {
+	return validateRoutingKey(&binding)
+}
+
+// ParseTaskFailed returns the TaskFailed binding with its fields set from
+// the primary routing key of a message from its exchange, such as
+// delivery.RoutingKey, so that they can be read without decoding the message
+// body.
+func ParseTaskFailed(routingKey string) (*TaskFailed, error) {
+	binding := new(TaskFailed)
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// taskFailedSchema is the schema of messages for exchange
+// exchange/taskcluster-queue/v1/task-failed, with references resolved
+const taskFailedSchema = `{"additionalProperties":false,"properties":{"runId":{"maximum":1000,"minimum":0,"type":"integer"},"status":{"additionalProperties":false,"properties":{"deadline":{"format":"date-time","type":"string"},"expires":{"format":"date-time","type":"string"},"provisionerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"retriesLeft":{"maximum":999,"minimum":0,"type":"integer"},"runs":{"items":{"additionalProperties":false,"properties":{"reasonCreated":{"enum":["scheduled","retry","rerun","exception"],"type":"string"},"reasonResolved":{"enum":["completed","failed","deadline-exceeded","canceled","claim-expired","worker-shutdown","malformed-payload","resource-unavailable","internal-error"],"type":"string"},"resolved":{"format":"date-time","type":"string"},"runId":{"maximum":1000,"minimum":0,"type":"integer"},"scheduled":{"format":"date-time","type":"string"},"started":{"format":"date-time","type":"string"},"state":{"enum":["pending","running","completed","failed","exception"],"type":"string"},"takenUntil":{"format":"date-time","type":"string"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["runId","state","reasonCreated","scheduled"],"type":"object"},"type":"array"},"schedulerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"state":{"enum":["unscheduled","pending","running","completed","failed","exception"],"type":"string"},"taskGroupId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"taskId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"workerType":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["taskId","provisionerId","workerType","schedulerId","taskGroupId","deadline","expires","retriesLeft","state","runs"],"type":"object"},"version":{"enum":[1],"type":"integer"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["version","status","runId","workerGroup","workerId"],"type":"object"}`
+
+// PublishTaskFailed publishes message with publisher, after checking it
+// against the schema of its exchange, to exchange
+// exchange/taskcluster-queue/v1/task-failed
+//
+// The routing key is made from the fields of binding, which may not contain
+// wildcards, and the message is CC'ed to `route.<route>` for each of the
+// given task specific routes.
+func PublishTaskFailed(publisher Publisher, binding TaskFailed, message *TaskFailedMessage, routes ...string) error {
+	return publish(publisher, binding.ExchangeName(), &binding, message, taskFailedSchema, routes)
+}
+
 // Whenever TaskCluster fails to run a message is posted to this exchange.
 // This happens if the task isn't completed before its `deadlìne`,
 // all retries failed (i.e. workers stopped responding), the task was
@@ -309,18 +540,20 @@ func (binding TaskFailed) NewPayloadObject() interface{} {
 //
 // See http://docs.taskcluster.net/queue/exchanges/#taskException
 type TaskException struct {
-	RoutingKeyKind string `mwords:"*"`
-	TaskId         string `mwords:"*"`
+	RoutingKeyKind string `mwords:"*" constant:"primary" required:"true"`
+	TaskId         string `mwords:"*" required:"true"`
 	RunId          string `mwords:"*"`
 	WorkerGroup    string `mwords:"*"`
 	WorkerId       string `mwords:"*"`
-	ProvisionerId  string `mwords:"*"`
-	WorkerType     string `mwords:"*"`
-	SchedulerId    string `mwords:"*"`
-	TaskGroupId    string `mwords:"*"`
+	ProvisionerId  string `mwords:"*" required:"true"`
+	WorkerType     string `mwords:"*" required:"true"`
+	SchedulerId    string `mwords:"*" required:"true"`
+	TaskGroupId    string `mwords:"*" required:"true"`
 	Reserved       string `mwords:"#"`
 }
 
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Validate returns an error, rather than return the wrong pattern.
 func (binding TaskException) RoutingKey() string {
 	return generateRoutingKey(&binding)
 }
@@ -333,7 +566,47 @@ func (binding TaskException) NewPayloadObject() interface{} {
 	return new(TaskExceptionMessage)
 }
 
+// Validate returns an error if a field of the binding has a value which
+// would not result in the intended routing key pattern, e.g. a value
+// containing a '.'.
+func (binding TaskException) Validate() error {
+	return validateRoutingKey(&binding)
+}
+
+// ParseTaskException returns the TaskException binding with its fields set from
+// the primary routing key of a message from its exchange, such as
+// delivery.RoutingKey, so that they can be read without decoding the message
+// body.
+func ParseTaskException(routingKey string) (*TaskException, error) {
+	binding := new(TaskException)
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// taskExceptionSchema is the schema of messages for exchange
+// exchange/taskcluster-queue/v1/task-exception, with references resolved
+const taskExceptionSchema = `{"additionalProperties":false,"properties":{"runId":{"maximum":1000,"minimum":0,"type":"integer"},"status":{"additionalProperties":false,"properties":{"deadline":{"format":"date-time","type":"string"},"expires":{"format":"date-time","type":"string"},"provisionerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"retriesLeft":{"maximum":999,"minimum":0,"type":"integer"},"runs":{"items":{"additionalProperties":false,"properties":{"reasonCreated":{"enum":["scheduled","retry","rerun","exception"],"type":"string"},"reasonResolved":{"enum":["completed","failed","deadline-exceeded","canceled","claim-expired","worker-shutdown","malformed-payload","resource-unavailable","internal-error"],"type":"string"},"resolved":{"format":"date-time","type":"string"},"runId":{"maximum":1000,"minimum":0,"type":"integer"},"scheduled":{"format":"date-time","type":"string"},"started":{"format":"date-time","type":"string"},"state":{"enum":["pending","running","completed","failed","exception"],"type":"string"},"takenUntil":{"format":"date-time","type":"string"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["runId","state","reasonCreated","scheduled"],"type":"object"},"type":"array"},"schedulerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"state":{"enum":["unscheduled","pending","running","completed","failed","exception"],"type":"string"},"taskGroupId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"taskId":{"pattern":"^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$","type":"string"},"workerType":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["taskId","provisionerId","workerType","schedulerId","taskGroupId","deadline","expires","retriesLeft","state","runs"],"type":"object"},"version":{"enum":[1],"type":"integer"},"workerGroup":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"},"workerId":{"maxLength":22,"minLength":1,"pattern":"^([a-zA-Z0-9-_]*)$","type":"string"}},"required":["version","status"],"type":"object"}`
+
+// PublishTaskException publishes message with publisher, after checking it
+// against the schema of its exchange, to exchange
+// exchange/taskcluster-queue/v1/task-exception
+//
+// The routing key is made from the fields of binding, which may not contain
+// wildcards, and the message is CC'ed to `route.<route>` for each of the
+// given task specific routes.
+func PublishTaskException(publisher Publisher, binding TaskException, message *TaskExceptionMessage, routes ...string) error {
+	return publish(publisher, binding.ExchangeName(), &binding, message, taskExceptionSchema, routes)
+}
+
+// generateRoutingKey returns the routing key pattern of binding x. It panics
+// if validateRoutingKey returns an error, so that a binding with an invalid
+// field value is never bound with the wrong pattern.
 func generateRoutingKey(x interface{}) string {
+	if err := validateRoutingKey(x); err != nil {
+		panic(err)
+	}
 	val := reflect.ValueOf(x).Elem()
 	p := make([]string, 0, val.NumField())
 	for i := 0; i < val.NumField(); i++ {
@@ -342,7 +615,11 @@ func generateRoutingKey(x interface{}) string {
 		tag := typeField.Tag
 		if t := tag.Get("mwords"); t != "" {
 			if v := valueField.Interface(); v == "" {
-				p = append(p, t)
+				if c := tag.Get("constant"); c != "" {
+					p = append(p, c)
+				} else {
+					p = append(p, t)
+				}
 			} else {
 				p = append(p, v.(string))
 			}
@@ -351,6 +628,472 @@ func generateRoutingKey(x interface{}) string {
 	return strings.Join(p, ".")
 }
 
+// validateRoutingKey returns an error if a field of binding x has a value
+// which would not result in the intended routing key pattern: a single-word
+// field containing a '.', a '*' or '#' which is not a whole word (or a '#'
+// in a single-word field), a constant field with a value other than its
+// constant, or a required field with value '_', which is only used for
+// values that are not present.
+func validateRoutingKey(x interface{}) error {
+	val := reflect.ValueOf(x).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		mwords := field.Tag.Get("mwords")
+		value := val.Field(i).String()
+		if mwords == "" || value == "" {
+			continue
+		}
+		if mwords == "*" && strings.Contains(value, ".") {
+			return fmt.Errorf("%v.%v %q may not contain a '.', since it is a single word of the routing key", val.Type(), field.Name, value)
+		}
+		if c := field.Tag.Get("constant"); c != "" && value != c {
+			return fmt.Errorf("%v.%v is always %q, but is %q", val.Type(), field.Name, c, value)
+		}
+		if field.Tag.Get("required") == "true" && value == "_" {
+			return fmt.Errorf("%v.%v is required, so is never %q", val.Type(), field.Name, value)
+		}
+		for _, word := range strings.Split(value, ".") {
+			if word == "" || word != "*" && word != "#" && strings.ContainsAny(word, "*#") || word == "#" && mwords == "*" {
+				return fmt.Errorf("%v.%v %q has invalid word %q", val.Type(), field.Name, value, word)
+			}
+		}
+	}
+	return nil
+}
+
+// CCRoute is a binding for messages from the exchange of Binding which are
+// CC'ed to the task specific route `route.<Route>`, i.e. messages about
+// tasks with Route in their TaskDefinition.Routes. Route may contain the
+// wildcards * and #, and the routing key fields of Binding are ignored, e.g.
+//
+//  queueevents.CCRoute{Binding: queueevents.TaskDefined{}, Route: "notify.by-email"}
+type CCRoute struct {
+	Binding interface {
+		ExchangeName() string
+		NewPayloadObject() interface{}
+	}
+	Route string
+}
+
+// RoutingKey returns the routing key pattern of the binding. It panics if
+// Route is not a valid route pattern.
+func (binding CCRoute) RoutingKey() string {
+	if err := validateRoute(binding.Route); err != nil {
+		panic(err)
+	}
+	return "route." + binding.Route
+}
+
+func (binding CCRoute) ExchangeName() string {
+	return binding.Binding.ExchangeName()
+}
+
+func (binding CCRoute) NewPayloadObject() interface{} {
+	return binding.Binding.NewPayloadObject()
+}
+
+// Validate returns an error if Binding is not set, or Route is not a valid
+// route pattern.
+func (binding CCRoute) Validate() error {
+	if binding.Binding == nil {
+		return errors.New("CCRoute has no Binding")
+	}
+	return validateRoute(binding.Route)
+}
+
+// validateRoute returns an error if route is not a valid route pattern.
+func validateRoute(route string) error {
+	for _, word := range strings.Split(route, ".") {
+		if word == "" || word != "*" && word != "#" && strings.ContainsAny(word, "*#") {
+			return fmt.Errorf("CCRoute has invalid route %q", route)
+		}
+	}
+	return nil
+}
+
+// ValidateBindings returns the first error returned by the Validate method
+// of the given bindings, if any. Since the RoutingKey method of a binding
+// panics if it is not valid, call ValidateBindings before passing bindings
+// to pulse.Connection.Consume. Bindings without a Validate method are
+// skipped.
+func ValidateBindings(bindings ...interface{}) error {
+	for _, binding := range bindings {
+		if v, ok := binding.(interface {
+			Validate() error
+		}); ok {
+			if err := v.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseRoutingKey sets the fields of binding x from the words of routingKey,
+// i.e. it is the inverse of generateRoutingKey. A multi-word field gets all
+// words not taken by the other fields, which may be none.
+func parseRoutingKey(routingKey string, x interface{}) error {
+	if strings.HasPrefix(routingKey, "route.") {
+		return &CCRouteError{RoutingKey: routingKey}
+	}
+	val := reflect.ValueOf(x).Elem()
+	fields := []int{}
+	multi := -1
+	for i := 0; i < val.NumField(); i++ {
+		switch val.Type().Field(i).Tag.Get("mwords") {
+		case "#":
+			multi = len(fields)
+			fields = append(fields, i)
+		case "*":
+			fields = append(fields, i)
+		}
+	}
+	words := strings.Split(routingKey, ".")
+	if multi == -1 && len(words) != len(fields) || multi >= 0 && len(words) < len(fields)-1 {
+		return fmt.Errorf("routing key %q has %v words, which does not match %v", routingKey, len(words), val.Type())
+	}
+	// number of fields after the multi-word field
+	after := len(fields) - 1 - multi
+	for j, i := range fields {
+		switch {
+		case multi == -1 || j < multi:
+			val.Field(i).SetString(words[j])
+		case j == multi:
+			val.Field(i).SetString(strings.Join(words[j:len(words)-after], "."))
+		default:
+			val.Field(i).SetString(words[len(words)-len(fields)+j])
+		}
+		if c := val.Type().Field(i).Tag.Get("constant"); c != "" && val.Field(i).String() != c {
+			return fmt.Errorf("routing key %q does not match %v, which always has %v %q", routingKey, val.Type(), val.Type().Field(i).Name, c)
+		}
+	}
+	return nil
+}
+
+// CCRouteError is returned when parsing a routing key which is a task
+// specific route that a message was CC'ed to, e.g. `route.notify.by-email`,
+// rather than a primary routing key.
+type CCRouteError struct {
+	RoutingKey string
+}
+
+func (err *CCRouteError) Error() string {
+	return fmt.Sprintf("routing key %q is a CC'ed task specific route, not a primary routing key", err.RoutingKey)
+}
+
+// CCRoutes returns the task specific routes, without their `route.` prefix,
+// that a delivered message was CC'ed to.
+func CCRoutes(delivery amqp.Delivery) []string {
+	routes := []string{}
+	cc, _ := delivery.Headers["CC"].([]interface{})
+	for _, key := range cc {
+		if route, ok := key.(string); ok && strings.HasPrefix(route, "route.") {
+			routes = append(routes, strings.TrimPrefix(route, "route."))
+		}
+	}
+	return routes
+}
+
+// ParseRoutingKey returns the binding of the given exchange, e.g. *TaskDefined,
+// with its fields set from routingKey, which must be the primary routing key
+// of a message from the exchange, such as delivery.RoutingKey.
+func ParseRoutingKey(exchange, routingKey string) (interface{}, error) {
+	var binding interface{}
+	switch exchange {
+	case "exchange/taskcluster-queue/v1/task-defined":
+		binding = new(TaskDefined)
+	case "exchange/taskcluster-queue/v1/task-pending":
+		binding = new(TaskPending)
+	case "exchange/taskcluster-queue/v1/task-running":
+		binding = new(TaskRunning)
+	case "exchange/taskcluster-queue/v1/artifact-created":
+		binding = new(ArtifactCreated)
+	case "exchange/taskcluster-queue/v1/task-completed":
+		binding = new(TaskCompleted)
+	case "exchange/taskcluster-queue/v1/task-failed":
+		binding = new(TaskFailed)
+	case "exchange/taskcluster-queue/v1/task-exception":
+		binding = new(TaskException)
+	default:
+		return nil, fmt.Errorf("unknown exchange %v", exchange)
+	}
+	if err := parseRoutingKey(routingKey, binding); err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// Handlers dispatches pulse messages from the exchanges of this package to
+// type-safe handler functions, and acknowledges them according to the
+// result. Set a handler for each exchange of interest, and pass
+// handlers.Callback() to pulse.Connection.Consume with autoAck false, e.g.
+//
+//  handlers := &queueevents.Handlers{
+//  	TaskDefined: func(message *queueevents.TaskDefinedMessage, delivery amqp.Delivery) error {
+//  		// handle message...
+//  	},
+//  }
+//  conn.Consume("my-queue", handlers.Callback(), 1, false, queueevents.TaskDefined{})
+//
+// A handler returning nil acknowledges the message. A handler returning an
+// error negatively acknowledges it, requeueing it if the Requeue policy says
+// so.
+type Handlers struct {
+	// Handles messages from exchange exchange/taskcluster-queue/v1/task-defined
+	TaskDefined func(message *TaskDefinedMessage, delivery amqp.Delivery) error
+	// Handles messages from exchange exchange/taskcluster-queue/v1/task-pending
+	TaskPending func(message *TaskPendingMessage, delivery amqp.Delivery) error
+	// Handles messages from exchange exchange/taskcluster-queue/v1/task-running
+	TaskRunning func(message *TaskRunningMessage, delivery amqp.Delivery) error
+	// Handles messages from exchange exchange/taskcluster-queue/v1/artifact-created
+	ArtifactCreated func(message *ArtifactCreatedMessage, delivery amqp.Delivery) error
+	// Handles messages from exchange exchange/taskcluster-queue/v1/task-completed
+	TaskCompleted func(message *TaskCompletedMessage, delivery amqp.Delivery) error
+	// Handles messages from exchange exchange/taskcluster-queue/v1/task-failed
+	TaskFailed func(message *TaskFailedMessage, delivery amqp.Delivery) error
+	// Handles messages from exchange exchange/taskcluster-queue/v1/task-exception
+	TaskException func(message *TaskExceptionMessage, delivery amqp.Delivery) error
+	// Handles messages from exchanges without a handler, if not nil;
+	// otherwise such messages are acknowledged and dropped
+	Unknown func(message interface{}, delivery amqp.Delivery) error
+	// Decides whether a message that could not be handled is requeued (true)
+	// or discarded (false); DefaultRequeue is used if nil
+	Requeue func(err error, delivery amqp.Delivery) bool
+}
+
+// DecodeError is returned by Handlers.Handle when a message body cannot be
+// decoded into the message type of its exchange.
+type DecodeError struct {
+	Exchange string
+	Err      error
+}
+
+func (err *DecodeError) Error() string {
+	return fmt.Sprintf("could not decode message from exchange %v: %v", err.Exchange, err.Err)
+}
+
+// Permanent reports that decoding the message would fail again, so that
+// consumers such as pulseconsumer.Supervisor do not retry it.
+func (err *DecodeError) Permanent() bool {
+	return true
+}
+
+// PermanentError can be returned by a handler to signal that handling the
+// message would fail again, so it should not be requeued.
+type PermanentError struct {
+	Err error
+}
+
+func (err *PermanentError) Error() string {
+	return err.Err.Error()
+}
+
+// Permanent reports that handling the message would fail again, so that
+// consumers such as pulseconsumer.Supervisor do not retry it.
+func (err *PermanentError) Permanent() bool {
+	return true
+}
+
+// DefaultRequeue requeues a message that could not be handled, unless err is
+// a *DecodeError or *PermanentError, or the message has already been
+// redelivered, so that each message is retried at most once.
+func DefaultRequeue(err error, delivery amqp.Delivery) bool {
+	switch err.(type) {
+	case *DecodeError, *PermanentError:
+		return false
+	}
+	return !delivery.Redelivered
+}
+
+// Handle calls the handler for the exchange of the delivery, decoding
+// delivery.Body if message is not already of the message type of the
+// exchange, and returns the handler's error. Handle does not acknowledge the
+// message, so it can also be used when consuming with autoAck.
+func (handlers *Handlers) Handle(message interface{}, delivery amqp.Delivery) error {
+	switch delivery.Exchange {
+	case "exchange/taskcluster-queue/v1/task-defined":
+		if handlers.TaskDefined != nil {
+			m, ok := message.(*TaskDefinedMessage)
+			if !ok {
+				m = new(TaskDefinedMessage)
+				if err := json.Unmarshal(delivery.Body, m); err != nil {
+					return &DecodeError{Exchange: delivery.Exchange, Err: err}
+				}
+			}
+			return handlers.TaskDefined(m, delivery)
+		}
+	case "exchange/taskcluster-queue/v1/task-pending":
+		if handlers.TaskPending != nil {
+			m, ok := message.(*TaskPendingMessage)
+			if !ok {
+				m = new(TaskPendingMessage)
+				if err := json.Unmarshal(delivery.Body, m); err != nil {
+					return &DecodeError{Exchange: delivery.Exchange, Err: err}
+				}
+			}
+			return handlers.TaskPending(m, delivery)
+		}
+	case "exchange/taskcluster-queue/v1/task-running":
+		if handlers.TaskRunning != nil {
+			m, ok := message.(*TaskRunningMessage)
+			if !ok {
+				m = new(TaskRunningMessage)
+				if err := json.Unmarshal(delivery.Body, m); err != nil {
+					return &DecodeError{Exchange: delivery.Exchange, Err: err}
+				}
+			}
+			return handlers.TaskRunning(m, delivery)
+		}
+	case "exchange/taskcluster-queue/v1/artifact-created":
+		if handlers.ArtifactCreated != nil {
+			m, ok := message.(*ArtifactCreatedMessage)
+			if !ok {
+				m = new(ArtifactCreatedMessage)
+				if err := json.Unmarshal(delivery.Body, m); err != nil {
+					return &DecodeError{Exchange: delivery.Exchange, Err: err}
+				}
+			}
+			return handlers.ArtifactCreated(m, delivery)
+		}
+	case "exchange/taskcluster-queue/v1/task-completed":
+		if handlers.TaskCompleted != nil {
+			m, ok := message.(*TaskCompletedMessage)
+			if !ok {
+				m = new(TaskCompletedMessage)
+				if err := json.Unmarshal(delivery.Body, m); err != nil {
+					return &DecodeError{Exchange: delivery.Exchange, Err: err}
+				}
+			}
+			return handlers.TaskCompleted(m, delivery)
+		}
+	case "exchange/taskcluster-queue/v1/task-failed":
+		if handlers.TaskFailed != nil {
+			m, ok := message.(*TaskFailedMessage)
+			if !ok {
+				m = new(TaskFailedMessage)
+				if err := json.Unmarshal(delivery.Body, m); err != nil {
+					return &DecodeError{Exchange: delivery.Exchange, Err: err}
+				}
+			}
+			return handlers.TaskFailed(m, delivery)
+		}
+	case "exchange/taskcluster-queue/v1/task-exception":
+		if handlers.TaskException != nil {
+			m, ok := message.(*TaskExceptionMessage)
+			if !ok {
+				m = new(TaskExceptionMessage)
+				if err := json.Unmarshal(delivery.Body, m); err != nil {
+					return &DecodeError{Exchange: delivery.Exchange, Err: err}
+				}
+			}
+			return handlers.TaskException(m, delivery)
+		}
+	}
+	if handlers.Unknown != nil {
+		return handlers.Unknown(message, delivery)
+	}
+	return nil
+}
+
+// Callback returns a callback for pulse.Connection.Consume, which calls
+// Handle, and acknowledges the message if it was handled successfully, or
+// else negatively acknowledges it, requeueing it if the Requeue policy says
+// so. Consume must be called with autoAck false.
+func (handlers *Handlers) Callback() func(message interface{}, delivery amqp.Delivery) {
+	return func(message interface{}, delivery amqp.Delivery) {
+		err := handlers.Handle(message, delivery)
+		if err == nil {
+			delivery.Ack(false)
+			return
+		}
+		requeue := handlers.Requeue
+		if requeue == nil {
+			requeue = DefaultRequeue
+		}
+		delivery.Nack(false, requeue(err, delivery))
+	}
+}
+
+// Publisher publishes a message body to an exchange with a routing key,
+// CC'ed to further routing keys, e.g. `route.<route>` for task specific
+// routes. The Publish functions of this package publish through a
+// Publisher, such as a *pulsetest.Broker. On top of amqp, a Publisher would
+// publish body as an application/json message, with the cc routing keys in
+// its "CC" header.
+type Publisher interface {
+	Publish(exchange, routingKey string, cc []string, body []byte) error
+}
+
+// SchemaError is returned by the Publish functions when a message does not
+// conform to the schema of its exchange.
+type SchemaError struct {
+	Exchange string
+	Err      error
+}
+
+func (err *SchemaError) Error() string {
+	return fmt.Sprintf("message for exchange %v does not conform to its schema: %v", err.Exchange, err.Err)
+}
+
+// publish publishes message to exchange with publisher, with the routing key
+// of binding x, after checking the message against schema.
+func publish(publisher Publisher, exchange string, x interface{}, message interface{}, schema string, routes []string) error {
+	routingKey, err := publishRoutingKey(x)
+	if err != nil {
+		return err
+	}
+	cc := make([]string, len(routes))
+	for i, route := range routes {
+		for _, word := range strings.Split(route, ".") {
+			if word == "" || strings.ContainsAny(word, "*#") {
+				return fmt.Errorf("cannot publish to invalid route %q", route)
+			}
+		}
+		cc[i] = "route." + route
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if err := schemacheck.Validate(schema, body); err != nil {
+		return &SchemaError{Exchange: exchange, Err: err}
+	}
+	return publisher.Publish(exchange, routingKey, cc, body)
+}
+
+// publishRoutingKey returns the routing key for publishing a message with
+// the routing key fields of binding x. A routing key for publishing may not
+// contain wildcards, so fields which are not set are published as '_', as
+// the TaskCluster services do for values that are not present, except that
+// required fields must be set.
+func publishRoutingKey(x interface{}) (string, error) {
+	if err := validateRoutingKey(x); err != nil {
+		return "", err
+	}
+	val := reflect.ValueOf(x).Elem()
+	p := make([]string, 0, val.NumField())
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		if field.Tag.Get("mwords") == "" {
+			continue
+		}
+		value := val.Field(i).String()
+		if value == "" {
+			value = field.Tag.Get("constant")
+		}
+		switch {
+		case value == "" && field.Tag.Get("required") == "true":
+			return "", fmt.Errorf("%v.%v is required to publish a message", val.Type(), field.Name)
+		case value == "":
+			value = "_"
+		case strings.ContainsAny(value, "*#"):
+			return "", fmt.Errorf("%v.%v %q may not contain wildcards when publishing a message", val.Type(), field.Name, value)
+		}
+		p = append(p, value)
+	}
+	return strings.Join(p, "."), nil
+}
+
 type (
 	// Message reporting a new artifact has been created for a given task.
 	//
@@ -668,3 +1411,12 @@ func (t *Time) UnmarshalJSON(data []byte) (err error) {
 func (t Time) String() string {
 	return time.Time(t).UTC().Format("2006-01-02T15:04:05.000Z")
 }
+
+// FromNow returns the Time which is the given relative time expression from
+// now, e.g. "2 days 3 hours", "in 1 day" or "-30 minutes". See package
+// github.com/taskcluster/taskcluster-client-go/relativetime for the supported
+// syntax.
+func FromNow(expr string) (Time, error) {
+	t, err := relativetime.FromNow(expr)
+	return Time(t), err
+}
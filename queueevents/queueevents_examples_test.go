@@ -12,6 +12,12 @@ func Example_taskClusterSniffer() {
 	// empty user => use PULSE_USERNAME env var
 	// empty password => use PULSE_PASSWORD env var
 	// empty url => connect to production
+	// RoutingKey cannot report invalid binding fields, so check them first
+	defined := TaskDefined{WorkerType: "gaia", ProvisionerId: "aws-provisioner"}
+	running := TaskRunning{WorkerType: "gaia", ProvisionerId: "aws-provisioner"}
+	if err := ValidateBindings(defined, running); err != nil {
+		panic(err)
+	}
 	conn := pulse.NewConnection("", "", "")
 	conn.Consume(
 		"taskprocessing", // queue name
@@ -30,8 +36,8 @@ func Example_taskClusterSniffer() {
 		},
 		1,     // prefetch 1 message at a time
 		false, // don't auto-acknowledge messages
-		TaskDefined{WorkerType: "gaia", ProvisionerId: "aws-provisioner"},
-		TaskRunning{WorkerType: "gaia", ProvisionerId: "aws-provisioner"})
+		defined,
+		running)
 	conn.Consume( // a second workflow to manage concurrently
 		"", // empty name implies anonymous queue
 		func(message interface{}, delivery amqp.Delivery) { // simpler callback than before
@@ -47,3 +53,32 @@ func Example_taskClusterSniffer() {
 	forever := make(chan bool)
 	<-forever
 }
+
+func Example_handlers() {
+	handlers := &Handlers{
+		TaskCompleted: func(message *TaskCompletedMessage, delivery amqp.Delivery) error {
+			fmt.Println("Task " + message.Status.TaskId + " completed")
+			return nil
+		},
+		TaskFailed: func(message *TaskFailedMessage, delivery amqp.Delivery) error {
+			fmt.Println("Task " + message.Status.TaskId + " failed")
+			return nil
+		},
+	}
+	completed := TaskCompleted{WorkerType: "gaia"}
+	failed := TaskFailed{WorkerType: "gaia"}
+	if err := ValidateBindings(completed, failed); err != nil {
+		panic(err)
+	}
+	conn := pulse.NewConnection("", "", "")
+	conn.Consume(
+		"taskresolutions",
+		handlers.Callback(), // messages are acked/nacked based on handler result
+		1,                   // prefetch
+		false,               // handlers acknowledge messages
+		completed,
+		failed)
+	// wait forever
+	forever := make(chan bool)
+	<-forever
+}
@@ -0,0 +1,145 @@
+package queueevents
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestParseRoutingKey(t *testing.T) {
+	binding, err := ParseTaskCompleted("primary.Gu3BJf0IQeuJE-HFKtYI2A.0.us-west-2.i-0a1b2c3d.aws-provisioner.gaia.task-graph-scheduler.Gu3BJf0IQeuJE-HFKtYI2A.extra.words")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := &TaskCompleted{
+		RoutingKeyKind: "primary",
+		TaskId:         "Gu3BJf0IQeuJE-HFKtYI2A",
+		RunId:          "0",
+		WorkerGroup:    "us-west-2",
+		WorkerId:       "i-0a1b2c3d",
+		ProvisionerId:  "aws-provisioner",
+		WorkerType:     "gaia",
+		SchedulerId:    "task-graph-scheduler",
+		TaskGroupId:    "Gu3BJf0IQeuJE-HFKtYI2A",
+		Reserved:       "extra.words",
+	}
+	if !reflect.DeepEqual(binding, expected) {
+		t.Errorf("Expected %#v but got %#v", expected, binding)
+	}
+
+	// reserved words are optional
+	binding, err = ParseTaskCompleted("primary.Gu3BJf0IQeuJE-HFKtYI2A.0.us-west-2.i-0a1b2c3d.aws-provisioner.gaia.task-graph-scheduler.Gu3BJf0IQeuJE-HFKtYI2A")
+	if err != nil || binding.Reserved != "" || binding.TaskGroupId != "Gu3BJf0IQeuJE-HFKtYI2A" {
+		t.Errorf("Expected routing key without reserved words to parse, but got %#v, %v", binding, err)
+	}
+	if key := binding.RoutingKey(); key != "primary.Gu3BJf0IQeuJE-HFKtYI2A.0.us-west-2.i-0a1b2c3d.aws-provisioner.gaia.task-graph-scheduler.Gu3BJf0IQeuJE-HFKtYI2A.#" {
+		t.Errorf("Unexpected routing key of parsed binding: %v", key)
+	}
+
+	if _, err := ParseTaskCompleted("primary.Gu3BJf0IQeuJE-HFKtYI2A.0"); err == nil {
+		t.Error("Expected error for routing key with too few words")
+	}
+	if _, err := ParseTaskCompleted("route.notify.by-email"); err == nil {
+		t.Error("Expected error for CC'ed routing key")
+	} else if _, ok := err.(*CCRouteError); !ok {
+		t.Errorf("Expected *CCRouteError but got %v", err)
+	}
+}
+
+func TestParseRoutingKeyByExchange(t *testing.T) {
+	binding, err := ParseRoutingKey(ArtifactCreated{}.ExchangeName(), "primary.abc.1.wg.wi.p.wt.s.g._")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	artifactCreated, ok := binding.(*ArtifactCreated)
+	if !ok || artifactCreated.RunId != "1" || artifactCreated.Reserved != "_" {
+		t.Errorf("Unexpected binding %#v", binding)
+	}
+	if _, err := ParseRoutingKey("exchange/build/normalized", "a.b"); err == nil {
+		t.Error("Expected error for unknown exchange")
+	}
+}
+
+func TestCCRoutes(t *testing.T) {
+	delivery := amqp.Delivery{
+		Headers: amqp.Table{"CC": []interface{}{"route.index.gecko.latest", "route.notify.by-email", "other"}},
+	}
+	if routes := CCRoutes(delivery); !reflect.DeepEqual(routes, []string{"index.gecko.latest", "notify.by-email"}) {
+		t.Errorf("Unexpected routes %v", routes)
+	}
+	if routes := CCRoutes(amqp.Delivery{}); len(routes) != 0 {
+		t.Errorf("Expected no routes, but got %v", routes)
+	}
+}
+
+func TestRoutingKeyFillsConstants(t *testing.T) {
+	key := TaskCompleted{WorkerType: "gaia"}.RoutingKey()
+	if key != "primary.*.*.*.*.*.gaia.*.*.#" {
+		t.Errorf("Unexpected routing key %v", key)
+	}
+	if _, err := ParseTaskCompleted("secondary.a.0.wg.wi.p.wt.s.g"); err == nil {
+		t.Error("Expected error for routing key without constant primary")
+	}
+}
+
+func TestValidateBindings(t *testing.T) {
+	for _, binding := range []interface{}{
+		TaskCompleted{WorkerType: "gaia", ProvisionerId: "aws-provisioner"},
+		TaskCompleted{TaskId: "*", Reserved: "#"},
+		TaskCompleted{RoutingKeyKind: "primary", Reserved: "a.*.b"},
+		TaskDefined{RunId: "_"},
+		CCRoute{Binding: TaskCompleted{}, Route: "index.gecko.#"},
+	} {
+		if err := ValidateBindings(binding); err != nil {
+			t.Errorf("Expected %#v to be valid, but got %v", binding, err)
+		}
+	}
+	for _, binding := range []interface{}{
+		TaskCompleted{WorkerType: "gaia.ubuntu"},
+		TaskCompleted{RoutingKeyKind: "route"},
+		TaskCompleted{TaskId: "_"},
+		TaskCompleted{WorkerType: "#"},
+		TaskCompleted{WorkerType: "gaia*"},
+		TaskCompleted{Reserved: "a..b"},
+		CCRoute{Route: "notify.by-email"},
+		CCRoute{Binding: TaskCompleted{}, Route: ""},
+		CCRoute{Binding: TaskCompleted{}, Route: "index.gecko*"},
+	} {
+		if err := ValidateBindings(binding); err == nil {
+			t.Errorf("Expected %#v to be invalid", binding)
+		}
+	}
+}
+
+func TestRoutingKeyPanicsForInvalidBindings(t *testing.T) {
+	for _, binding := range []interface {
+		RoutingKey() string
+	}{
+		TaskCompleted{WorkerType: "gaia.ubuntu"},
+		TaskCompleted{TaskId: "_"},
+		CCRoute{Binding: TaskCompleted{}, Route: "index.gecko*"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected RoutingKey of %#v to panic", binding)
+				}
+			}()
+			binding.RoutingKey()
+		}()
+	}
+}
+
+func TestCCRoute(t *testing.T) {
+	binding := CCRoute{Binding: TaskFailed{}, Route: "notify.by-email"}
+	if key := binding.RoutingKey(); key != "route.notify.by-email" {
+		t.Errorf("Unexpected routing key %v", key)
+	}
+	if exchange := binding.ExchangeName(); exchange != "exchange/taskcluster-queue/v1/task-failed" {
+		t.Errorf("Unexpected exchange %v", exchange)
+	}
+	if _, ok := binding.NewPayloadObject().(*TaskFailedMessage); !ok {
+		t.Errorf("Unexpected payload object %T", binding.NewPayloadObject())
+	}
+}
@@ -0,0 +1,233 @@
+// Package relativetime parses TaskCluster-style relative time expressions,
+// such as "2 days 3 hours" or "-30 minutes", as used by the fromNow function
+// of the javascript taskcluster-client.
+//
+// An expression consists of an optional sign ("+" or "-") or the word "in",
+// followed by one or more quantities, each an integer with a unit. Units may
+// be given in any order, but each unit may only be given once. The
+// following units (and abbreviations) are supported:
+//
+//	years   (y, yr, yrs, year)
+//	months  (mo, mon, month)
+//	weeks   (w, wk, wks, week)
+//	days    (d, day)
+//	hours   (h, hr, hrs, hour)
+//	minutes (m, min, mins, minute)
+//	seconds (s, sec, secs, second)
+//
+// Whitespace between tokens is optional, so "1d12h" is equivalent to
+// "1 day 12 hours". Years, months, weeks and days are calendar based, i.e.
+// "1 month" from January 31st is March 3rd (or 2nd in a leap year), as with
+// time.Time.AddDate. Years, months, weeks and days together may not exceed
+// about a million years, and hours, minutes and seconds together may not
+// exceed the range of a time.Duration, about 292 years.
+//
+// The generated packages (e.g. queue, index, secrets) each provide a
+// FromNow function returning their own Time type, e.g.
+//
+//	deadline, err := queue.FromNow("2 days 3 hours")
+package relativetime
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Offset is a parsed relative time expression.
+type Offset struct {
+	Years   int
+	Months  int
+	Weeks   int
+	Days    int
+	Hours   int
+	Minutes int
+	Seconds int
+	// True if the offset is into the past
+	Negative bool
+}
+
+// SyntaxError is returned when a relative time expression cannot be parsed.
+type SyntaxError struct {
+	// The expression that could not be parsed
+	Expression string
+	// Byte offset into Expression where the problem was found
+	Position int
+	Problem  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid relative time %q at position %v: %v", e.Expression, e.Position, e.Problem)
+}
+
+// durations are the units which are added to a time as a time.Duration,
+// rather than with time.Time.AddDate
+var durations = map[string]time.Duration{
+	"hours":   time.Hour,
+	"minutes": time.Minute,
+	"seconds": time.Second,
+}
+
+// calendarDays are the units which are added to a time with
+// time.Time.AddDate, with the most days each can span
+var calendarDays = map[string]int{
+	"years":  366,
+	"months": 31,
+	"weeks":  7,
+	"days":   1,
+}
+
+// maxCalendarDays is the most days that the calendar based quantities of an
+// offset may span together, a million leap years, which keeps the result of
+// time.Time.AddDate well within the range of a time.Time
+const maxCalendarDays = 366000000
+
+var units = map[string]string{
+	"y": "years", "yr": "years", "yrs": "years", "year": "years", "years": "years",
+	"mo": "months", "mon": "months", "month": "months", "months": "months",
+	"w": "weeks", "wk": "weeks", "wks": "weeks", "week": "weeks", "weeks": "weeks",
+	"d": "days", "day": "days", "days": "days",
+	"h": "hours", "hr": "hours", "hrs": "hours", "hour": "hours", "hours": "hours",
+	"m": "minutes", "min": "minutes", "mins": "minutes", "minute": "minutes", "minutes": "minutes",
+	"s": "seconds", "sec": "seconds", "secs": "seconds", "second": "seconds", "seconds": "seconds",
+}
+
+// Parse parses a relative time expression such as "in 1 day",
+// "-30 minutes" or "1 year 2 months".
+func Parse(expr string) (Offset, error) {
+	var offset Offset
+	fail := func(pos int, format string, a ...interface{}) (Offset, error) {
+		return Offset{}, &SyntaxError{Expression: expr, Position: pos, Problem: fmt.Sprintf(format, a...)}
+	}
+	pos := 0
+	skipSpace := func() {
+		for pos < len(expr) && unicode.IsSpace(rune(expr[pos])) {
+			pos++
+		}
+	}
+
+	skipSpace()
+	switch {
+	case pos < len(expr) && expr[pos] == '-':
+		offset.Negative = true
+		pos++
+	case pos < len(expr) && expr[pos] == '+':
+		pos++
+	case strings.HasPrefix(expr[pos:], "in") && pos+2 < len(expr) && unicode.IsSpace(rune(expr[pos+2])):
+		pos += 2
+	}
+
+	seen := map[string]bool{}
+	for {
+		skipSpace()
+		if pos == len(expr) {
+			break
+		}
+		start := pos
+		for pos < len(expr) && expr[pos] >= '0' && expr[pos] <= '9' {
+			pos++
+		}
+		if start == pos {
+			return fail(pos, "expected a number, but found %q", expr[pos:])
+		}
+		n, err := strconv.Atoi(expr[start:pos])
+		if err != nil {
+			return fail(start, "number %v is out of range", expr[start:pos])
+		}
+		skipSpace()
+		unitStart := pos
+		for pos < len(expr) && unicode.IsLetter(rune(expr[pos])) {
+			pos++
+		}
+		if unitStart == pos {
+			return fail(pos, "expected a unit after %v", n)
+		}
+		unit, ok := units[strings.ToLower(expr[unitStart:pos])]
+		if !ok {
+			return fail(unitStart, "unknown unit %q", expr[unitStart:pos])
+		}
+		if seen[unit] {
+			return fail(unitStart, "%v given more than once", unit)
+		}
+		seen[unit] = true
+		if d, ok := durations[unit]; ok && int64(n) > math.MaxInt64/int64(d) {
+			return fail(start, "%v %v is out of range", n, unit)
+		}
+		if d, ok := calendarDays[unit]; ok && n > maxCalendarDays/d {
+			return fail(start, "%v %v is out of range", n, unit)
+		}
+		switch unit {
+		case "years":
+			offset.Years = n
+		case "months":
+			offset.Months = n
+		case "weeks":
+			offset.Weeks = n
+		case "days":
+			offset.Days = n
+		case "hours":
+			offset.Hours = n
+		case "minutes":
+			offset.Minutes = n
+		case "seconds":
+			offset.Seconds = n
+		}
+	}
+	if len(seen) == 0 {
+		return fail(pos, "no time quantities given")
+	}
+	if 366*offset.Years+31*offset.Months+7*offset.Weeks+offset.Days > maxCalendarDays {
+		return fail(0, "%v years, %v months, %v weeks and %v days are out of range", offset.Years, offset.Months, offset.Weeks, offset.Days)
+	}
+	if _, ok := offset.duration(); !ok {
+		return fail(0, "%v hours, %v minutes and %v seconds are out of range", offset.Hours, offset.Minutes, offset.Seconds)
+	}
+	return offset, nil
+}
+
+// duration returns the hours, minutes and seconds of offset as a
+// time.Duration, and false if they are out of its range.
+func (offset Offset) duration() (time.Duration, bool) {
+	d := time.Duration(0)
+	for _, q := range []struct {
+		n    int
+		unit time.Duration
+	}{{offset.Hours, time.Hour}, {offset.Minutes, time.Minute}, {offset.Seconds, time.Second}} {
+		if q.n < 0 || int64(q.n) > int64(math.MaxInt64-d)/int64(q.unit) {
+			return 0, false
+		}
+		d += time.Duration(q.n) * q.unit
+	}
+	return d, true
+}
+
+// From returns the time which is offset from t. Years, months, weeks and
+// days are calendar based, as with time.Time.AddDate. The result is
+// undefined for quantities out of the range accepted by Parse.
+func (offset Offset) From(t time.Time) time.Time {
+	sign := 1
+	if offset.Negative {
+		sign = -1
+	}
+	d, _ := offset.duration()
+	return t.Add(time.Duration(sign)*d).AddDate(sign*offset.Years, sign*offset.Months, sign*(7*offset.Weeks+offset.Days))
+}
+
+// FromNow parses the relative time expression expr, and returns the time
+// which is that offset from now.
+func FromNow(expr string) (time.Time, error) {
+	return FromTime(expr, time.Now())
+}
+
+// FromTime parses the relative time expression expr, and returns the time
+// which is that offset from the reference time.
+func FromTime(expr string, reference time.Time) (time.Time, error) {
+	offset, err := Parse(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return offset.From(reference), nil
+}
@@ -0,0 +1,70 @@
+package relativetime
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFromTime(t *testing.T) {
+	reference := time.Date(2015, 1, 31, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"2 days 3 hours", time.Date(2015, 2, 2, 15, 0, 0, 0, time.UTC)},
+		{"in 1 day", time.Date(2015, 2, 1, 12, 0, 0, 0, time.UTC)},
+		{"-30 minutes", time.Date(2015, 1, 31, 11, 30, 0, 0, time.UTC)},
+		{"+1w 2s", time.Date(2015, 2, 7, 12, 0, 2, 0, time.UTC)},
+		{"1yr2mo", time.Date(2016, 3, 31, 12, 0, 0, 0, time.UTC)},
+		{" - 1 year 1 month ", time.Date(2013, 12, 31, 12, 0, 0, 0, time.UTC)},
+		{"1 month", time.Date(2015, 3, 3, 12, 0, 0, 0, time.UTC)},
+		{"90 Seconds", time.Date(2015, 1, 31, 12, 1, 30, 0, time.UTC)},
+		{"1000000 weeks", time.Date(21180, 6, 7, 12, 0, 0, 0, time.UTC)},
+		{"-1000000 years", time.Date(-997985, 1, 31, 12, 0, 0, 0, time.UTC)},
+		{"-2562047 hours", time.Date(1722, 10, 22, 13, 0, 0, 0, time.UTC)},
+	} {
+		actual, err := FromTime(test.expr, reference)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %v", test.expr, err)
+			continue
+		}
+		if !actual.Equal(test.expected) {
+			t.Errorf("Expected %q to be %v, but got %v", test.expr, test.expected, actual)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		expr    string
+		problem string
+	}{
+		{"", "no time quantities given"},
+		{"in", "expected a number"},
+		{"2", "expected a unit after 2"},
+		{"2 fortnights", `unknown unit "fortnights"`},
+		{"1 day 2 days", "days given more than once"},
+		{"1.5 hours", `expected a unit after 1`},
+		{"--1 day", "expected a number"},
+		{"2562048 hours", "2562048 hours is out of range"},
+		{"153722868 minutes", "153722868 minutes is out of range"},
+		{"9223372037 seconds", "9223372037 seconds is out of range"},
+		{"2562047 hours 153722867 minutes", "2562047 hours, 153722867 minutes and 0 seconds are out of range"},
+		{"99999999999999999999 days", "is out of range"},
+		{"1317624576693539401 weeks 1 day", "1317624576693539401 weeks is out of range"},
+		{"9999999999 years", "9999999999 years is out of range"},
+		{"11806452 months", "11806452 months is out of range"},
+		{"366000001 days", "366000001 days is out of range"},
+		{"1000000 years 1 day", "1000000 years, 0 months, 0 weeks and 1 days are out of range"},
+	} {
+		_, err := Parse(test.expr)
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("Expected a *SyntaxError parsing %q, but got %v", test.expr, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.problem) {
+			t.Errorf("Expected error parsing %q to mention %q, but got: %v", test.expr, test.problem, err)
+		}
+	}
+}
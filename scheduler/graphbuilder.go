@@ -0,0 +1,370 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+)
+
+// SchedulerId is the schedulerId of the task-graph scheduler. Tasks in a
+// task-graph must have this schedulerId.
+const SchedulerId = "task-graph-scheduler"
+
+// Syntax of taskIds and taskGraphIds
+var slugIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$`)
+
+// TaskGraphErrors lists all of the problems found when building a task-graph
+// with TaskGraphBuilder.
+type TaskGraphErrors []error
+
+func (errs TaskGraphErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = "  * " + err.Error()
+	}
+	return fmt.Sprintf("invalid task-graph (%v problems):\n%v", len(errs), strings.Join(lines, "\n"))
+}
+
+// GraphTask is a task node in a TaskGraphBuilder. Create one with
+// TaskGraphBuilder.AddTask.
+type GraphTask struct {
+	// Label used to refer to the task in error messages; unique per graph
+	Label string
+	// Assigned by AddTask, but may be overwritten before building
+	TaskId string
+	// Number of times to rerun the task if it completed unsuccessfully
+	Reruns     int
+	Definition *TaskDefinition
+	requires   []*GraphTask
+	requireIds []string
+	builder    *TaskGraphBuilder
+}
+
+// Requires adds dependencies on other tasks of the same builder.
+func (t *GraphTask) Requires(tasks ...*GraphTask) *GraphTask {
+	t.requires = append(t.requires, tasks...)
+	return t
+}
+
+// RequiresTaskId adds dependencies by taskId. This is intended for
+// extensions, to depend on tasks already in the task-graph.
+func (t *GraphTask) RequiresTaskId(taskIds ...string) *GraphTask {
+	t.requireIds = append(t.requireIds, taskIds...)
+	return t
+}
+
+// TaskGraphBuilder builds the request payloads for
+// Scheduler.CreateTaskGraph and Scheduler.ExtendTaskGraph. Dependencies are
+// wired up by reference, rather than by taskId, and the graph is validated
+// locally before submission. For example:
+//
+//	b := scheduler.NewTaskGraphBuilder()
+//	b.Metadata.Name = "Build and test"
+//	...
+//	build := b.AddTask("build", &buildTask)
+//	b.AddTask("test", &testTask, build)
+//	taskGraphId, tg, err := b.Build()
+//	if err != nil {
+//		// handle invalid task-graph...
+//	}
+//	tgs, callSummary := myScheduler.CreateTaskGraph(taskGraphId, tg)
+//
+// Building sets the taskGroupId of each task to the taskGraphId and its
+// schedulerId to SchedulerId, as required by the scheduler.
+type TaskGraphBuilder struct {
+	// Task-graph metadata, see TaskGraphDefinition1
+	Metadata struct {
+		Description string
+		Name        string
+		Owner       string
+		Source      string
+	}
+	// Task-graph specific routes
+	Routes []string
+	// Scopes granted to the task-graph, in addition to those returned by
+	// RequiredScopes, which are always included
+	Scopes []string
+	// Arbitrary key-value tags
+	Tags  map[string]string
+	tasks []*GraphTask
+}
+
+// NewTaskGraphBuilder returns an empty TaskGraphBuilder.
+func NewTaskGraphBuilder() *TaskGraphBuilder {
+	return &TaskGraphBuilder{
+		Routes: []string{},
+		Scopes: []string{},
+		Tags:   map[string]string{},
+	}
+}
+
+// AddTask adds a task with the given label and definition to the graph,
+// assigning it a new slugid, and returns the created node.
+func (b *TaskGraphBuilder) AddTask(label string, definition *TaskDefinition, requires ...*GraphTask) *GraphTask {
+	t := &GraphTask{
+		Label:      label,
+		TaskId:     slugid.Nice(),
+		Definition: definition,
+		builder:    b,
+	}
+	t.Requires(requires...)
+	b.tasks = append(b.tasks, t)
+	return t
+}
+
+// Tasks returns the tasks added to the builder, in the order added.
+func (b *TaskGraphBuilder) Tasks() []*GraphTask {
+	return append([]*GraphTask{}, b.tasks...)
+}
+
+// RequiredScopes returns the sorted union of scopes the task-graph needs
+// to have in order to define its tasks: the scopes of each task,
+// queue:define-task:<provisionerId>/<workerType> for each task and
+// queue:route:<route> for each task route.
+func (b *TaskGraphBuilder) RequiredScopes() []string {
+	set := map[string]bool{}
+	for _, t := range b.tasks {
+		if t.Definition == nil {
+			continue
+		}
+		set["queue:define-task:"+t.Definition.ProvisionerId+"/"+t.Definition.WorkerType] = true
+		for _, route := range t.Definition.Routes {
+			set["queue:route:"+route] = true
+		}
+		for _, scope := range t.Definition.Scopes {
+			set[scope] = true
+		}
+	}
+	return sortedKeys(set)
+}
+
+// Build validates the task-graph, and returns a new taskGraphId with the
+// request payload for Scheduler.CreateTaskGraph. If any problems are found,
+// they are all returned together as TaskGraphErrors.
+func (b *TaskGraphBuilder) Build() (string, *TaskGraphDefinition1, error) {
+	taskGraphId := slugid.Nice()
+	errs := b.validate(map[string]bool{})
+	for _, field := range []struct{ name, value string }{
+		{"name", b.Metadata.Name},
+		{"description", b.Metadata.Description},
+		{"owner", b.Metadata.Owner},
+		{"source", b.Metadata.Source},
+	} {
+		if field.value == "" {
+			errs = append(errs, fmt.Errorf("task-graph metadata %v is required", field.name))
+		}
+	}
+
+	tg := new(TaskGraphDefinition1)
+	tg.Metadata.Description = b.Metadata.Description
+	tg.Metadata.Name = b.Metadata.Name
+	tg.Metadata.Owner = b.Metadata.Owner
+	tg.Metadata.Source = b.Metadata.Source
+	tg.Routes = append([]string{}, b.Routes...)
+	scopes := map[string]bool{}
+	for _, scope := range append(b.RequiredScopes(), b.Scopes...) {
+		scopes[scope] = true
+	}
+	tg.Scopes = sortedKeys(scopes)
+	tags, err := json.Marshal(b.Tags)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("tags: %v", err))
+	}
+	tg.Tags = tags
+	for _, t := range b.tasks {
+		tg.Tasks = append(tg.Tasks, t.node(taskGraphId))
+	}
+	if len(errs) > 0 {
+		return taskGraphId, tg, errs
+	}
+	return taskGraphId, tg, nil
+}
+
+// BuildExtension validates the tasks of the builder as an extension of
+// existing task-graph taskGraphId, and returns the request payload for
+// Scheduler.ExtendTaskGraph. The task-graph is fetched with
+// myScheduler.Inspect, in order to check that tasks only depend on tasks
+// already in the task-graph (or in the extension), that taskIds are not
+// reused, and that the task-graph has the scopes the new tasks require,
+// since scopes cannot be changed when extending a task-graph. Metadata,
+// Routes, Scopes and Tags of the builder are ignored.
+func (b *TaskGraphBuilder) BuildExtension(myScheduler *Scheduler, taskGraphId string) (*TaskGraphDefinition, error) {
+	inspection, callSummary := myScheduler.Inspect(taskGraphId)
+	if callSummary.Error != nil {
+		return nil, fmt.Errorf("could not inspect task-graph %v: %v", taskGraphId, callSummary.Error)
+	}
+	existing := make(map[string]bool, len(inspection.Tasks))
+	for _, t := range inspection.Tasks {
+		existing[t.TaskId] = true
+	}
+	errs := b.validate(existing)
+	for _, scope := range b.RequiredScopes() {
+		if !scopeSatisfied(scope, inspection.Scopes) {
+			errs = append(errs, fmt.Errorf("task-graph %v does not have scope %q required by its new tasks", taskGraphId, scope))
+		}
+	}
+
+	tg := new(TaskGraphDefinition)
+	for _, t := range b.tasks {
+		tg.Tasks = append(tg.Tasks, t.node(taskGraphId))
+	}
+	if len(errs) > 0 {
+		return tg, errs
+	}
+	return tg, nil
+}
+
+// graphTaskNode has the same underlying type as the elements of
+// TaskGraphDefinition.Tasks and TaskGraphDefinition1.Tasks, so values can
+// be appended to either.
+type graphTaskNode struct {
+	Requires []string       `json:"requires"`
+	Reruns   int            `json:"reruns"`
+	Task     TaskDefinition `json:"task"`
+	TaskId   string         `json:"taskId"`
+}
+
+func (t *GraphTask) node(taskGraphId string) graphTaskNode {
+	n := graphTaskNode{
+		Requires: append([]string{}, t.requireIds...),
+		Reruns:   t.Reruns,
+		TaskId:   t.TaskId,
+	}
+	for _, r := range t.requires {
+		n.Requires = append(n.Requires, r.TaskId)
+	}
+	if t.Definition != nil {
+		n.Task = *t.Definition
+	}
+	n.Task.TaskGroupId = taskGraphId
+	n.Task.SchedulerId = SchedulerId
+	return n
+}
+
+// validate checks labels, taskIds, payloads, dependencies and cycles.
+// Payloads are checked with queue.CheckPayload. Tasks may depend on taskIds
+// in existing, in addition to tasks of the builder.
+func (b *TaskGraphBuilder) validate(existing map[string]bool) TaskGraphErrors {
+	errs := TaskGraphErrors{}
+	problem := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+	if len(b.tasks) == 0 {
+		problem("task-graph has no tasks")
+	}
+	labels := map[string]bool{}
+	taskIds := map[string]string{}
+	// tasks of the builder by taskId, for following RequiresTaskId
+	tasksById := map[string]*GraphTask{}
+	for _, t := range b.tasks {
+		switch {
+		case t.Label == "":
+			problem("task %v has no label", t.TaskId)
+		case labels[t.Label]:
+			problem("label %q is used by more than one task", t.Label)
+		}
+		labels[t.Label] = true
+		if t.Definition == nil {
+			problem("task %q has no definition", t.Label)
+		} else if err := queue.CheckPayload(t.Definition.ProvisionerId, t.Definition.WorkerType, t.Definition.Payload); err != nil {
+			problem("task %q: %v", t.Label, err)
+		}
+		if !slugIdPattern.MatchString(t.TaskId) {
+			problem("task %q has taskId %q which is not a valid slugid", t.Label, t.TaskId)
+		}
+		if other, ok := taskIds[t.TaskId]; ok {
+			problem("tasks %q and %q have the same taskId %v", other, t.Label, t.TaskId)
+		}
+		if existing[t.TaskId] {
+			problem("task %q has taskId %v which is already in the task-graph", t.Label, t.TaskId)
+		}
+		if _, ok := tasksById[t.TaskId]; !ok {
+			tasksById[t.TaskId] = t
+		}
+		taskIds[t.TaskId] = t.Label
+	}
+	for _, t := range b.tasks {
+		for _, r := range t.requires {
+			if r == nil || r.builder != b {
+				problem("task %q requires a task which was not added to this task-graph", t.Label)
+			}
+		}
+		for _, id := range t.requireIds {
+			if _, ok := taskIds[id]; !ok && !existing[id] {
+				problem("task %q requires task %v which is not in the task-graph", t.Label, id)
+			}
+		}
+	}
+
+	// depth first search for cycles, following dependencies added with
+	// Requires, and those added with RequiresTaskId on tasks of the builder;
+	// existing tasks can't be part of a cycle, since they can't depend on
+	// new ones
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[*GraphTask]int{}
+	var path []*GraphTask
+	var visit func(t *GraphTask)
+	visit = func(t *GraphTask) {
+		switch state[t] {
+		case visited:
+			return
+		case visiting:
+			cycle := []string{}
+			for i := len(path) - 1; i >= 0; i-- {
+				cycle = append([]string{path[i].Label}, cycle...)
+				if path[i] == t {
+					break
+				}
+			}
+			problem("dependency cycle: %v -> %v", strings.Join(cycle, " -> "), t.Label)
+			return
+		}
+		state[t] = visiting
+		path = append(path, t)
+		for _, r := range t.requires {
+			if r != nil && r.builder == b {
+				visit(r)
+			}
+		}
+		for _, id := range t.requireIds {
+			if r, ok := tasksById[id]; ok {
+				visit(r)
+			}
+		}
+		path = path[:len(path)-1]
+		state[t] = visited
+	}
+	for _, t := range b.tasks {
+		visit(t)
+	}
+	return errs
+}
+
+// scopeSatisfied returns true if scope is matched by one of the given
+// scope patterns, which may end in `*`.
+func scopeSatisfied(scope string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == scope || strings.HasSuffix(pattern, "*") && strings.HasPrefix(scope, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
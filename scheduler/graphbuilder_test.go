@@ -0,0 +1,149 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster-client-go/queue"
+)
+
+func newTask(scopes ...string) *TaskDefinition {
+	td := new(TaskDefinition)
+	td.ProvisionerId = "aws-provisioner"
+	td.WorkerType = "b2gtest"
+	td.Scopes = scopes
+	return td
+}
+
+func newBuilder() *TaskGraphBuilder {
+	b := NewTaskGraphBuilder()
+	b.Metadata.Name = "Build and test"
+	b.Metadata.Description = "Builds and tests the thing"
+	b.Metadata.Owner = "me@example.com"
+	b.Metadata.Source = "https://example.com/graph.yml"
+	return b
+}
+
+func TestBuild(t *testing.T) {
+	b := newBuilder()
+	build := b.AddTask("build", newTask("docker-worker:cache:build"))
+	test := b.AddTask("test", newTask("docker-worker:cache:test"), build)
+	test.Definition.Routes = []string{"index.tests"}
+	taskGraphId, tg, err := b.Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tg.Tasks) != 2 || tg.Tasks[1].TaskId != test.TaskId || len(tg.Tasks[1].Requires) != 1 || tg.Tasks[1].Requires[0] != build.TaskId {
+		t.Errorf("Unexpected tasks in task-graph: %#v", tg.Tasks)
+	}
+	for _, task := range tg.Tasks {
+		if task.Task.TaskGroupId != taskGraphId || task.Task.SchedulerId != SchedulerId {
+			t.Errorf("Expected taskGroupId %v and schedulerId %v, but got %v and %v", taskGraphId, SchedulerId, task.Task.TaskGroupId, task.Task.SchedulerId)
+		}
+	}
+	expected := "docker-worker:cache:build docker-worker:cache:test queue:define-task:aws-provisioner/b2gtest queue:route:index.tests"
+	if scopes := strings.Join(tg.Scopes, " "); scopes != expected {
+		t.Errorf("Expected scopes %v, but got %v", expected, scopes)
+	}
+}
+
+func TestBuildReportsAllProblems(t *testing.T) {
+	b := newBuilder()
+	a := b.AddTask("a", newTask())
+	c := b.AddTask("c", newTask(), a)
+	a.Requires(c)
+	b.AddTask("c", newTask()).RequiresTaskId("missing")
+	b.AddTask("d", newTask(), NewTaskGraphBuilder().AddTask("elsewhere", newTask()))
+	_, _, err := b.Build()
+	errs, ok := err.(TaskGraphErrors)
+	if !ok {
+		t.Fatalf("Expected TaskGraphErrors but got %v", err)
+	}
+	for _, expected := range []string{
+		`label "c" is used by more than one task`,
+		`task "c" requires task missing`,
+		`task "d" requires a task which was not added`,
+		"dependency cycle: a -> c -> a",
+	} {
+		if !strings.Contains(errs.Error(), expected) {
+			t.Errorf("Expected problem %q to be reported, but got:\n%v", expected, errs)
+		}
+	}
+}
+
+func TestBuildReportsCycleThroughTaskId(t *testing.T) {
+	b := newBuilder()
+	a := b.AddTask("a", newTask())
+	c := b.AddTask("c", newTask(), a)
+	a.RequiresTaskId(c.TaskId)
+	_, _, err := b.Build()
+	errs, ok := err.(TaskGraphErrors)
+	if !ok || len(errs) != 1 || !strings.Contains(errs[0].Error(), "dependency cycle: a -> c -> a") {
+		t.Errorf("Expected only the dependency cycle to be reported, but got %v", err)
+	}
+}
+
+func TestBuildExtension(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/task-graph/ZgyDJlKTRZStOIDVU5HPsw/inspect" {
+			t.Errorf("Unexpected request %v", r.URL.Path)
+		}
+		w.Write([]byte(`{
+			"scopes": ["queue:define-task:aws-provisioner/*"],
+			"tasks": [{"taskId": "XgvL0qtSR92cIWpcwdGKCA"}]
+		}`))
+	}))
+	defer server.Close()
+	myScheduler := New("", "")
+	myScheduler.BaseURL = server.URL
+
+	b := NewTaskGraphBuilder()
+	b.AddTask("ok", newTask()).RequiresTaskId("XgvL0qtSR92cIWpcwdGKCA")
+	tg, err := b.BuildExtension(myScheduler, "ZgyDJlKTRZStOIDVU5HPsw")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tg.Tasks) != 1 || tg.Tasks[0].Task.TaskGroupId != "ZgyDJlKTRZStOIDVU5HPsw" {
+		t.Errorf("Unexpected extension: %#v", tg)
+	}
+
+	b.AddTask("bad", newTask("secrets:get:garbage/*")).RequiresTaskId("73GsfK62QNKAk2Hg1EEZTQ")
+	_, err = b.BuildExtension(myScheduler, "ZgyDJlKTRZStOIDVU5HPsw")
+	for _, expected := range []string{
+		`task "bad" requires task 73GsfK62QNKAk2Hg1EEZTQ which is not in the task-graph`,
+		`does not have scope "secrets:get:garbage/*"`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected problem %q to be reported, but got:\n%v", expected, err)
+		}
+	}
+}
+
+type testPayload struct {
+	Image string `json:"image"`
+}
+
+func TestBuildChecksRegisteredPayloads(t *testing.T) {
+	queue.RegisterPayload("graph-payload-check", "docker", (*testPayload)(nil))
+	b := newBuilder()
+	good := newTask()
+	good.ProvisionerId, good.WorkerType = "graph-payload-check", "docker"
+	good.Payload = json.RawMessage(`{"image": "ubuntu:14.04"}`)
+	bad := newTask()
+	bad.ProvisionerId, bad.WorkerType = "graph-payload-check", "docker"
+	bad.Payload = json.RawMessage(`{"imag": "ubuntu:14.04"}`)
+	b.AddTask("good", good)
+	b.AddTask("bad", bad)
+	_, _, err := b.Build()
+	errs, ok := err.(TaskGraphErrors)
+	if !ok || len(errs) != 1 || !strings.Contains(errs[0].Error(), `task "bad": payload does not match type scheduler.testPayload`) {
+		t.Fatalf("Expected only the payload of task bad to be rejected, but got %v", err)
+	}
+	payload, err := good.TypedPayload()
+	if err != nil || payload.(*testPayload).Image != "ubuntu:14.04" {
+		t.Errorf("Unexpected typed payload %#v (%v)", payload, err)
+	}
+}
@@ -0,0 +1,10 @@
+package scheduler
+
+import "github.com/taskcluster/taskcluster-client-go/queue"
+
+// TypedPayload decodes the payload of the task definition with
+// queue.DecodePayload, returning a pointer to a value of the payload type
+// registered with queue.RegisterPayload.
+func (td *TaskDefinition) TypedPayload() (interface{}, error) {
+	return queue.DecodePayload(td.ProvisionerId, td.WorkerType, td.Payload)
+}
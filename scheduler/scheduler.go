@@ -51,6 +51,7 @@ import (
 	"time"
 
 	"github.com/taskcluster/httpbackoff"
+	"github.com/taskcluster/taskcluster-client-go/relativetime"
 	hawk "github.com/tent/hawk-go"
 	D "github.com/tj/go-debug"
 )
@@ -373,9 +374,9 @@ func (myScheduler *Scheduler) InspectTask(taskGraphId string, taskId string) (*I
 // **Warning** this api end-point is **not stable**.
 //
 // See http://docs.taskcluster.net/scheduler/api-docs/#ping
-func (myScheduler *Scheduler) Ping() *CallSummary {
-	_, callSummary := myScheduler.apiCall(nil, "GET", "/ping", nil)
-	return callSummary
+func (myScheduler *Scheduler) Ping() (*json.RawMessage, *CallSummary) {
+	responseObject, callSummary := myScheduler.apiCall(nil, "GET", "/ping", new(json.RawMessage))
+	return responseObject.(*json.RawMessage), callSummary
 }
 
 type (
@@ -698,3 +699,12 @@ func (t *Time) UnmarshalJSON(data []byte) (err error) {
 func (t Time) String() string {
 	return time.Time(t).UTC().Format("2006-01-02T15:04:05.000Z")
 }
+
+// FromNow returns the Time which is the given relative time expression from
+// now, e.g. "2 days 3 hours", "in 1 day" or "-30 minutes". See package
+// github.com/taskcluster/taskcluster-client-go/relativetime for the supported
+// syntax.
+func FromNow(expr string) (Time, error) {
+	t, err := relativetime.FromNow(expr)
+	return Time(t), err
+}
@@ -0,0 +1,129 @@
+package schemacheck
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// CheckFields returns a *ValidationError if document, given as json, has
+// object properties which the type of v has no field for, e.g. because of
+// a typo, which json.Unmarshal would silently ignore. Properties are matched
+// against the json names of fields case-insensitively, as by
+// json.Unmarshal. Values of interface and map types, and of types which
+// unmarshal themselves, such as json.RawMessage, may have any properties.
+// Other mismatches, e.g. a string for a number, are left to json.Unmarshal.
+//
+// For example, to unmarshal a document into a value, rejecting unknown
+// properties:
+//
+//	if err := json.Unmarshal(document, value); err != nil {
+//		// handle error...
+//	}
+//	if err := schemacheck.CheckFields(document, value); err != nil {
+//		// err lists the unknown properties
+//	}
+func CheckFields(document []byte, v interface{}) error {
+	var value interface{}
+	if err := json.Unmarshal(document, &value); err != nil {
+		return err
+	}
+	problems := unknownFields(reflect.TypeOf(v), value, "", []string{})
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return &ValidationError{Problems: problems}
+}
+
+// unknownFields appends a problem to problems for each property of value,
+// the json value at path, which type t has no field for
+func unknownFields(t reflect.Type, value interface{}, path string, problems []string) []string {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t == rawMessageType || t.Implements(unmarshalerType) || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return problems
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return problems
+		}
+		fields := map[string]reflect.Type{}
+		jsonFields(t, fields)
+		for name, property := range object {
+			fieldType, ok := fields[name]
+			if !ok {
+				for fieldName, ft := range fields {
+					if strings.EqualFold(fieldName, name) {
+						fieldType, ok = ft, true
+						break
+					}
+				}
+			}
+			if !ok {
+				problems = append(problems, join(path, name)+": unknown property")
+				continue
+			}
+			problems = unknownFields(fieldType, property, join(path, name), problems)
+		}
+	case reflect.Map:
+		if object, ok := value.(map[string]interface{}); ok {
+			for name, property := range object {
+				problems = unknownFields(t.Elem(), property, join(path, name), problems)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if items, ok := value.([]interface{}); ok {
+			for i, item := range items {
+				problems = unknownFields(t.Elem(), item, join(path, strconv.Itoa(i)), problems)
+			}
+		}
+	}
+	return problems
+}
+
+// jsonFields adds the exported fields of struct type t, including those of
+// embedded structs, to fields, keyed by their json names
+func jsonFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			jsonFields(fieldType, fields)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+}
+
+// join returns the dotted path of property name of the value at path
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,57 @@
+package schemacheck
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type launchSpec struct {
+	ImageId string `json:"ImageId"`
+}
+
+type region struct {
+	Region     string          `json:"region"`
+	LaunchSpec launchSpec      `json:"launchSpec"`
+	Secrets    json.RawMessage `json:"secrets"`
+}
+
+type base struct {
+	Name string `json:"name"`
+}
+
+type definition struct {
+	base
+	Regions []*region             `json:"regions"`
+	Tags    map[string]launchSpec `json:"tags"`
+	Extra   interface{}           `json:"extra"`
+	Ignored string                `json:"-"`
+}
+
+func TestCheckFields(t *testing.T) {
+	for _, test := range []struct {
+		document string
+		problems string
+	}{
+		{`{"name": "a", "regions": [{"region": "us-west-2", "launchSpec": {"ImageId": "ami-1"}, "secrets": {"any": 1}}], "extra": {"any": 1}}`, ""},
+		{`{"NAME": "a", "regions": [{"launchspec": {"imageid": "ami-1"}}]}`, ""},
+		{`{"name": "a", "Ignored": "x", "nmae": "b"}`, "Ignored: unknown property; nmae: unknown property"},
+		{`{"regions": [{"region": "us-west-2"}, {"launchSpec": {"ImageID": "ami-1", "KeyName": "x"}}]}`, "regions.1.launchSpec.KeyName: unknown property"},
+		{`{"tags": {"a": {"image": "x"}}}`, "tags.a.image: unknown property"},
+		{`{"regions": "not a list"}`, ""},
+	} {
+		err := CheckFields([]byte(test.document), new(definition))
+		if test.problems == "" {
+			if err != nil {
+				t.Errorf("Unexpected error checking %v: %v", test.document, err)
+			}
+			continue
+		}
+		if _, ok := err.(*ValidationError); !ok || err.Error() != test.problems {
+			t.Errorf("Expected %q checking %v, but got %v", test.problems, test.document, err)
+		}
+	}
+	if err := CheckFields([]byte(`{`), new(definition)); err == nil || strings.Contains(err.Error(), "unknown property") {
+		t.Errorf("Expected invalid json to be reported, but got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Package schemacheck checks json documents against json schemas, with
+// github.com/xeipuuv/gojsonschema, taking into account that documents
+// marshaled from the go types generated from a schema set every property.
+//
+// An optional property which is not set marshals as "" or null, so such
+// values are dropped before a document is checked, unless the property is
+// required by the schema of its object. Required properties are always
+// checked, so that e.g. an empty required string which must match a
+// pattern is an error.
+//
+// The Publish functions of the generated events packages (e.g. queueevents)
+// check messages with Validate, before publishing them. For example:
+//
+//	err := schemacheck.Validate(schema, body)
+//	if err != nil {
+//		// err is a *schemacheck.ValidationError listing the problems
+//	}
+//
+// Documents can also be checked against the go types they are unmarshaled
+// into, with CheckFields, which reports properties the types have no
+// fields for.
+package schemacheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+var (
+	// protects compiled
+	compiledMutex sync.Mutex
+	// compiled schemas, keyed by their json
+	compiled = map[string]*gojsonschema.Schema{}
+)
+
+// ValidationError is returned by Validate when a document does not conform
+// to its schema.
+type ValidationError struct {
+	// Each problem is of the form <field>: <description>, where the field is
+	// the dotted path of the property in the document, or (root)
+	Problems []string
+}
+
+func (err *ValidationError) Error() string {
+	return strings.Join(err.Problems, "; ")
+}
+
+// Validate returns a *ValidationError if document does not conform to
+// schema, both given as json, or another error if either is not valid json
+// or schema is not a valid json schema. Compiled schemas are cached, so
+// schema would typically be a constant.
+func Validate(schema string, document []byte) error {
+	s, err := compile(schema)
+	if err != nil {
+		return err
+	}
+	var rawSchema, value interface{}
+	if err := json.Unmarshal([]byte(schema), &rawSchema); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(document, &value); err != nil {
+		return err
+	}
+	result, err := s.Validate(gojsonschema.NewGoLoader(dropUnset(rawSchema, value)))
+	if err != nil {
+		return err
+	}
+	if result.Valid() {
+		return nil
+	}
+	problems := []string{}
+	for _, e := range result.Errors() {
+		problems = append(problems, fmt.Sprintf("%v: %v", e.Field(), e.Description()))
+	}
+	sort.Strings(problems)
+	return &ValidationError{Problems: problems}
+}
+
+// compile returns the compiled schema, from the cache if possible
+func compile(schema string) (*gojsonschema.Schema, error) {
+	compiledMutex.Lock()
+	defer compiledMutex.Unlock()
+	if s := compiled[schema]; s != nil {
+		return s, nil
+	}
+	s, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		return nil, fmt.Errorf("invalid json schema: %v", err)
+	}
+	compiled[schema] = s
+	return s, nil
+}
+
+// dropUnset removes the properties of objects in value which are "" or null
+// and not required by schema, following the properties and items of schema,
+// and returns value.
+func dropUnset(schema, value interface{}) interface{} {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := s["properties"].(map[string]interface{})
+		required := map[string]bool{}
+		if r, ok := s["required"].([]interface{}); ok {
+			for _, name := range r {
+				if n, ok := name.(string); ok {
+					required[n] = true
+				}
+			}
+		}
+		for name, property := range v {
+			if !required[name] && (property == nil || property == "") {
+				delete(v, name)
+				continue
+			}
+			if properties != nil {
+				dropUnset(properties[name], property)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			dropUnset(s["items"], item)
+		}
+	}
+	return value
+}
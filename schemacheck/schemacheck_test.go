@@ -0,0 +1,59 @@
+package schemacheck
+
+import (
+	"strings"
+	"testing"
+)
+
+const schema = `{
+	"type": "object",
+	"additionalProperties": false,
+	"required": ["name", "scopes"],
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"comment": {"type": "string", "minLength": 1},
+		"created": {"type": "string", "format": "date-time"},
+		"scopes": {"type": "array", "uniqueItems": true, "items": {"type": "string"}},
+		"owner": {"oneOf": [
+			{"type": "object", "required": ["email"], "properties": {"email": {"type": "string"}}},
+			{"type": "object", "required": ["team"], "properties": {"team": {"type": "string"}}}
+		]}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		document string
+		problem  string
+	}{
+		{`{"name": "a", "scopes": [], "comment": "", "created": null, "owner": null}`, ""},
+		{`{"name": "a", "scopes": ["x"], "owner": {"email": "a@example.com"}}`, ""},
+		{`{"name": "", "scopes": []}`, "name: "},
+		{`{"name": "a"}`, "(root): "},
+		{`{"name": "a", "scopes": null}`, "scopes: "},
+		{`{"name": "a", "scopes": ["x", "x"]}`, "scopes: "},
+		{`{"name": "a", "scopes": [], "created": "yesterday"}`, "created: "},
+		{`{"name": "a", "scopes": [], "owner": {"email": "a@example.com", "team": "b"}}`, "owner: "},
+		{`{"name": "a", "scopes": [], "colour": "red"}`, "(root): "},
+	} {
+		err := Validate(schema, []byte(test.document))
+		if test.problem == "" {
+			if err != nil {
+				t.Errorf("Expected %v to be valid, but got %v", test.document, err)
+			}
+			continue
+		}
+		if _, ok := err.(*ValidationError); !ok || !strings.Contains(err.Error(), test.problem) {
+			t.Errorf("Expected *ValidationError containing %q for %v, but got %v", test.problem, test.document, err)
+		}
+	}
+}
+
+func TestValidateInvalidInput(t *testing.T) {
+	if err := Validate(`{"type": 7}`, []byte(`{}`)); err == nil {
+		t.Errorf("Expected invalid schema to be rejected")
+	}
+	if err := Validate(schema, []byte(`{`)); err == nil {
+		t.Errorf("Expected invalid json to be rejected")
+	}
+}
@@ -0,0 +1,163 @@
+package secretstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/secrets"
+)
+
+// KeySize is the size in bytes of the keys with which backups are
+// encrypted.
+const KeySize = 32
+
+// backupHeader starts every backup, and identifies its format
+var backupHeader = []byte("taskcluster-secrets-backup-v1\n")
+
+// ErrCorruptBackup is returned by Import when a backup cannot be decrypted,
+// because it was encrypted with a different key, or has been modified.
+var ErrCorruptBackup = errors.New("backup is corrupt, or was encrypted with a different key")
+
+// backup is the plain text of a backup
+type backup struct {
+	Secrets []*backupSecret `json:"secrets"`
+}
+
+type backupSecret struct {
+	Name    string          `json:"name"`
+	Expires secrets.Time    `json:"expires"`
+	Secret  json.RawMessage `json:"secret"`
+}
+
+// NewKey returns a new random key for encrypting backups, base64 encoded,
+// e.g. to be stored in an environment variable and passed to ParseKey.
+func NewKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes a base64 encoded key, as returned by NewKey.
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("backup key is not valid base64: %v", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("backup key has %v bytes, but should have %v", len(key), KeySize)
+	}
+	return key, nil
+}
+
+// Export reads the secrets with the given names, and writes them to out,
+// encrypted with key, which must be KeySize bytes, using AES-256-GCM. The
+// backup can be restored with Import. The secrets are read directly from
+// the secrets service, rather than from the cache, and if any cannot be
+// read, nothing is written.
+func (s *Store) Export(out io.Writer, key []byte, names ...string) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	b := &backup{Secrets: make([]*backupSecret, len(names))}
+	for i, name := range names {
+		secret, expires, err := s.fetch(name)
+		if err != nil {
+			return err
+		}
+		b.Secrets[i] = &backupSecret{Name: name, Expires: secrets.Time(expires), Secret: secret}
+	}
+	plaintext, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data := append(append(append([]byte{}, backupHeader...), nonce...), aead.Seal(nil, nonce, plaintext, backupHeader)...)
+	_, err = out.Write(data)
+	return err
+}
+
+// Import restores the secrets of a backup written by Export, encrypted with
+// key, overwriting any existing secrets with the same names, and returns
+// the names of the secrets restored. Secrets which have expired since the
+// backup was made are not restored.
+func (s *Store) Import(in io.Reader, key []byte) ([]string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, backupHeader) {
+		return nil, errors.New("not a secrets backup")
+	}
+	data = data[len(backupHeader):]
+	if len(data) < aead.NonceSize() {
+		return nil, ErrCorruptBackup
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], backupHeader)
+	if err != nil {
+		return nil, ErrCorruptBackup
+	}
+	b := new(backup)
+	if err := json.Unmarshal(plaintext, b); err != nil {
+		return nil, err
+	}
+	restored := []string{}
+	for _, secret := range b.Secrets {
+		if !s.now().Before(time.Time(secret.Expires)) {
+			debug("Not restoring secret %v, which expired at %v", secret.Name, secret.Expires)
+			continue
+		}
+		if err := s.put(secret.Name, secret.Secret, time.Time(secret.Expires)); err != nil {
+			return restored, fmt.Errorf("could not restore secret %v: %v", secret.Name, err)
+		}
+		restored = append(restored, secret.Name)
+	}
+	return restored, nil
+}
+
+// put creates or overwrites the secret with the given name
+func (s *Store) put(name string, secret json.RawMessage, expires time.Time) error {
+	callSummary := s.setOrUpdate(name, &secrets.ATaskClusterSecret{Expires: secrets.Time(expires), Secret: secret})
+	s.Forget(name)
+	return callSummary.Error
+}
+
+// setOrUpdate sets the secret with the given name, or updates it if it
+// already exists
+func (s *Store) setOrUpdate(name string, payload *secrets.ATaskClusterSecret) *secrets.CallSummary {
+	callSummary := s.Secrets.Set(name, payload)
+	if resp := callSummary.HttpResponse; resp != nil && resp.StatusCode == http.StatusConflict {
+		callSummary = s.Secrets.Update(name, payload)
+	}
+	return callSummary
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("backup key has %v bytes, but should have %v", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,111 @@
+package secretstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/secrets"
+)
+
+func TestExportImport(t *testing.T) {
+	s, f, advance, done := newTestStore()
+	defer done()
+	encoded, err := NewKey()
+	if err != nil {
+		t.Fatalf("Could not create key: %v", err)
+	}
+	key, err := ParseKey(encoded)
+	if err != nil {
+		t.Fatalf("Could not parse key %v: %v", encoded, err)
+	}
+	if err := s.Set("project/myapp/db", &credentials{"myapp", "hunter2"}, time.Hour); err != nil {
+		t.Fatalf("Could not set secret: %v", err)
+	}
+	if err := s.Set("project/myapp/api", &credentials{"api", "correcthorse"}, time.Minute); err != nil {
+		t.Fatalf("Could not set secret: %v", err)
+	}
+	var b bytes.Buffer
+	if err := s.Export(&b, key, "project/myapp/db", "project/myapp/api"); err != nil {
+		t.Fatalf("Could not export secrets: %v", err)
+	}
+	if bytes.Contains(b.Bytes(), []byte("hunter2")) {
+		t.Fatalf("Backup is not encrypted")
+	}
+	if err := s.Export(&bytes.Buffer{}, key, "project/myapp/missing"); err == nil {
+		t.Errorf("Expected export of missing secret to fail")
+	}
+
+	other, _ := NewKey()
+	otherKey, _ := ParseKey(other)
+	if _, err := s.Import(bytes.NewReader(b.Bytes()), otherKey); err != ErrCorruptBackup {
+		t.Errorf("Expected ErrCorruptBackup importing with a different key, but got %v", err)
+	}
+
+	s.Remove("project/myapp/db")
+	s.Update("project/myapp/api", &credentials{"api", "changed"}, time.Hour)
+	advance(2 * time.Minute)
+	restored, err := s.Import(&b, key)
+	if err != nil {
+		t.Fatalf("Could not import secrets: %v", err)
+	}
+	if len(restored) != 1 || restored[0] != "project/myapp/db" {
+		t.Errorf("Expected only the unexpired secret to be restored, but got %v", restored)
+	}
+	var creds credentials
+	if expires, err := s.Get("project/myapp/db", &creds); err != nil || creds.Password != "hunter2" {
+		t.Errorf("Expected restored secret, but got %v (%v)", creds, err)
+	} else if !expires.Equal(s.now().Add(58 * time.Minute)) {
+		t.Errorf("Expected restored secret to keep its expiry, but it expires at %v", expires)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !bytes.Contains(f.secrets["project/myapp/api"].Secret, []byte("changed")) {
+		t.Errorf("Expected expired secret not to be restored over the current one")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	s, f, advance, done := newTestStore()
+	defer done()
+	previous, err := s.Rotate("project/myapp/db", &credentials{"myapp", "hunter2"}, 24*time.Hour, time.Hour)
+	if err != nil || previous != "" {
+		t.Fatalf("Expected rotating a new secret to create it, but got %q (%v)", previous, err)
+	}
+	advance(time.Minute)
+	previous, err = s.Rotate("project/myapp/db", &credentials{"myapp", "correcthorse"}, 24*time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("Could not rotate secret: %v", err)
+	}
+	if previous != "project/myapp/db@2015-10-27T20:37:19.255Z" {
+		t.Errorf("Unexpected versioned name %v", previous)
+	}
+	var creds credentials
+	if _, err := s.Get("project/myapp/db", &creds); err != nil || creds.Password != "correcthorse" {
+		t.Errorf("Expected rotated secret, but got %v (%v)", creds, err)
+	}
+	expires, err := s.Get(previous, &creds)
+	if err != nil || creds.Password != "hunter2" {
+		t.Errorf("Expected previous secret, but got %v (%v)", creds, err)
+	}
+	if !expires.Equal(s.now().Add(time.Hour)) {
+		t.Errorf("Expected previous secret to expire after the grace period, but it expires at %v", expires)
+	}
+	advance(time.Hour)
+	if _, err := s.Get(previous, &creds); err == nil {
+		t.Errorf("Expected previous secret to have expired")
+	}
+
+	// the previous value never outlives the secret it replaced
+	f.mutex.Lock()
+	f.secrets["project/myapp/db"].Expires = secrets.Time(s.now().Add(time.Minute))
+	f.mutex.Unlock()
+	previous, err = s.Rotate("project/myapp/db", json.RawMessage(`{"username": "myapp", "password": "x"}`), 24*time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("Could not rotate secret: %v", err)
+	}
+	if expires, err := s.Get(previous, &creds); err != nil || !expires.Equal(s.now().Add(time.Minute)) {
+		t.Errorf("Expected previous secret to expire with the secret it replaced, but it expires at %v (%v)", expires, err)
+	}
+}
@@ -0,0 +1,45 @@
+package secretstore
+
+import (
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/secrets"
+)
+
+// PreviousName returns the versioned name under which Rotate keeps the
+// value of secret name which was replaced at the given time, e.g.
+// project/myapp/db@2015-10-27T20:36:19.255Z.
+func PreviousName(name string, rotated time.Time) string {
+	return name + "@" + secrets.Time(rotated).String()
+}
+
+// Rotate replaces the value of the secret with the given name with value,
+// marshaled to json, to expire after ttl, as Update does, but first copies
+// the current value to PreviousName(name, now), to expire after grace (or
+// when the current value expires, if sooner), so that it remains available
+// to clients which have not yet switched to the new value. It returns the
+// versioned name of the previous value, or "" if the secret did not exist,
+// in which case it is created.
+//
+// Rotating requires scopes to set both the secret and its versioned names,
+// e.g. secrets:set:<name>*.
+func (s *Store) Rotate(name string, value interface{}, ttl, grace time.Duration) (string, error) {
+	secret, expires, err := s.fetch(name)
+	switch err.(type) {
+	case nil:
+	case *NotFoundError, *ExpiredError:
+		return "", s.write(name, value, ttl, s.setOrUpdate)
+	default:
+		return "", err
+	}
+	now := s.now()
+	previous := PreviousName(name, now)
+	if graceEnds := now.Add(grace); graceEnds.Before(expires) {
+		expires = graceEnds
+	}
+	if err := s.put(previous, secret, expires); err != nil {
+		return "", err
+	}
+	debug("Kept previous value of secret %v as %v until %v", name, previous, secrets.Time(expires))
+	return previous, s.Update(name, value, ttl)
+}
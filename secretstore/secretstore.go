@@ -0,0 +1,288 @@
+// Package secretstore reads and writes secrets of the secrets service as Go
+// values, rather than raw json, and can cache them, so that services which
+// read a secret on every request do not call the secrets service every
+// time.
+//
+// A value is stored by marshaling it to json, with an expiry given as a
+// duration from now, and read back by unmarshaling the secret into a value
+// of the same type. With a Store.MaxAge, secrets read are cached for that
+// long (but never beyond their expiry), and a cached secret which is about
+// to become stale is refreshed in the background, while the cached value
+// continues to be served.
+//
+// For example:
+//
+//	type dbCredentials struct {
+//		Username string `json:"username"`
+//		Password string `json:"password"`
+//	}
+//
+//	store := secretstore.New(secrets.New("myClientId", "myAccessToken"))
+//	store.MaxAge = 5 * time.Minute
+//	err := store.Set("project/myapp/db", &dbCredentials{"myapp", "hunter2"}, 30*24*time.Hour)
+//	...
+//	var creds dbCredentials
+//	expires, err := store.Get("project/myapp/db", &creds)
+//	if err != nil {
+//		// handle error...
+//	}
+package secretstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/secrets"
+	D "github.com/tj/go-debug"
+)
+
+var (
+	// Used for logging based on DEBUG environment variable
+	// See github.com/tj/go-debug
+	debug = D.Debug("secretstore")
+)
+
+// NotFoundError is returned by Store.Get when there is no secret with the
+// given name.
+type NotFoundError struct {
+	Name string
+}
+
+func (err *NotFoundError) Error() string {
+	return fmt.Sprintf("secret %v not found", err.Name)
+}
+
+// ExpiredError is returned by Store.Get when the secret with the given name
+// has expired. Expires is zero if the secrets service did not say when.
+type ExpiredError struct {
+	Name    string
+	Expires time.Time
+}
+
+func (err *ExpiredError) Error() string {
+	if err.Expires.IsZero() {
+		return fmt.Sprintf("secret %v has expired", err.Name)
+	}
+	return fmt.Sprintf("secret %v expired at %v", err.Name, secrets.Time(err.Expires))
+}
+
+// Store reads and writes secrets as Go values. Create one with New, and set
+// MaxAge to enable caching, before using it.
+type Store struct {
+	// Secrets service used to read and write secrets
+	Secrets *secrets.Secrets
+	// How long a secret read is cached for, or 0 to read secrets from the
+	// secrets service every time. Secrets are never cached beyond their
+	// expiry.
+	MaxAge time.Duration
+	// How long before a cached secret becomes stale it is refreshed in the
+	// background by Get
+	RefreshAhead time.Duration
+
+	mutex sync.Mutex
+	// cached secrets, by name
+	cache map[string]*entry
+	// generation of each secret, by name, which is incremented whenever the
+	// secret is written or forgotten, so that a read which started before
+	// does not cache the old secret
+	generations map[string]uint64
+	// background refreshes in progress
+	refreshes sync.WaitGroup
+	// returns the current time, overridden in tests
+	now func() time.Time
+}
+
+// entry is a cached secret
+type entry struct {
+	secret  json.RawMessage
+	expires time.Time
+	// when the secret was read or written
+	fetched    time.Time
+	refreshing bool
+}
+
+// stale returns the time at which e may no longer be served
+func (e *entry) stale(maxAge time.Duration) time.Time {
+	stale := e.fetched.Add(maxAge)
+	if e.expires.Before(stale) {
+		return e.expires
+	}
+	return stale
+}
+
+// New returns a Store which reads and writes secrets using mySecrets,
+// without caching.
+func New(mySecrets *secrets.Secrets) *Store {
+	return &Store{
+		Secrets:      mySecrets,
+		RefreshAhead: time.Minute,
+		cache:        map[string]*entry{},
+		generations:  map[string]uint64{},
+		now:          time.Now,
+	}
+}
+
+// Get reads the secret with the given name into value, which should be a
+// pointer, as for json.Unmarshal, and returns when the secret expires. If
+// the secret does not exist or has expired, a *NotFoundError or an
+// *ExpiredError is returned.
+func (s *Store) Get(name string, value interface{}) (time.Time, error) {
+	secret, expires, err := s.get(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := json.Unmarshal(secret, value); err != nil {
+		return time.Time{}, fmt.Errorf("secret %v cannot be read into %T: %v", name, value, err)
+	}
+	return expires, nil
+}
+
+// get returns the secret with the given name from the cache, or else from
+// the secrets service, and when it expires
+func (s *Store) get(name string) (json.RawMessage, time.Time, error) {
+	if s.MaxAge > 0 {
+		now := s.now()
+		s.mutex.Lock()
+		e := s.cache[name]
+		if e != nil && now.Before(e.stale(s.MaxAge)) {
+			if !e.refreshing && !now.Before(e.stale(s.MaxAge).Add(-s.RefreshAhead)) {
+				e.refreshing = true
+				s.refreshes.Add(1)
+				go s.refresh(name)
+			}
+			s.mutex.Unlock()
+			return e.secret, e.expires, nil
+		}
+		s.mutex.Unlock()
+	}
+	return s.fetch(name)
+}
+
+// refresh reads the secret with the given name from the secrets service, to
+// update the cache
+func (s *Store) refresh(name string) {
+	defer s.refreshes.Done()
+	if _, _, err := s.fetch(name); err != nil {
+		debug("Could not refresh secret %v: %v", name, err)
+		s.mutex.Lock()
+		if e := s.cache[name]; e != nil {
+			e.refreshing = false
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// fetch reads the secret with the given name from the secrets service, and
+// caches it, unless it has been written or forgotten in the meantime
+func (s *Store) fetch(name string) (json.RawMessage, time.Time, error) {
+	debug("Reading secret %v", name)
+	s.mutex.Lock()
+	generation := s.generations[name]
+	s.mutex.Unlock()
+	secret, callSummary := s.Secrets.Get(name)
+	if resp := callSummary.HttpResponse; resp != nil {
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			s.Forget(name)
+			return nil, time.Time{}, &NotFoundError{Name: name}
+		case http.StatusGone:
+			s.Forget(name)
+			return nil, time.Time{}, &ExpiredError{Name: name}
+		}
+	}
+	if callSummary.Error != nil {
+		return nil, time.Time{}, callSummary.Error
+	}
+	expires := time.Time(secret.Expires)
+	if !s.now().Before(expires) {
+		s.Forget(name)
+		return nil, time.Time{}, &ExpiredError{Name: name, Expires: expires}
+	}
+	s.remember(name, secret.Secret, expires, generation)
+	return secret.Secret, expires, nil
+}
+
+// Set creates or overwrites the secret with the given name, storing value
+// marshaled to json, to expire after ttl.
+func (s *Store) Set(name string, value interface{}, ttl time.Duration) error {
+	return s.write(name, value, ttl, s.Secrets.Set)
+}
+
+// Update overwrites the existing secret with the given name, storing value
+// marshaled to json, to expire after ttl.
+func (s *Store) Update(name string, value interface{}, ttl time.Duration) error {
+	return s.write(name, value, ttl, s.Secrets.Update)
+}
+
+func (s *Store) write(name string, value interface{}, ttl time.Duration, call func(string, *secrets.ATaskClusterSecret) *secrets.CallSummary) error {
+	secret, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("secret %v cannot be written from %T: %v", name, value, err)
+	}
+	// as stored by the secrets service
+	expires := s.now().Add(ttl).Truncate(time.Millisecond)
+	callSummary := call(name, &secrets.ATaskClusterSecret{
+		Expires: secrets.Time(expires),
+		Secret:  secret,
+	})
+	if callSummary.Error != nil {
+		// the secret may or may not have been written
+		s.Forget(name)
+		return callSummary.Error
+	}
+	s.remember(name, secret, expires, s.bump(name))
+	return nil
+}
+
+// Remove deletes the secret with the given name.
+func (s *Store) Remove(name string) error {
+	err := s.Secrets.Remove(name).Error
+	s.Forget(name)
+	return err
+}
+
+// Forget drops the secret with the given name from the cache, so that it is
+// read from the secrets service the next time, e.g. if it is known to have
+// been changed elsewhere.
+func (s *Store) Forget(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.generations[name]++
+	delete(s.cache, name)
+}
+
+// Wait waits for background refreshes started by Get to finish.
+func (s *Store) Wait() {
+	s.refreshes.Wait()
+}
+
+// bump increments the generation of the secret with the given name, and
+// returns the new generation
+func (s *Store) bump(name string) uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.generations[name]++
+	return s.generations[name]
+}
+
+// remember caches the secret with the given name, if its generation is
+// still the given one
+func (s *Store) remember(name string, secret json.RawMessage, expires time.Time, generation uint64) {
+	if s.MaxAge <= 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.generations[name] != generation {
+		debug("Not caching secret %v, which changed while it was read", name)
+		return
+	}
+	s.cache[name] = &entry{
+		secret:  secret,
+		expires: expires,
+		fetched: s.now(),
+	}
+}
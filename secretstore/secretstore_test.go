@@ -0,0 +1,247 @@
+package secretstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/secrets"
+)
+
+// fakeSecrets is an in-memory secrets service, which counts the requests to
+// read each secret
+type fakeSecrets struct {
+	mutex   sync.Mutex
+	secrets map[string]*secrets.ATaskClusterSecret
+	reads   map[string]int
+	// if not nil, called after a secret has been read, before it is
+	// returned, without holding mutex
+	afterRead func()
+}
+
+func (f *fakeSecrets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/secrets/")
+	switch r.Method {
+	case "GET":
+		f.reads[name]++
+		secret := f.secrets[name]
+		if secret == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := json.Marshal(secret)
+		if afterRead := f.afterRead; afterRead != nil {
+			f.mutex.Unlock()
+			afterRead()
+			f.mutex.Lock()
+		}
+		w.Write(body)
+	case "PUT", "POST":
+		if _, exists := f.secrets[name]; exists == (r.Method == "PUT") {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		secret := new(secrets.ATaskClusterSecret)
+		if err := json.Unmarshal(body, secret); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.secrets[name] = secret
+		w.Write([]byte("{}"))
+	case "DELETE":
+		delete(f.secrets, name)
+		w.Write([]byte("{}"))
+	}
+}
+
+func (f *fakeSecrets) readCount(name string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.reads[name]
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// newTestStore returns a Store using a fakeSecrets, with a clock which only
+// moves when advanced by the returned function
+func newTestStore() (*Store, *fakeSecrets, func(time.Duration), func()) {
+	f := &fakeSecrets{
+		secrets: map[string]*secrets.ATaskClusterSecret{},
+		reads:   map[string]int{},
+	}
+	server := httptest.NewServer(f)
+	mySecrets := secrets.New("", "")
+	mySecrets.Authenticate = false
+	mySecrets.BaseURL = server.URL
+	s := New(mySecrets)
+	var mutex sync.Mutex
+	now := time.Date(2015, 10, 27, 20, 36, 19, 255e6, time.UTC)
+	s.now = func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+	return s, f, advance, server.Close
+}
+
+func TestSetGet(t *testing.T) {
+	s, f, _, done := newTestStore()
+	defer done()
+	if err := s.Set("project/myapp/db", &credentials{"myapp", "hunter2"}, time.Hour); err != nil {
+		t.Fatalf("Could not set secret: %v", err)
+	}
+	f.mutex.Lock()
+	expires := time.Time(f.secrets["project/myapp/db"].Expires)
+	f.mutex.Unlock()
+	if !expires.Equal(s.now().Add(time.Hour)) {
+		t.Errorf("Expected secret to expire in an hour, but it expires at %v", expires)
+	}
+	var creds credentials
+	expires, err := s.Get("project/myapp/db", &creds)
+	if err != nil {
+		t.Fatalf("Could not get secret: %v", err)
+	}
+	if creds != (credentials{"myapp", "hunter2"}) || !expires.Equal(s.now().Add(time.Hour)) {
+		t.Errorf("Unexpected secret %v expiring at %v", creds, expires)
+	}
+	if err := s.Update("project/myapp/db", &credentials{"myapp", "correcthorse"}, time.Hour); err != nil {
+		t.Fatalf("Could not update secret: %v", err)
+	}
+	if _, err := s.Get("project/myapp/db", &creds); err != nil || creds.Password != "correcthorse" {
+		t.Errorf("Expected updated secret, but got %v (%v)", creds, err)
+	}
+	if f.readCount("project/myapp/db") != 2 {
+		t.Errorf("Expected every Get to read the secret without caching, but it was read %v times", f.readCount("project/myapp/db"))
+	}
+	if err := s.Remove("project/myapp/db"); err != nil {
+		t.Fatalf("Could not remove secret: %v", err)
+	}
+	if _, err := s.Get("project/myapp/db", &creds); err == nil {
+		t.Errorf("Expected removed secret not to be found")
+	} else if _, ok := err.(*NotFoundError); !ok {
+		t.Errorf("Expected *NotFoundError, but got %v", err)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	s, _, advance, done := newTestStore()
+	defer done()
+	s.MaxAge = time.Hour
+	if err := s.Set("project/myapp/db", &credentials{"myapp", "hunter2"}, time.Minute); err != nil {
+		t.Fatalf("Could not set secret: %v", err)
+	}
+	advance(time.Minute)
+	var creds credentials
+	if _, err := s.Get("project/myapp/db", &creds); err == nil {
+		t.Errorf("Expected secret to have expired, but got %v", creds)
+	} else if _, ok := err.(*ExpiredError); !ok {
+		t.Errorf("Expected *ExpiredError, but got %v", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	s, f, advance, done := newTestStore()
+	defer done()
+	s.MaxAge = 5 * time.Minute
+	s.RefreshAhead = time.Minute
+	f.secrets["project/myapp/db"] = &secrets.ATaskClusterSecret{
+		Expires: secrets.Time(s.now().Add(time.Hour)),
+		Secret:  json.RawMessage(`{"username": "myapp", "password": "hunter2"}`),
+	}
+	get := func() string {
+		var creds credentials
+		if _, err := s.Get("project/myapp/db", &creds); err != nil {
+			t.Fatalf("Could not get secret: %v", err)
+		}
+		return creds.Password
+	}
+	expectReads := func(reads int) {
+		s.Wait()
+		if actual := f.readCount("project/myapp/db"); actual != reads {
+			t.Fatalf("Expected secret to have been read %v times, but it was read %v times", reads, actual)
+		}
+	}
+
+	get()
+	advance(3 * time.Minute)
+	get()
+	expectReads(1)
+
+	// within a minute of becoming stale, the cached secret is served while
+	// it is refreshed
+	f.mutex.Lock()
+	f.secrets["project/myapp/db"].Secret = json.RawMessage(`{"username": "myapp", "password": "correcthorse"}`)
+	f.mutex.Unlock()
+	advance(90 * time.Second)
+	if password := get(); password != "hunter2" {
+		t.Errorf("Expected cached secret while refreshing, but got password %v", password)
+	}
+	expectReads(2)
+	if password := get(); password != "correcthorse" {
+		t.Errorf("Expected refreshed secret, but got password %v", password)
+	}
+	expectReads(2)
+
+	// once stale, the secret is read again before it is returned
+	advance(10 * time.Minute)
+	get()
+	expectReads(3)
+	s.Forget("project/myapp/db")
+	get()
+	expectReads(4)
+}
+
+func TestWriteDuringRead(t *testing.T) {
+	s, f, _, done := newTestStore()
+	defer done()
+	s.MaxAge = 5 * time.Minute
+	f.secrets["project/myapp/db"] = &secrets.ATaskClusterSecret{
+		Expires: secrets.Time(s.now().Add(time.Hour)),
+		Secret:  json.RawMessage(`{"username": "myapp", "password": "hunter2"}`),
+	}
+	// the secret is updated after the old secret has been read, but before
+	// the read returns
+	f.afterRead = func() {
+		f.afterRead = nil
+		if err := s.Update("project/myapp/db", &credentials{"myapp", "correcthorse"}, time.Hour); err != nil {
+			t.Errorf("Could not update secret: %v", err)
+		}
+	}
+	var creds credentials
+	if _, err := s.Get("project/myapp/db", &creds); err != nil || creds.Password != "hunter2" {
+		t.Fatalf("Expected the secret read before the update, but got %v (%v)", creds, err)
+	}
+	if _, err := s.Get("project/myapp/db", &creds); err != nil || creds.Password != "correcthorse" {
+		t.Errorf("Expected the updated secret to be cached, rather than the secret read before, but got %v (%v)", creds, err)
+	}
+	if f.readCount("project/myapp/db") != 1 {
+		t.Errorf("Expected the updated secret to be served from the cache, but it was read %v times", f.readCount("project/myapp/db"))
+	}
+}
+
+func TestExpiredError(t *testing.T) {
+	err := &ExpiredError{Name: "project/myapp/db"}
+	if msg := err.Error(); msg != "secret project/myapp/db has expired" {
+		t.Errorf("Unexpected error message for unknown expiry: %v", msg)
+	}
+	err.Expires = time.Date(2015, 10, 27, 20, 36, 19, 255e6, time.UTC)
+	if msg := err.Error(); msg != "secret project/myapp/db expired at 2015-10-27T20:36:19.255Z" {
+		t.Errorf("Unexpected error message: %v", msg)
+	}
+}
@@ -0,0 +1,565 @@
+// Package taskgraph keeps an up-to-date, in-memory model of the progress of
+// a task graph: the state of the graph, and the state, runs and unresolved
+// dependencies of each of its tasks.
+//
+// A Tracker is seeded from the scheduler's Inspect end-point (see Refresh),
+// and kept up to date by the pulse messages of the scheduler about the task
+// graph (see the schedulerevents package) and of the queue about its tasks
+// (see the queueevents package), which are passed to Handle. The scheduler
+// creates the tasks of a task graph with the taskGraphId as taskGroupId, so
+// Bindings returns the bindings for both. Changes are reported to OnChange,
+// e.g. to update a dashboard, and Wait returns a Summary once the task
+// graph has finished or is blocked.
+//
+// For example:
+//
+//	tracker := taskgraph.New(myScheduler, taskGraphId)
+//	tracker.OnChange = func(change taskgraph.Change) {
+//		fmt.Println(change)
+//	}
+//	bindings, err := tracker.Bindings()
+//	if err != nil {
+//		// handle error...
+//	}
+//	conn.Consume("", tracker.Callback(), 1, true, bindings...)
+//	if err := tracker.Refresh(); err != nil {
+//		// handle error...
+//	}
+//	summary, err := tracker.Wait(context.Background())
+package taskgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/pulse-go/pulse"
+	"github.com/taskcluster/taskcluster-client-go/queueevents"
+	"github.com/taskcluster/taskcluster-client-go/scheduler"
+	"github.com/taskcluster/taskcluster-client-go/schedulerevents"
+	D "github.com/tj/go-debug"
+	"golang.org/x/net/context"
+)
+
+var (
+	// Used for logging based on DEBUG environment variable
+	// See github.com/tj/go-debug
+	debug = D.Debug("taskgraph")
+)
+
+// Task is the tracked state of a task of a task graph.
+type Task struct {
+	TaskId string
+	// Name of the task in the task graph, only known once the graph has
+	// been inspected
+	Name string
+	// State of the task: unscheduled, pending, running, completed, failed
+	// or exception
+	State string
+	// Runs of the task, in order
+	Runs []Run
+	// Tasks which must be completed before this task is scheduled
+	Requires []string
+	// Required tasks which are not completed yet, i.e. that this task is
+	// waiting for
+	RequiresLeft []string
+	// Tasks which require this task
+	Dependents []string
+	// Number of times the task may be rerun, and the number of reruns left
+	Reruns     int
+	RerunsLeft int
+}
+
+// Run is a run of a task.
+type Run struct {
+	RunId          int
+	State          string
+	ReasonCreated  string
+	ReasonResolved string
+	WorkerGroup    string
+	WorkerId       string
+	Scheduled      time.Time
+	Started        time.Time
+	Resolved       time.Time
+}
+
+// Change is a change of state of the task graph, or of one of its tasks,
+// reported to Tracker.OnChange.
+type Change struct {
+	// Task whose state changed, or empty if the state of the task graph
+	// changed
+	TaskId string
+	// Name of the task, if known
+	Name string
+	// Previous state, or empty if the task was not known before
+	OldState string
+	NewState string
+}
+
+func (c Change) String() string {
+	subject := "task graph"
+	if c.TaskId != "" {
+		subject = "task " + c.TaskId
+		if c.Name != "" {
+			subject += " (" + c.Name + ")"
+		}
+	}
+	if c.OldState == "" {
+		return fmt.Sprintf("%v is %v", subject, c.NewState)
+	}
+	return fmt.Sprintf("%v changed from %v to %v", subject, c.OldState, c.NewState)
+}
+
+// Graph is a snapshot of the state of a task graph, as returned by
+// Tracker.Graph.
+type Graph struct {
+	TaskGraphId string
+	SchedulerId string
+	// State of the task graph: running, blocked or finished, or empty if
+	// not known yet
+	State string
+	// Tasks which blocked the task graph from completion
+	BlockedBy []string
+	// Tasks of the graph, ordered by name, then taskId
+	Tasks []Task
+}
+
+// Tracker tracks the progress of a task graph. Create one with New, and set
+// OnChange if required, before passing messages to Handle.
+type Tracker struct {
+	TaskGraphId string
+	// If not nil, used by Refresh, which is also called whenever the task
+	// graph is extended, to learn about the new tasks
+	Scheduler *scheduler.Scheduler
+	// Called, if not nil, for each change of state of the task graph or
+	// one of its tasks. It is called outside of any locks, so it may call
+	// the methods of the Tracker, but it is called concurrently if Handle
+	// is.
+	OnChange func(change Change)
+
+	// protects the fields below
+	mutex       sync.Mutex
+	schedulerId string
+	state       string
+	blockedBy   []string
+	tasks       map[string]*Task
+	// closed when the task graph has finished or is blocked
+	done chan struct{}
+}
+
+// New returns a Tracker for the task graph with the given taskGraphId. If
+// myScheduler is not nil, it is used to inspect the task graph.
+func New(myScheduler *scheduler.Scheduler, taskGraphId string) *Tracker {
+	return &Tracker{
+		TaskGraphId: taskGraphId,
+		Scheduler:   myScheduler,
+		tasks:       map[string]*Task{},
+		done:        make(chan struct{}),
+	}
+}
+
+// Bindings returns the bindings for the scheduler messages about the task
+// graph, and the queue messages about its tasks, or an error if
+// t.TaskGraphId would not result in valid routing key patterns, e.g. if it
+// contains a '.'.
+func (t *Tracker) Bindings() ([]pulse.Binding, error) {
+	bindings := t.bindings()
+	for _, binding := range bindings {
+		if err := binding.(interface {
+			Validate() error
+		}).Validate(); err != nil {
+			return nil, fmt.Errorf("invalid task graph id %q: %v", t.TaskGraphId, err)
+		}
+	}
+	return bindings, nil
+}
+
+// bindings returns the bindings of Bindings, without validating them
+func (t *Tracker) bindings() []pulse.Binding {
+	id := t.TaskGraphId
+	return []pulse.Binding{
+		schedulerevents.TaskGraphRunning{TaskGraphId: id},
+		schedulerevents.TaskGraphExtended{TaskGraphId: id},
+		schedulerevents.TaskGraphBlocked{TaskGraphId: id},
+		schedulerevents.TaskGraphFinished{TaskGraphId: id},
+		queueevents.TaskDefined{TaskGroupId: id},
+		queueevents.TaskPending{TaskGroupId: id},
+		queueevents.TaskRunning{TaskGroupId: id},
+		queueevents.TaskCompleted{TaskGroupId: id},
+		queueevents.TaskFailed{TaskGroupId: id},
+		queueevents.TaskException{TaskGroupId: id},
+	}
+}
+
+// Refresh inspects the task graph with t.Scheduler, adding any tasks which
+// are not tracked yet, and updating the states of tasks which have not been
+// updated by more recent messages.
+func (t *Tracker) Refresh() error {
+	if t.Scheduler == nil {
+		return fmt.Errorf("cannot inspect task graph %v without a scheduler", t.TaskGraphId)
+	}
+	inspection, callSummary := t.Scheduler.Inspect(t.TaskGraphId)
+	if callSummary.Error != nil {
+		return fmt.Errorf("could not inspect task graph %v: %v", t.TaskGraphId, callSummary.Error)
+	}
+	t.Seed(inspection)
+	return nil
+}
+
+// Seed updates the tracker from the result of inspecting the task graph
+// with Scheduler.Inspect, as Refresh does.
+func (t *Tracker) Seed(inspection *scheduler.InspectTaskGraphResponse) {
+	changes := []Change{}
+	t.mutex.Lock()
+	t.schedulerId = inspection.Status.SchedulerId
+	if inspection.Status.State != "" && (t.state == "" || t.state == "running") {
+		changes = t.setState(changes, inspection.Status.State)
+	}
+	for _, it := range inspection.Tasks {
+		task, ok := t.tasks[it.TaskId]
+		if !ok {
+			task = &Task{TaskId: it.TaskId}
+			t.tasks[it.TaskId] = task
+		}
+		task.Name = it.Name
+		task.Requires = it.Requires
+		task.RequiresLeft = it.RequiresLeft
+		task.Dependents = it.Dependents
+		task.Reruns = it.Reruns
+		task.RerunsLeft = it.RerunsLeft
+		// the state of the task may have been updated by a message after
+		// the inspection was made
+		if !ok || rank(it.State) > rank(task.State) && len(task.Runs) == 0 {
+			changes = append(changes, Change{TaskId: task.TaskId, Name: task.Name, OldState: task.State, NewState: it.State})
+			task.State = it.State
+		}
+	}
+	// required tasks may have completed after the inspection was made
+	for _, task := range t.tasks {
+		for _, id := range task.RequiresLeft {
+			if r, ok := t.tasks[id]; ok && r.State == "completed" {
+				task.RequiresLeft = remove(task.RequiresLeft, id)
+			}
+		}
+	}
+	t.mutex.Unlock()
+	t.notify(changes)
+}
+
+// Handle updates the tracker from a pulse message from one of the
+// exchanges of Bindings, where message is the message body decoded into
+// the payload object of its binding, or nil, in which case the body is
+// decoded. It can be used as a pulseconsumer.Handler; see Callback for
+// pulse.Connection.Consume. Messages about other task graphs are ignored.
+func (t *Tracker) Handle(message interface{}, delivery amqp.Delivery) error {
+	if message == nil {
+		for _, binding := range t.bindings() {
+			if binding.ExchangeName() == delivery.Exchange {
+				message = binding.NewPayloadObject()
+				if err := json.Unmarshal(delivery.Body, message); err != nil {
+					return fmt.Errorf("could not decode message from exchange %v: %v", delivery.Exchange, err)
+				}
+			}
+		}
+	}
+	var changes []Change
+	extended := false
+	t.mutex.Lock()
+	switch m := message.(type) {
+	case *schedulerevents.NewTaskGraphMessage:
+		changes = t.updateGraph(m.Status.TaskGraphId, m.Status.State, "")
+	case *schedulerevents.TaskGraphExtendedMessage:
+		changes = t.updateGraph(m.Status.TaskGraphId, m.Status.State, "")
+		extended = m.Status.TaskGraphId == t.TaskGraphId
+	case *schedulerevents.BlockedTaskGraphMessage:
+		changes = t.updateGraph(m.Status.TaskGraphId, m.Status.State, m.TaskId)
+	case *schedulerevents.TaskGraphFinishedMessage:
+		changes = t.updateGraph(m.Status.TaskGraphId, m.Status.State, "")
+	case *queueevents.TaskDefinedMessage:
+		changes = t.updateTask(&m.Status)
+	case *queueevents.TaskPendingMessage:
+		changes = t.updateTask(&m.Status)
+	case *queueevents.TaskRunningMessage:
+		changes = t.updateTask(&m.Status)
+	case *queueevents.TaskCompletedMessage:
+		changes = t.updateTask(&m.Status)
+	case *queueevents.TaskFailedMessage:
+		changes = t.updateTask(&m.Status)
+	case *queueevents.TaskExceptionMessage:
+		changes = t.updateTask(&m.Status)
+	default:
+		debug("Ignoring message of type %T from exchange %v", message, delivery.Exchange)
+	}
+	t.mutex.Unlock()
+	t.notify(changes)
+	if extended && t.Scheduler != nil {
+		return t.Refresh()
+	}
+	return nil
+}
+
+// Callback returns a callback for pulse.Connection.Consume with autoAck,
+// which calls Handle, and logs its errors, since the message cannot be
+// requeued.
+func (t *Tracker) Callback() func(message interface{}, delivery amqp.Delivery) {
+	return func(message interface{}, delivery amqp.Delivery) {
+		if err := t.Handle(message, delivery); err != nil {
+			debug("Could not handle message from %v with routing key %v: %v", delivery.Exchange, delivery.RoutingKey, err)
+		}
+	}
+}
+
+// updateGraph updates the state of the task graph, if taskGraphId is the
+// tracked task graph, and records blockedBy as blocking it, if not empty
+// and not recorded already, e.g. by a redelivered message. It must be
+// called with t.mutex held.
+func (t *Tracker) updateGraph(taskGraphId, state, blockedBy string) []Change {
+	if taskGraphId != t.TaskGraphId {
+		return nil
+	}
+	if blockedBy != "" && !contains(t.blockedBy, blockedBy) {
+		t.blockedBy = append(t.blockedBy, blockedBy)
+	}
+	return t.setState(nil, state)
+}
+
+// setState sets the state of the task graph, appending the change to
+// changes, if any. It must be called with t.mutex held.
+func (t *Tracker) setState(changes []Change, state string) []Change {
+	if state == t.state {
+		return changes
+	}
+	changes = append(changes, Change{OldState: t.state, NewState: state})
+	t.state = state
+	if state == "finished" || state == "blocked" {
+		select {
+		case <-t.done:
+		default:
+			close(t.done)
+		}
+	}
+	return changes
+}
+
+// updateTask updates the task with the given status, if it belongs to the
+// tracked task graph, unless the tracked state is more recent. It must be
+// called with t.mutex held.
+func (t *Tracker) updateTask(status *queueevents.TaskStatusStructure) []Change {
+	if status.TaskGroupId != t.TaskGraphId {
+		return nil
+	}
+	task, ok := t.tasks[status.TaskId]
+	if !ok {
+		task = &Task{TaskId: status.TaskId}
+		t.tasks[status.TaskId] = task
+	}
+	// messages may be delivered out of order, or redelivered
+	if len(status.Runs) < len(task.Runs) || len(status.Runs) == len(task.Runs) && rank(status.State) < rank(task.State) {
+		return nil
+	}
+	task.Runs = make([]Run, len(status.Runs))
+	for i, r := range status.Runs {
+		task.Runs[i] = Run{
+			RunId:          r.RunId,
+			State:          r.State,
+			ReasonCreated:  r.ReasonCreated,
+			ReasonResolved: r.ReasonResolved,
+			WorkerGroup:    r.WorkerGroup,
+			WorkerId:       r.WorkerId,
+			Scheduled:      time.Time(r.Scheduled),
+			Started:        time.Time(r.Started),
+			Resolved:       time.Time(r.Resolved),
+		}
+	}
+	if task.State == status.State {
+		return nil
+	}
+	changes := []Change{{TaskId: task.TaskId, Name: task.Name, OldState: task.State, NewState: status.State}}
+	task.State = status.State
+	// dependents no longer wait for a completed task
+	if status.State == "completed" {
+		for _, dependent := range task.Dependents {
+			if d, ok := t.tasks[dependent]; ok {
+				d.RequiresLeft = remove(d.RequiresLeft, task.TaskId)
+			}
+		}
+	}
+	return changes
+}
+
+// notify reports changes to t.OnChange
+func (t *Tracker) notify(changes []Change) {
+	for _, change := range changes {
+		debug("Task graph %v: %v", t.TaskGraphId, change)
+		if t.OnChange != nil {
+			t.OnChange(change)
+		}
+	}
+}
+
+// Graph returns a snapshot of the current state of the task graph.
+func (t *Tracker) Graph() *Graph {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	g := &Graph{
+		TaskGraphId: t.TaskGraphId,
+		SchedulerId: t.schedulerId,
+		State:       t.state,
+		BlockedBy:   append([]string{}, t.blockedBy...),
+		Tasks:       make([]Task, 0, len(t.tasks)),
+	}
+	for _, task := range t.tasks {
+		c := *task
+		c.Runs = append([]Run{}, task.Runs...)
+		c.Requires = append([]string{}, task.Requires...)
+		c.RequiresLeft = append([]string{}, task.RequiresLeft...)
+		c.Dependents = append([]string{}, task.Dependents...)
+		g.Tasks = append(g.Tasks, c)
+	}
+	sort.Sort(byName(g.Tasks))
+	return g
+}
+
+// Task returns a snapshot of the current state of the task with the given
+// taskId, or nil if it is not tracked.
+func (t *Tracker) Task(taskId string) *Task {
+	for _, task := range t.Graph().Tasks {
+		if task.TaskId == taskId {
+			return &task
+		}
+	}
+	return nil
+}
+
+// Done returns a channel which is closed when the task graph has finished
+// or is blocked.
+func (t *Tracker) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait blocks until the task graph has finished or is blocked, and returns
+// its summary, or until ctx is done.
+func (t *Tracker) Wait(ctx context.Context) (*Summary, error) {
+	select {
+	case <-t.done:
+		return t.Summary(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Summary summarizes the state of a task graph, as returned by
+// Tracker.Summary.
+type Summary struct {
+	TaskGraphId string
+	State       string
+	// Number of tasks in each state
+	Tasks map[string]int
+	// Tasks which failed or had an exception in their last run
+	Failed []string
+	// Tasks which blocked the task graph from completion
+	BlockedBy []string
+	// Number of runs of all tasks
+	Runs int
+	// When the first run was scheduled, and when the last run was resolved
+	Scheduled time.Time
+	Resolved  time.Time
+}
+
+// Summary returns a summary of the current state of the task graph.
+func (t *Tracker) Summary() *Summary {
+	g := t.Graph()
+	s := &Summary{
+		TaskGraphId: g.TaskGraphId,
+		State:       g.State,
+		Tasks:       map[string]int{},
+		Failed:      []string{},
+		BlockedBy:   g.BlockedBy,
+	}
+	for _, task := range g.Tasks {
+		s.Tasks[task.State]++
+		if task.State == "failed" || task.State == "exception" {
+			s.Failed = append(s.Failed, task.TaskId)
+		}
+		for _, run := range task.Runs {
+			s.Runs++
+			if !run.Scheduled.IsZero() && (s.Scheduled.IsZero() || run.Scheduled.Before(s.Scheduled)) {
+				s.Scheduled = run.Scheduled
+			}
+			if run.Resolved.After(s.Resolved) {
+				s.Resolved = run.Resolved
+			}
+		}
+	}
+	return s
+}
+
+// String returns a one line description of the summary, e.g. "task graph
+// <taskGraphId> is finished: 3 tasks (3 completed), 4 runs in 12m0s".
+func (s *Summary) String() string {
+	total := 0
+	states := make([]string, 0, len(s.Tasks))
+	for state, n := range s.Tasks {
+		total += n
+		states = append(states, fmt.Sprintf("%v %v", n, state))
+	}
+	sort.Strings(states)
+	result := fmt.Sprintf("task graph %v is %v: %v tasks (%v), %v runs", s.TaskGraphId, s.State, total, strings.Join(states, ", "), s.Runs)
+	if !s.Scheduled.IsZero() && s.Resolved.After(s.Scheduled) {
+		result += fmt.Sprintf(" in %v", s.Resolved.Sub(s.Scheduled))
+	}
+	if len(s.BlockedBy) > 0 {
+		result += fmt.Sprintf(", blocked by %v", strings.Join(s.BlockedBy, ", "))
+	}
+	return result
+}
+
+// rank orders task states by progress
+func rank(state string) int {
+	switch state {
+	case "pending":
+		return 1
+	case "running":
+		return 2
+	case "completed", "failed", "exception":
+		return 3
+	}
+	return 0
+}
+
+// remove returns ids without id
+func remove(ids []string, id string) []string {
+	result := []string{}
+	for _, i := range ids {
+		if i != id {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// byName sorts tasks by name, then taskId
+type byName []Task
+
+func (b byName) Len() int      { return len(b) }
+func (b byName) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byName) Less(i, j int) bool {
+	if b[i].Name != b[j].Name {
+		return b[i].Name < b[j].Name
+	}
+	return b[i].TaskId < b[j].TaskId
+}
+
+// contains reports whether ids includes id
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
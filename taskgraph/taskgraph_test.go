@@ -0,0 +1,234 @@
+package taskgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/taskcluster-client-go/pulsetest"
+	"github.com/taskcluster/taskcluster-client-go/queueevents"
+	"github.com/taskcluster/taskcluster-client-go/scheduler"
+	"github.com/taskcluster/taskcluster-client-go/schedulerevents"
+	"golang.org/x/net/context"
+)
+
+const graphId = "graph1"
+
+// inspection returns an inspect response for tasks build and test, which
+// requires build, and lint if extended
+func inspection(extended bool) string {
+	tasks := `
+		{"taskId": "build1", "name": "build", "requires": [], "requiresLeft": [], "dependents": ["test1"], "reruns": 0, "rerunsLeft": 0, "satisfied": false, "state": "pending"},
+		{"taskId": "test1", "name": "test", "requires": ["build1"], "requiresLeft": ["build1"], "dependents": [], "reruns": 2, "rerunsLeft": 2, "satisfied": false, "state": "unscheduled"}`
+	if extended {
+		tasks += `,
+		{"taskId": "lint1", "name": "lint", "requires": [], "requiresLeft": [], "dependents": [], "reruns": 0, "rerunsLeft": 0, "satisfied": false, "state": "pending"}`
+	}
+	return `{
+		"status": {"taskGraphId": "` + graphId + `", "schedulerId": "task-graph-scheduler", "state": "running"},
+		"metadata": {"name": "ci", "description": "", "owner": "me@example.com", "source": "https://example.com"},
+		"scopes": [],
+		"tags": {},
+		"tasks": [` + tasks + `]
+	}`
+}
+
+// status returns a queue task status with the given number of runs, the
+// last of which has the given state
+func status(t *testing.T, taskId, state string, runs int) queueevents.TaskStatusStructure {
+	r := []string{}
+	for i := 0; i < runs; i++ {
+		runState := "failed"
+		if i == runs-1 {
+			runState = state
+		}
+		r = append(r, fmt.Sprintf(`{"runId": %v, "state": %q, "reasonCreated": "scheduled", "scheduled": "2015-10-21T15:0%v:00.000Z", "resolved": "2015-10-21T15:1%v:00.000Z"}`, i, runState, i, i))
+	}
+	var s queueevents.TaskStatusStructure
+	data := fmt.Sprintf(`{"taskId": %q, "taskGroupId": %q, "state": %q, "runs": [%v]}`, taskId, graphId, state, strings.Join(r, ","))
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		t.Fatalf("Could not unmarshal status: %v", err)
+	}
+	return s
+}
+
+func graphStatus(state string) schedulerevents.TaskGraphStatusStructure {
+	return schedulerevents.TaskGraphStatusStructure{TaskGraphId: graphId, SchedulerId: "task-graph-scheduler", State: state}
+}
+
+func newTracker(t *testing.T) (*Tracker, *[]string, func(extended bool)) {
+	var mutex sync.Mutex
+	extended := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/task-graph/"+graphId+"/inspect" {
+			http.NotFound(w, r)
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		fmt.Fprint(w, inspection(extended))
+	}))
+	myScheduler := scheduler.New("", "")
+	myScheduler.BaseURL = server.URL
+	tracker := New(myScheduler, graphId)
+	changes := &[]string{}
+	tracker.OnChange = func(change Change) {
+		*changes = append(*changes, change.String())
+	}
+	return tracker, changes, func(e bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		extended = e
+	}
+}
+
+func handle(t *testing.T, tracker *Tracker, message interface{}) {
+	if err := tracker.Handle(message, amqp.Delivery{}); err != nil {
+		t.Fatalf("Could not handle message %#v: %v", message, err)
+	}
+}
+
+func TestTrackGraph(t *testing.T) {
+	tracker, changes, extend := newTracker(t)
+	if err := tracker.Refresh(); err != nil {
+		t.Fatalf("Could not refresh: %v", err)
+	}
+	expected := []string{
+		"task graph is running",
+		"task build1 (build) is pending",
+		"task test1 (test) is unscheduled",
+	}
+	if !reflect.DeepEqual(*changes, expected) {
+		t.Errorf("Expected changes %q, but got %q", expected, *changes)
+	}
+
+	*changes = nil
+	handle(t, tracker, &queueevents.TaskRunningMessage{Status: status(t, "build1", "running", 1)})
+	// late and redelivered messages are ignored
+	handle(t, tracker, &queueevents.TaskPendingMessage{Status: status(t, "build1", "pending", 1)})
+	handle(t, tracker, &queueevents.TaskRunningMessage{Status: status(t, "build1", "running", 1)})
+	// messages about tasks of other groups are ignored
+	other := status(t, "other1", "completed", 1)
+	other.TaskGroupId = "graph2"
+	handle(t, tracker, &queueevents.TaskCompletedMessage{Status: other})
+	if test := tracker.Task("test1"); !reflect.DeepEqual(test.RequiresLeft, []string{"build1"}) {
+		t.Errorf("Expected test to wait for build, but waits for %v", test.RequiresLeft)
+	}
+	handle(t, tracker, &queueevents.TaskCompletedMessage{Status: status(t, "build1", "completed", 1)})
+	if test := tracker.Task("test1"); len(test.RequiresLeft) != 0 {
+		t.Errorf("Expected test to wait for no tasks once build completed, but waits for %v", test.RequiresLeft)
+	}
+
+	// extending the graph refreshes it
+	extend(true)
+	handle(t, tracker, &schedulerevents.TaskGraphExtendedMessage{Status: graphStatus("running")})
+	if lint := tracker.Task("lint1"); lint == nil || lint.Name != "lint" || lint.State != "pending" {
+		t.Errorf("Expected extended graph to include pending lint task, but got %#v", lint)
+	}
+	// a refresh does not undo more recent states
+	if err := tracker.Refresh(); err != nil {
+		t.Fatalf("Could not refresh: %v", err)
+	}
+	if build := tracker.Task("build1"); build.State != "completed" || len(build.Runs) != 1 {
+		t.Errorf("Expected build to stay completed after refresh, but got %#v", build)
+	}
+
+	// messages decoded by Handle
+	body, _ := json.Marshal(&queueevents.TaskFailedMessage{Status: status(t, "test1", "failed", 3)})
+	if err := tracker.Handle(nil, amqp.Delivery{Exchange: queueevents.TaskFailed{}.ExchangeName(), Body: body}); err != nil {
+		t.Fatalf("Could not handle undecoded message: %v", err)
+	}
+	handle(t, tracker, &queueevents.TaskCompletedMessage{Status: status(t, "lint1", "completed", 1)})
+	select {
+	case <-tracker.Done():
+		t.Error("Expected task graph not to be done before it is blocked")
+	default:
+	}
+	handle(t, tracker, &schedulerevents.BlockedTaskGraphMessage{Status: graphStatus("blocked"), TaskId: "test1"})
+	// redelivered
+	handle(t, tracker, &schedulerevents.BlockedTaskGraphMessage{Status: graphStatus("blocked"), TaskId: "test1"})
+
+	expected = []string{
+		"task build1 (build) changed from pending to running",
+		"task build1 (build) changed from running to completed",
+		"task lint1 (lint) is pending",
+		"task test1 (test) changed from unscheduled to failed",
+		"task lint1 (lint) changed from pending to completed",
+		"task graph changed from running to blocked",
+	}
+	if !reflect.DeepEqual(*changes, expected) {
+		t.Errorf("Expected changes %q, but got %q", expected, *changes)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	summary, err := tracker.Wait(ctx)
+	if err != nil {
+		t.Fatalf("Could not wait for task graph: %v", err)
+	}
+	if summary.State != "blocked" || summary.Runs != 5 || !reflect.DeepEqual(summary.Failed, []string{"test1"}) || !reflect.DeepEqual(summary.BlockedBy, []string{"test1"}) {
+		t.Errorf("Wrong summary %#v", summary)
+	}
+	if s := summary.String(); s != "task graph graph1 is blocked: 3 tasks (1 failed, 2 completed), 5 runs in 12m0s, blocked by test1" {
+		t.Errorf("Wrong summary string %q", s)
+	}
+	graph := tracker.Graph()
+	if names := []string{graph.Tasks[0].Name, graph.Tasks[1].Name, graph.Tasks[2].Name}; !reflect.DeepEqual(names, []string{"build", "lint", "test"}) {
+		t.Errorf("Expected tasks ordered by name, but got %v", names)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	tracker := New(nil, graphId)
+	handle(t, tracker, &schedulerevents.NewTaskGraphMessage{Status: graphStatus("running")})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := tracker.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline to be exceeded, but got %v", err)
+	}
+	if err := tracker.Refresh(); err == nil {
+		t.Error("Expected Refresh to fail without a scheduler")
+	}
+}
+
+func TestBindings(t *testing.T) {
+	bindings, err := New(nil, graphId).Bindings()
+	if err != nil || len(bindings) != 10 {
+		t.Errorf("Expected 10 bindings, but got %v (%v)", len(bindings), err)
+	}
+	if _, err := New(nil, "a.b").Bindings(); err == nil {
+		t.Error("Expected invalid task graph id to be reported")
+	}
+}
+
+func TestCallback(t *testing.T) {
+	tracker := New(nil, graphId)
+	bindings, err := tracker.Bindings()
+	if err != nil {
+		t.Fatalf("Could not get bindings: %v", err)
+	}
+	broker := pulsetest.NewBroker()
+	var callback func(interface{}, amqp.Delivery) = tracker.Callback()
+	q, err := broker.Consume("", callback, 1, true, bindings...)
+	if err != nil {
+		t.Fatalf("Could not consume: %v", err)
+	}
+	defer q.Cancel()
+	binding := schedulerevents.TaskGraphRunning{SchedulerId: "task-graph-scheduler", TaskGraphId: graphId}
+	if err := broker.PublishMessage(binding, &schedulerevents.NewTaskGraphMessage{Version: 1, Status: graphStatus("running")}); err != nil {
+		t.Fatalf("Could not publish message: %v", err)
+	}
+	if err := q.WaitIdle(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if state := tracker.Graph().State; state != "running" {
+		t.Errorf("Expected task graph to be running, but got %q", state)
+	}
+}
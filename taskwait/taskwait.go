@@ -0,0 +1,233 @@
+// Package taskwait provides a way to block until one or more tasks have been
+// resolved, i.e. have reached state `completed`, `failed` or `exception`.
+//
+// If a pulse connection is available, task resolution is detected by
+// listening for messages on the queue's task-completed, task-failed and
+// task-exception exchanges (see the queueevents package). The queue Status
+// end-point is still polled occasionally as a safety net, since pulse
+// messages may be missed, e.g. if the task resolved before the subscription
+// was in place. Without a pulse connection, Status is polled with an
+// exponential backoff.
+//
+// For example:
+//
+//	myQueue := queue.New("", "")
+//	statuses, err := taskwait.New(myQueue, nil).WaitAll(taskId1, taskId2)
+//	if err != nil {
+//		// handle error...
+//	}
+//	fmt.Println(statuses[taskId1].State)
+package taskwait
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/pulse-go/pulse"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-client-go/queueevents"
+	D "github.com/tj/go-debug"
+)
+
+var (
+	// Used for logging based on DEBUG environment variable
+	// See github.com/tj/go-debug
+	debug = D.Debug("taskwait")
+
+	// ErrTimeout is returned when not all tasks were resolved within
+	// Waiter.Timeout.
+	ErrTimeout = errors.New("timed out waiting for tasks to be resolved")
+)
+
+// Waiter waits for tasks to be resolved. Create one with New, and adjust
+// the polling parameters if required, before calling Wait or WaitAll.
+type Waiter struct {
+	// Queue used to poll task status
+	Queue *queue.Queue
+	// If not nil, used to listen for task resolution messages
+	Connection *pulse.Connection
+	// Interval before the first status poll, when not using pulse
+	InitialInterval time.Duration
+	// Upper bound for the interval between status polls. When using pulse,
+	// status is polled at this interval.
+	MaxInterval time.Duration
+	// Factor by which the polling interval grows after each poll
+	Multiplier float64
+	// Give up waiting after this duration (0 means wait forever)
+	Timeout time.Duration
+
+	// subscribes callback to messages matching bindings, returning a
+	// function to cancel the subscription; overridden in tests
+	subscribe func(callback func(interface{}, amqp.Delivery), bindings []pulse.Binding) (cancel func(), err error)
+}
+
+// New returns a Waiter which polls myQueue for task status, and listens for
+// task resolution messages using conn if it is not nil.
+func New(myQueue *queue.Queue, conn *pulse.Connection) *Waiter {
+	return &Waiter{
+		Queue:           myQueue,
+		Connection:      conn,
+		InitialInterval: 5 * time.Second,
+		MaxInterval:     2 * time.Minute,
+		Multiplier:      1.5,
+	}
+}
+
+// Resolved returns true if the given task state is a terminal state.
+func Resolved(state string) bool {
+	switch state {
+	case "completed", "failed", "exception":
+		return true
+	}
+	return false
+}
+
+// Wait blocks until task taskId is resolved, and returns its final status.
+func (w *Waiter) Wait(taskId string) (*queue.TaskStatusStructure, error) {
+	statuses, err := w.WaitAll(taskId)
+	return statuses[taskId], err
+}
+
+// WaitAll blocks until all of the given tasks are resolved, and returns the
+// final status of each task, keyed by taskId. If an error occurs, or
+// w.Timeout is exceeded, the statuses of the tasks resolved so far are
+// returned together with the error.
+func (w *Waiter) WaitAll(taskIds ...string) (map[string]*queue.TaskStatusStructure, error) {
+	results := make(map[string]*queue.TaskStatusStructure, len(taskIds))
+	unresolved := make(map[string]bool, len(taskIds))
+	for _, taskId := range taskIds {
+		unresolved[taskId] = true
+	}
+
+	// closed on return, so that late pulse messages are discarded
+	done := make(chan struct{})
+	defer close(done)
+	resolved := make(chan *queue.TaskStatusStructure)
+
+	interval := w.InitialInterval
+	listening := false
+	if w.Connection != nil || w.subscribe != nil {
+		bindings := make([]pulse.Binding, 0, 3*len(unresolved))
+		for taskId := range unresolved {
+			completed := queueevents.TaskCompleted{TaskId: taskId}
+			failed := queueevents.TaskFailed{TaskId: taskId}
+			exception := queueevents.TaskException{TaskId: taskId}
+			if err := queueevents.ValidateBindings(completed, failed, exception); err != nil {
+				return results, fmt.Errorf("cannot listen for resolution of task %v: %v", taskId, err)
+			}
+			bindings = append(bindings, completed, failed, exception)
+		}
+		cancel, err := w.listen(
+			func(message interface{}, delivery amqp.Delivery) {
+				status, err := statusFromMessage(message)
+				if err != nil {
+					debug("Ignoring message: %v", err)
+					return
+				}
+				select {
+				case resolved <- status:
+				case <-done:
+				}
+			},
+			bindings,
+		)
+		if err != nil {
+			// fall back to polling with backoff
+			debug("Could not listen for task resolution messages, polling instead: %v", err)
+		} else {
+			defer cancel()
+			listening = true
+			interval = w.MaxInterval
+		}
+	}
+
+	var timeout <-chan time.Time
+	if w.Timeout > 0 {
+		timeout = time.After(w.Timeout)
+	}
+
+	// poll immediately, in case tasks were resolved before we started
+	// listening for messages
+	poll := true
+	for len(unresolved) > 0 {
+		if poll {
+			for taskId := range unresolved {
+				tsr, callSummary := w.Queue.Status(taskId)
+				if callSummary.Error != nil {
+					return results, fmt.Errorf("could not get status of task %v: %v", taskId, callSummary.Error)
+				}
+				if Resolved(tsr.Status.State) {
+					results[taskId] = &tsr.Status
+					delete(unresolved, taskId)
+				}
+			}
+			poll = false
+			continue
+		}
+		select {
+		case status := <-resolved:
+			if unresolved[status.TaskId] {
+				results[status.TaskId] = status
+				delete(unresolved, status.TaskId)
+			}
+		case <-time.After(interval):
+			poll = true
+			if !listening {
+				interval = time.Duration(float64(interval) * w.Multiplier)
+				if interval > w.MaxInterval {
+					interval = w.MaxInterval
+				}
+			}
+		case <-timeout:
+			return results, ErrTimeout
+		}
+	}
+	return results, nil
+}
+
+// listen subscribes callback to messages matching bindings, on an anonymous
+// queue of w.Connection with automatic acknowledgement, unless w.subscribe
+// is set. It returns a function to cancel the subscription.
+func (w *Waiter) listen(callback func(interface{}, amqp.Delivery), bindings []pulse.Binding) (func(), error) {
+	if w.subscribe != nil {
+		return w.subscribe(callback, bindings)
+	}
+	pulseQueue, err := w.Connection.Consume(
+		"", // anonymous queue
+		callback,
+		1,    // prefetch
+		true, // auto acknowledge
+		bindings...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pulseQueue.Close, nil
+}
+
+// statusFromMessage extracts the task status from a task resolution message.
+// The queueevents and queue packages are generated from the same task status
+// schema, so the conversion is done via json.
+func statusFromMessage(message interface{}) (*queue.TaskStatusStructure, error) {
+	var status queueevents.TaskStatusStructure
+	switch t := message.(type) {
+	case *queueevents.TaskCompletedMessage:
+		status = t.Status
+	case *queueevents.TaskFailedMessage:
+		status = t.Status
+	case *queueevents.TaskExceptionMessage:
+		status = t.Status
+	default:
+		return nil, fmt.Errorf("unexpected message type %T", message)
+	}
+	data, err := json.Marshal(&status)
+	if err != nil {
+		return nil, err
+	}
+	result := new(queue.TaskStatusStructure)
+	err = json.Unmarshal(data, result)
+	return result, err
+}
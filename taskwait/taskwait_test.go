@@ -0,0 +1,198 @@
+package taskwait
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/pulse-go/pulse"
+	"github.com/taskcluster/taskcluster-client-go/pulsetest"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-client-go/queueevents"
+)
+
+// Without a pulse connection, the waiter should poll the queue until all
+// tasks have reached a terminal state.
+func TestWaitAllPolling(t *testing.T) {
+	var mutex sync.Mutex
+	polls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// path is /task/<taskId>/status
+		taskId := strings.Split(r.URL.Path, "/")[2]
+		mutex.Lock()
+		polls[taskId]++
+		n := polls[taskId]
+		mutex.Unlock()
+		state := "running"
+		switch {
+		case taskId == "A" && n >= 2:
+			state = "completed"
+		case taskId == "B" && n >= 3:
+			state = "exception"
+		}
+		w.Write([]byte(`{"status": {"taskId": "` + taskId + `", "state": "` + state + `"}}`))
+	}))
+	defer server.Close()
+
+	myQueue := queue.New("", "")
+	myQueue.BaseURL = server.URL
+	waiter := New(myQueue, nil)
+	waiter.InitialInterval = time.Millisecond
+	waiter.MaxInterval = 5 * time.Millisecond
+	waiter.Timeout = 5 * time.Second
+
+	statuses, err := waiter.WaitAll("A", "B")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s := statuses["A"].State; s != "completed" {
+		t.Errorf("Expected task A to be completed, but was %v", s)
+	}
+	if s := statuses["B"].State; s != "exception" {
+		t.Errorf("Expected task B to be exception, but was %v", s)
+	}
+	if polls["A"] != 2 {
+		t.Errorf("Expected task A status to be polled twice, but was polled %v times", polls["A"])
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": {"taskId": "A", "state": "pending"}}`))
+	}))
+	defer server.Close()
+
+	myQueue := queue.New("", "")
+	myQueue.BaseURL = server.URL
+	waiter := New(myQueue, nil)
+	waiter.InitialInterval = time.Millisecond
+	waiter.Timeout = 20 * time.Millisecond
+
+	if _, err := waiter.Wait("A"); err != ErrTimeout {
+		t.Errorf("Expected ErrTimeout, but got %v", err)
+	}
+}
+
+// statusServer serves the status of tasks, which are running until their
+// nth poll, given by resolveAt (or forever if absent), when they have
+// completed. It returns the number of polls of each task.
+func statusServer(resolveAt map[string]int) (*httptest.Server, func() map[string]int) {
+	var mutex sync.Mutex
+	polls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		taskId := strings.Split(r.URL.Path, "/")[2]
+		mutex.Lock()
+		polls[taskId]++
+		state := "running"
+		if n := resolveAt[taskId]; n > 0 && polls[taskId] >= n {
+			state = "completed"
+		}
+		mutex.Unlock()
+		w.Write([]byte(`{"status": {"taskId": "` + taskId + `", "state": "` + state + `"}}`))
+	}))
+	return server, func() map[string]int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		result := map[string]int{}
+		for taskId, n := range polls {
+			result[taskId] = n
+		}
+		return result
+	}
+}
+
+// With pulse, tasks should be resolved by messages, without waiting for the
+// next status poll, and the subscription should be cancelled on return.
+func TestWaitAllPulse(t *testing.T) {
+	server, polls := statusServer(nil)
+	defer server.Close()
+	myQueue := queue.New("", "")
+	myQueue.BaseURL = server.URL
+	waiter := New(myQueue, nil)
+	waiter.MaxInterval = time.Hour
+	waiter.Timeout = 5 * time.Second
+
+	broker := pulsetest.NewBroker()
+	subscribed := make(chan *pulsetest.Queue, 1)
+	waiter.subscribe = func(callback func(interface{}, amqp.Delivery), bindings []pulse.Binding) (func(), error) {
+		q, err := broker.Consume("", callback, 1, true, bindings...)
+		if err != nil {
+			return nil, err
+		}
+		subscribed <- q
+		return q.Cancel, nil
+	}
+	go func() {
+		q := <-subscribed
+		for _, taskId := range []string{"A", "B", "C"} {
+			binding := queueevents.TaskFailed{TaskId: taskId, RunId: "0", WorkerGroup: "us-west-2", WorkerId: "i-0a1b2c3d", ProvisionerId: "aws-provisioner", WorkerType: "gaia", SchedulerId: "-", TaskGroupId: taskId}
+			message := &queueevents.TaskFailedMessage{WorkerGroup: "us-west-2", WorkerId: "i-0a1b2c3d"}
+			message.Status.TaskId = taskId
+			message.Status.State = "failed"
+			// C is not waited for, so its message is ignored
+			if err := broker.PublishMessage(binding, message); err != nil {
+				t.Errorf("Could not publish message: %v", err)
+			}
+		}
+		q.WaitIdle(time.Second)
+	}()
+
+	statuses, err := waiter.WaitAll("A", "B")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if statuses["A"].State != "failed" || statuses["B"].State != "failed" {
+		t.Errorf("Expected tasks A and B to have failed, but got %v and %v", statuses["A"].State, statuses["B"].State)
+	}
+	if _, ok := statuses["C"]; ok {
+		t.Errorf("Unexpected status of task C")
+	}
+	if p := polls(); p["A"] != 1 || p["B"] != 1 {
+		t.Errorf("Expected tasks to be polled once, but got %v", p)
+	}
+	if broker.Queue("anonymous-1") != nil {
+		t.Errorf("Expected subscription to be cancelled")
+	}
+}
+
+// If the subscription fails, the waiter should poll with backoff, rather
+// than at the maximum interval.
+func TestWaitAllPulseFailure(t *testing.T) {
+	server, polls := statusServer(map[string]int{"A": 3})
+	defer server.Close()
+	myQueue := queue.New("", "")
+	myQueue.BaseURL = server.URL
+	waiter := New(myQueue, nil)
+	waiter.InitialInterval = time.Millisecond
+	waiter.MaxInterval = time.Hour
+	waiter.Timeout = 5 * time.Second
+	waiter.subscribe = func(callback func(interface{}, amqp.Delivery), bindings []pulse.Binding) (func(), error) {
+		return nil, errors.New("connection refused")
+	}
+
+	status, err := waiter.Wait("A")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.State != "completed" || polls()["A"] != 3 {
+		t.Errorf("Expected task A to be completed after 3 polls, but got %v after %v", status.State, polls()["A"])
+	}
+}
+
+// A taskId which is not a valid routing key word should be reported, rather
+// than listening with the wrong routing key pattern.
+func TestWaitAllInvalidTaskId(t *testing.T) {
+	waiter := New(queue.New("", ""), nil)
+	waiter.subscribe = func(callback func(interface{}, amqp.Delivery), bindings []pulse.Binding) (func(), error) {
+		t.Error("Unexpected subscription")
+		return func() {}, nil
+	}
+	if _, err := waiter.WaitAll("A.B"); err == nil {
+		t.Error("Expected invalid taskId to be reported")
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/streadway/amqp"
+	"github.com/taskcluster/pulse-go/pulse"
+	"github.com/taskcluster/taskcluster-client-go/awsprovisionerevents"
+	"github.com/taskcluster/taskcluster-client-go/pulseconsumer"
+	"github.com/taskcluster/taskcluster-client-go/purgecacheevents"
+	"github.com/taskcluster/taskcluster-client-go/queueevents"
+	"github.com/taskcluster/taskcluster-client-go/schedulerevents"
+	"golang.org/x/net/context"
+)
+
+// Used when --pulse-url is not given. Credentials are taken from
+// environment variables PULSE_USERNAME and PULSE_PASSWORD.
+const defaultPulseURL = "amqps://pulse.mozilla.org:5671"
+
+// An exchange is a pulse exchange that tc listen can subscribe to.
+type exchange struct {
+	// Name of the exchange, prefixed by the name of its service, e.g.
+	// queue/task-running
+	Name  string
+	Title string
+	// Returns a new binding for the exchange, which matches all of its
+	// messages
+	Binding func() pulse.Binding
+	// Routing key fields of the binding, which messages can be filtered on
+	Fields []field
+}
+
+// A field is a routing key field of an exchange's binding.
+type field struct {
+	// Dash separated name of the routing key element, e.g. worker-type,
+	// which is also the tc listen option to filter on it
+	Option string
+	// Name of the field of the binding type, e.g. WorkerType
+	Name string
+}
+
+// rawMessage is written for each message by tc listen --raw.
+type rawMessage struct {
+	Exchange   string      `json:"exchange"`
+	RoutingKey string      `json:"routingKey"`
+	Payload    interface{} `json:"payload"`
+}
+
+// listen runs tc listen with the given command line args, following
+// "listen", writing a line to stdout for each message received, until ctx
+// is done. It returns the exit code.
+func listen(ctx context.Context, args []string, getenv func(string) string, dial func(url string) pulseconsumer.Dialer, stdout, stderr io.Writer) int {
+	pulseURL := defaultPulseURL
+	raw := false
+	help := false
+	// routing key filters, by option
+	filters := map[string]string{}
+	names := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-h" || arg == "--help":
+			help = true
+		case arg == "--raw":
+			raw = true
+		case strings.HasPrefix(arg, "--"):
+			option, value := strings.TrimPrefix(arg, "--"), ""
+			if j := strings.Index(option, "="); j >= 0 {
+				option, value = option[:j], option[j+1:]
+			} else {
+				if i+1 == len(args) {
+					return usageError(stderr, "option %v requires a value", arg)
+				}
+				i++
+				value = args[i]
+			}
+			if option == "pulse-url" {
+				pulseURL = value
+			} else {
+				filters[option] = value
+			}
+		case strings.HasPrefix(arg, "-"):
+			return usageError(stderr, "unknown option %v", arg)
+		default:
+			names = append(names, arg)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Fprint(stdout, listenUsage())
+		if help {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	bindings := []pulse.Binding{}
+	// exchanges subscribed to, by full exchange name
+	subscribed := map[string]*exchange{}
+	for _, name := range names {
+		matches := findExchanges(name)
+		if len(matches) == 0 {
+			return usageError(stderr, "unknown exchange %v\n\n%v", name, listenUsage())
+		}
+		for _, e := range matches {
+			binding := e.Binding()
+			if subscribed[binding.ExchangeName()] != nil {
+				continue
+			}
+			for option, value := range filters {
+				f := e.findField(option)
+				if f == nil {
+					return usageError(stderr, "exchange %v has no routing key field %v, so cannot filter on --%v", e.Name, option, option)
+				}
+				reflect.ValueOf(binding).Elem().FieldByName(f.Name).SetString(value)
+			}
+			if v, ok := binding.(interface {
+				Validate() error
+			}); ok {
+				if err := v.Validate(); err != nil {
+					return usageError(stderr, "%v", err)
+				}
+			}
+			bindings = append(bindings, binding)
+			subscribed[binding.ExchangeName()] = e
+		}
+	}
+
+	u, err := url.Parse(pulseURL)
+	if err != nil {
+		return usageError(stderr, "invalid pulse url %v: %v", pulseURL, err)
+	}
+	if u.User == nil && getenv("PULSE_USERNAME") != "" {
+		u.User = url.UserPassword(getenv("PULSE_USERNAME"), getenv("PULSE_PASSWORD"))
+	}
+
+	handler := func(message interface{}, delivery amqp.Delivery) error {
+		name := delivery.Exchange
+		if e := subscribed[delivery.Exchange]; e != nil {
+			name = e.Name
+		}
+		if raw {
+			m := &rawMessage{Exchange: name, RoutingKey: delivery.RoutingKey, Payload: string(delivery.Body)}
+			if validJSON(delivery.Body) {
+				payload := json.RawMessage(delivery.Body)
+				m.Payload = &payload
+			}
+			return json.NewEncoder(stdout).Encode(m)
+		}
+		_, err := fmt.Fprintf(stdout, "%v: %v\n", name, describe(name, message, delivery))
+		return err
+	}
+	supervisor := pulseconsumer.New(dial(u.String()), "", handler, bindings...)
+	supervisor.MaxAttempts = 1
+	supervisor.OnDisconnect = func(err error) {
+		fmt.Fprintf(stderr, "tc: disconnected from pulse, reconnecting: %v\n", err)
+	}
+	if err := supervisor.Run(ctx); err != nil {
+		fmt.Fprintf(stderr, "tc: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// findExchanges returns the exchange with the given name, e.g.
+// queue/task-running, or all exchanges of the service with the given name,
+// e.g. queue.
+func findExchanges(name string) []*exchange {
+	matches := []*exchange{}
+	for _, e := range exchanges {
+		if e.Name == name || strings.HasPrefix(e.Name, name+"/") {
+			matches = append(matches, e)
+		}
+	}
+	return matches
+}
+
+// findField returns the routing key field for the given option, which may
+// omit the -id suffix of the field, e.g. provisioner for provisioner-id.
+func (e *exchange) findField(option string) *field {
+	for i, f := range e.Fields {
+		if f.Option == option || f.Option == option+"-id" {
+			return &e.Fields[i]
+		}
+	}
+	return nil
+}
+
+func listenUsage() string {
+	usage := `Usage: tc listen <exchange>... [--<field> <value>]... [--raw] [--pulse-url <url>]
+
+Subscribes to the given exchanges (or all exchanges of a service, e.g. queue)
+with an anonymous queue, and writes a line for each message received, or its
+json with --raw. Messages can be filtered on the routing key fields of the
+exchanges, e.g. --worker-type gaia --provisioner aws-provisioner, where the
+-id suffix of a field may be omitted. Pulse credentials are taken from
+PULSE_USERNAME and PULSE_PASSWORD.
+
+Exchanges:
+`
+	for _, e := range exchanges {
+		usage += fmt.Sprintf("  %-40v %v\n", e.Name, e.Title)
+		options := make([]string, len(e.Fields))
+		for i, f := range e.Fields {
+			options[i] = "--" + f.Option
+		}
+		usage += "      " + strings.Join(options, " ") + "\n"
+	}
+	return usage
+}
+
+// describe returns a human readable description of a message received from
+// the exchange with the given name.
+func describe(exchange string, message interface{}, delivery amqp.Delivery) string {
+	switch m := message.(type) {
+	case *queueevents.TaskDefinedMessage:
+		return fmt.Sprintf("Task %v defined for %v/%v", m.Status.TaskId, m.Status.ProvisionerId, m.Status.WorkerType)
+	case *queueevents.TaskPendingMessage:
+		return fmt.Sprintf("Task %v run %v pending for %v/%v", m.Status.TaskId, m.RunId, m.Status.ProvisionerId, m.Status.WorkerType)
+	case *queueevents.TaskRunningMessage:
+		return fmt.Sprintf("Task %v run %v running on worker %v/%v until %v", m.Status.TaskId, m.RunId, m.WorkerGroup, m.WorkerId, m.TakenUntil)
+	case *queueevents.ArtifactCreatedMessage:
+		return fmt.Sprintf("Task %v run %v created %v artifact %v", m.Status.TaskId, m.RunId, m.Artifact.StorageType, m.Artifact.Name)
+	case *queueevents.TaskCompletedMessage:
+		return fmt.Sprintf("Task %v run %v completed on worker %v/%v", m.Status.TaskId, m.RunId, m.WorkerGroup, m.WorkerId)
+	case *queueevents.TaskFailedMessage:
+		return fmt.Sprintf("Task %v run %v failed on worker %v/%v", m.Status.TaskId, m.RunId, m.WorkerGroup, m.WorkerId)
+	case *queueevents.TaskExceptionMessage:
+		reason := "unknown reason"
+		for _, run := range m.Status.Runs {
+			if run.RunId == m.RunId && run.ReasonResolved != "" {
+				reason = run.ReasonResolved
+			}
+		}
+		return fmt.Sprintf("Task %v run %v resolved as exception (%v)", m.Status.TaskId, m.RunId, reason)
+	case *schedulerevents.NewTaskGraphMessage:
+		return fmt.Sprintf("Task-graph %v running", m.Status.TaskGraphId)
+	case *schedulerevents.TaskGraphExtendedMessage:
+		return fmt.Sprintf("Task-graph %v extended", m.Status.TaskGraphId)
+	case *schedulerevents.BlockedTaskGraphMessage:
+		return fmt.Sprintf("Task-graph %v blocked by task %v", m.Status.TaskGraphId, m.TaskId)
+	case *schedulerevents.TaskGraphFinishedMessage:
+		return fmt.Sprintf("Task-graph %v finished", m.Status.TaskGraphId)
+	case *awsprovisionerevents.WorkerTypeMessage:
+		// the same message is used for worker-type-created, -updated
+		// and -removed
+		return fmt.Sprintf("Worker type %v %v", m.WorkerType, exchange[strings.LastIndex(exchange, "-")+1:])
+	case *purgecacheevents.PurgeCacheMessage:
+		return fmt.Sprintf("Purge of cache %v requested for %v/%v", m.CacheName, m.ProvisionerId, m.WorkerType)
+	}
+	return fmt.Sprintf("Message with routing key %v", delivery.RoutingKey)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster-client-go/relativetime"
+	"github.com/taskcluster/taskcluster-client-go/secretstore"
+)
+
+// Environment variable holding the base64 encoded key with which
+// export-secrets encrypts backups, and import-secrets decrypts them
+const backupKeyEnvVar = "TASKCLUSTER_SECRETS_BACKUP_KEY"
+
+// secretsUsages holds the usage of each of the secrets tools, by name
+var secretsUsages = map[string]string{
+	"export-secrets": `Usage: tc export-secrets <file> <name>... [--base-url <url>]
+
+Writes the secrets with the given names to <file> (or standard output for -),
+encrypted with the key in ` + backupKeyEnvVar + `, which is 32 random bytes,
+base64 encoded, e.g. from openssl rand -base64 32.
+`,
+	"import-secrets": `Usage: tc import-secrets <file> [--base-url <url>]
+
+Restores the secrets of a backup written by tc export-secrets, read from
+<file> (or standard input for -) and decrypted with the key in
+` + backupKeyEnvVar + `, overwriting any existing secrets of the same names,
+and writes their names. Secrets which have expired since the backup was
+made are not restored.
+`,
+	"rotate-secret": `Usage: tc rotate-secret <name> --payload <file> --ttl <expiry> --grace <period> [--base-url <url>]
+
+Replaces the value of secret <name> with the json of <file> (or standard
+input for -), to expire after <expiry>, e.g. "30 days". The previous value is
+kept under a versioned name, <name>@<time of rotation>, which is written to
+standard output, until it expires at the end of the grace <period>, e.g.
+"1 day".
+`,
+}
+
+// secretsTool runs tc export-secrets, import-secrets or rotate-secret, with
+// the given command line args following the name of the tool, and returns
+// the exit code.
+func secretsTool(name string, args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer) int {
+	conf := &config{
+		ClientId:    getenv("TASKCLUSTER_CLIENT_ID"),
+		AccessToken: getenv("TASKCLUSTER_ACCESS_TOKEN"),
+		Certificate: getenv("TASKCLUSTER_CERTIFICATE"),
+	}
+	options := map[string]string{}
+	positional := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-h" || arg == "--help":
+			fmt.Fprint(stdout, secretsUsages[name])
+			return exitOK
+		case strings.HasPrefix(arg, "--"):
+			option, value := strings.TrimPrefix(arg, "--"), ""
+			if j := strings.Index(option, "="); j >= 0 {
+				option, value = option[:j], option[j+1:]
+			} else {
+				if i+1 == len(args) {
+					return usageError(stderr, "option %v requires a value", arg)
+				}
+				i++
+				value = args[i]
+			}
+			options[option] = value
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return usageError(stderr, "unknown option %v", arg)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	allowed := map[string][]string{
+		"export-secrets": {"base-url"},
+		"import-secrets": {"base-url"},
+		"rotate-secret":  {"base-url", "payload", "ttl", "grace"},
+	}[name]
+	for option := range options {
+		if !contains(allowed, option) {
+			return usageError(stderr, "unknown option --%v\n\n%v", option, secretsUsages[name])
+		}
+	}
+	conf.BaseURL = options["base-url"]
+	store := secretstore.New(newSecrets(conf))
+
+	switch name {
+	case "export-secrets", "import-secrets":
+		if (name == "export-secrets" && len(positional) < 2) || (name == "import-secrets" && len(positional) != 1) {
+			return usageError(stderr, "wrong number of arguments\n\n%v", secretsUsages[name])
+		}
+		encoded := getenv(backupKeyEnvVar)
+		if encoded == "" {
+			return usageError(stderr, "%v is not set\n\n%v", backupKeyEnvVar, secretsUsages[name])
+		}
+		key, err := secretstore.ParseKey(encoded)
+		if err != nil {
+			return usageError(stderr, "invalid %v: %v", backupKeyEnvVar, err)
+		}
+		if name == "export-secrets" {
+			return exportSecrets(store, key, positional[0], positional[1:], stdout, stderr)
+		}
+		return importSecrets(store, key, positional[0], stdin, stdout, stderr)
+	}
+
+	if len(positional) != 1 {
+		return usageError(stderr, "wrong number of arguments\n\n%v", secretsUsages[name])
+	}
+	for _, option := range []string{"payload", "ttl", "grace"} {
+		if options[option] == "" {
+			return usageError(stderr, "%v requires --%v\n\n%v", name, option, secretsUsages[name])
+		}
+	}
+	now := time.Now()
+	durations := map[string]time.Duration{}
+	for _, option := range []string{"ttl", "grace"} {
+		t, err := relativetime.FromTime(options[option], now)
+		if err != nil {
+			return usageError(stderr, "invalid --%v: %v", option, err)
+		}
+		durations[option] = t.Sub(now)
+	}
+	data, err := readFile(options["payload"], stdin)
+	if err != nil {
+		return usageError(stderr, "could not read payload: %v", err)
+	}
+	if !validJSON(data) {
+		return usageError(stderr, "payload %v is not valid json", options["payload"])
+	}
+	payload := json.RawMessage(data)
+	previous, err := store.Rotate(positional[0], &payload, durations["ttl"], durations["grace"])
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if previous != "" {
+		fmt.Fprintln(stdout, previous)
+	}
+	return exitOK
+}
+
+// exportSecrets writes the backup to a temporary file in the same directory
+// as file, which is only renamed to file if the backup is complete, so that
+// an existing backup is not lost if a secret cannot be read.
+func exportSecrets(store *secretstore.Store, key []byte, file string, names []string, stdout, stderr io.Writer) int {
+	if file == "-" {
+		if err := store.Export(stdout, key, names...); err != nil {
+			return fail(stderr, err)
+		}
+		return exitOK
+	}
+	f, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return fail(stderr, err)
+	}
+	err = store.Export(f, key, names...)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fail(stderr, err)
+	}
+	return exitOK
+}
+
+func importSecrets(store *secretstore.Store, key []byte, file string, stdin io.Reader, stdout, stderr io.Writer) int {
+	data, err := readFile(file, stdin)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	restored, err := store.Import(bytes.NewReader(data), key)
+	for _, name := range restored {
+		fmt.Fprintln(stdout, name)
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	return exitOK
+}
+
+// fail writes err to stderr as a json failure, as for a failed API call
+// without a response, and returns exitFailure.
+func fail(stderr io.Writer, err error) int {
+	data, _ := json.MarshalIndent(&failure{Error: err.Error()}, "", "  ")
+	fmt.Fprintln(stderr, string(data))
+	return exitFailure
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
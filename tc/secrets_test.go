@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tcSecrets runs the tc command line args against an in-memory secrets
+// service holding the given secrets, keyed by name, which it updates, with a
+// backup key set in the environment. It returns the exit code, stdout and
+// stderr.
+func tcSecrets(store map[string]json.RawMessage, stdin string, args ...string) (int, string, string) {
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		name := strings.TrimPrefix(r.URL.Path, "/secrets/")
+		switch r.Method {
+		case "GET":
+			if store[name] == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(store[name])
+		case "PUT", "POST":
+			body, _ := ioutil.ReadAll(r.Body)
+			store[name] = body
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+	getenv := func(name string) string {
+		if name == backupKeyEnvVar {
+			return "jSp8Ru3r7hCqQm5/1LLmGJZ4N0i2Nk1nrXHH2Ne3cw0="
+		}
+		return ""
+	}
+	var stdout, stderr bytes.Buffer
+	exitCode := run(append(args, "--base-url", server.URL), getenv, strings.NewReader(stdin), &stdout, &stderr)
+	return exitCode, stdout.String(), stderr.String()
+}
+
+func TestExportImportSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tc")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "secrets.backup")
+
+	secret := json.RawMessage(`{"expires":"2100-01-01T00:00:00.000Z","secret":{"password":"hunter2"}}`)
+	exitCode, _, stderr := tcSecrets(map[string]json.RawMessage{"project/myapp/db": secret}, "", "export-secrets", file, "project/myapp/db")
+	if exitCode != exitOK {
+		t.Fatalf("Expected exit code %v but got %v: %v", exitOK, exitCode, stderr)
+	}
+	if data, err := ioutil.ReadFile(file); err != nil || bytes.Contains(data, []byte("hunter2")) {
+		t.Fatalf("Expected encrypted backup, but got %q (%v)", data, err)
+	}
+
+	restored := map[string]json.RawMessage{}
+	exitCode, stdout, stderr := tcSecrets(restored, "", "import-secrets", file)
+	if exitCode != exitOK {
+		t.Fatalf("Expected exit code %v but got %v: %v", exitOK, exitCode, stderr)
+	}
+	if stdout != "project/myapp/db\n" || !bytes.Contains(restored["project/myapp/db"], []byte("hunter2")) {
+		t.Errorf("Expected secret to be restored, but got output %q and secrets %v", stdout, restored)
+	}
+
+}
+
+func TestExportSecretsKeepsBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tc")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "secrets.backup")
+	if err := ioutil.WriteFile(file, []byte("old backup"), 0600); err != nil {
+		t.Fatalf("Could not write backup: %v", err)
+	}
+
+	secret := json.RawMessage(`{"expires":"2100-01-01T00:00:00.000Z","secret":{"password":"hunter2"}}`)
+	exitCode, _, stderr := tcSecrets(map[string]json.RawMessage{"project/myapp/db": secret}, "", "export-secrets", file, "project/myapp/db", "project/myapp/missing")
+	if exitCode != exitFailure || !strings.Contains(stderr, `"error"`) {
+		t.Errorf("Expected json failure exporting missing secret, but got exit code %v and error %q", exitCode, stderr)
+	}
+	if data, err := ioutil.ReadFile(file); err != nil || string(data) != "old backup" {
+		t.Errorf("Expected existing backup to be kept, but got %q (%v)", data, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected temporary file to be removed, but found %v files", len(files))
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	store := map[string]json.RawMessage{
+		"project/myapp/db": json.RawMessage(`{"expires":"2100-01-01T00:00:00.000Z","secret":{"password":"hunter2"}}`),
+	}
+	exitCode, stdout, stderr := tcSecrets(store, `{"password": "correcthorse"}`, "rotate-secret", "project/myapp/db", "--payload", "-", "--ttl", "30 days", "--grace=1 day")
+	if exitCode != exitOK {
+		t.Fatalf("Expected exit code %v but got %v: %v", exitOK, exitCode, stderr)
+	}
+	previous := strings.TrimSpace(stdout)
+	if !strings.HasPrefix(previous, "project/myapp/db@") || !bytes.Contains(store[previous], []byte("hunter2")) {
+		t.Errorf("Expected previous value to be kept, but got output %q and secrets %v", stdout, store)
+	}
+	if !bytes.Contains(store["project/myapp/db"], []byte("correcthorse")) {
+		t.Errorf("Expected secret to be rotated, but got %s", store["project/myapp/db"])
+	}
+}
+
+func TestSecretsUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"export-secrets", "backup"},
+		{"import-secrets"},
+		{"import-secrets", "backup", "--payload", "-"},
+		{"rotate-secret", "project/myapp/db", "--payload", "-", "--ttl", "30 days"},
+		{"rotate-secret", "project/myapp/db", "--payload", "-", "--ttl", "30 days", "--grace", "soon"},
+		{"rotate-secret", "project/myapp/db", "--payload", "-", "--ttl", "30 days", "--grace", "1 day"},
+	} {
+		exitCode, stdout, stderr := tcSecrets(map[string]json.RawMessage{}, "not json", args...)
+		if exitCode != exitUsage {
+			t.Errorf("%v: expected exit code %v but got %v", args, exitUsage, exitCode)
+		}
+		if stdout != "" || !strings.HasPrefix(stderr, "tc: ") {
+			t.Errorf("%v: expected usage error, but got output %q and error %q", args, stdout, stderr)
+		}
+	}
+}
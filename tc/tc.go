@@ -0,0 +1,377 @@
+// tc is a command line client for the TaskCluster REST APIs. It has a command
+// for every entry of every API of this library, e.g.
+//
+//	tc queue status <taskId>
+//	tc index find-task <namespace>
+//	tc queue create-task <taskId> --payload task.json
+//
+// The commands are generated from the API references along with the rest of
+// the library (see tc/services.go), so a new API entry automatically results
+// in a new command. The command for an entry is its name, with words
+// separated by dashes, and takes the arguments of the entry's route in order.
+// Entries which have a request body also require --payload, giving a file of
+// json (or - for standard input) which is checked against the go type of the
+// request before it is sent.
+//
+// Credentials are read from environment variables TASKCLUSTER_CLIENT_ID,
+// TASKCLUSTER_ACCESS_TOKEN and (for temporary credentials)
+// TASKCLUSTER_CERTIFICATE. Without TASKCLUSTER_CLIENT_ID, requests are not
+// authenticated, e.g. for use with the taskcluster-proxy, by passing its url
+// with --base-url.
+//
+// On success, the json response is written to standard output, and the exit
+// code is 0. Otherwise, a json object describing the failure is written to
+// standard error, e.g.
+//
+//	{
+//	  "statusCode": 404,
+//	  "error": "404 Not Found",
+//	  "response": {
+//	    "message": "Indexed task not found"
+//	  }
+//	}
+//
+// where statusCode and response are only present if a response was
+// received, and the exit code is:
+//
+//	1 - no valid response was received, e.g. due to a network failure
+//	2 - the command line was not valid, e.g. unknown command or missing payload
+//	4 - the service responded with an HTTP 4xx status code
+//	5 - the service responded with an HTTP 5xx status code
+//
+// Run tc, tc <service> or tc <service> <command> --help for a list of
+// services, the commands of a service, or the documentation of a command.
+//
+// In addition, tc listen subscribes to pulse exchanges, and writes a line
+// describing each message received, e.g.
+//
+//	tc listen queue/task-running --worker-type gaia --provisioner aws-provisioner
+//
+// which writes lines such as
+//
+//	queue/task-running: Task Gu3BJf0IQeuJE-HFKtYI2A run 0 running on worker us-west-2/i-0a1b2c3d until 2015-10-27T20:56:19.255Z
+//
+// or the messages as json with --raw, until interrupted. The exchanges are
+// generated from the references of the events packages (see
+// tc/exchanges.go), and messages can be filtered on any of the routing key
+// fields of their bindings. Run tc listen --help for the available
+// exchanges.
+//
+// Finally, tc export-secrets, tc import-secrets and tc rotate-secret back up
+// secrets to a file encrypted with the key in environment variable
+// TASKCLUSTER_SECRETS_BACKUP_KEY, restore them, and replace the value of a
+// secret while keeping the previous value for a grace period (see package
+// secretstore).
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/taskcluster/taskcluster-client-go/pulseconsumer"
+	"golang.org/x/net/context"
+)
+
+// Exit codes of tc
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitClientError = 4
+	exitServerError = 5
+)
+
+// A service is a TaskCluster REST API, with a command per API entry.
+type service struct {
+	// Name of the package of the API, e.g. queue
+	Name     string
+	Title    string
+	Commands []*command
+}
+
+// A command calls one entry of an API.
+type command struct {
+	// Dash separated name of the entry, e.g. find-task
+	Name        string
+	Title       string
+	Description string
+	// Names of the arguments of the entry's route
+	Args []string
+	// If not nil, returns a new request body for the entry, to unmarshal the
+	// --payload json into
+	Input func() interface{}
+	// Calls the entry with the given arguments and request body
+	Run func(config *config, args []string, payload interface{}) *call
+}
+
+// config holds the credentials and options with which API calls are made.
+type config struct {
+	ClientId    string
+	AccessToken string
+	Certificate string
+	// If set, overrides the production url of the service
+	BaseURL string
+}
+
+// call holds the outcome of an API call, as given by the CallSummary of the
+// generated package.
+type call struct {
+	HttpResponse     *http.Response
+	HttpResponseBody string
+	Error            error
+}
+
+// failure is written to standard error as json when a command fails.
+type failure struct {
+	StatusCode int         `json:"statusCode,omitempty"`
+	Error      string      `json:"error"`
+	Response   interface{} `json:"response,omitempty"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the tc command line args, and returns the exit code.
+func run(args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "listen":
+			ctx, cancel := context.WithCancel(context.Background())
+			interrupts := make(chan os.Signal, 1)
+			signal.Notify(interrupts, os.Interrupt)
+			go func() {
+				<-interrupts
+				cancel()
+			}()
+			return listen(ctx, args[1:], getenv, pulseconsumer.AMQP, stdout, stderr)
+		case "export-secrets", "import-secrets", "rotate-secret":
+			return secretsTool(args[0], args[1:], getenv, stdin, stdout, stderr)
+		}
+	}
+	conf := &config{
+		ClientId:    getenv("TASKCLUSTER_CLIENT_ID"),
+		AccessToken: getenv("TASKCLUSTER_ACCESS_TOKEN"),
+		Certificate: getenv("TASKCLUSTER_CERTIFICATE"),
+	}
+	payloadFile := ""
+	help := false
+	positional := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+		case arg == "-h" || arg == "--help":
+			help = true
+		case arg == "--payload" || arg == "--base-url":
+			if i+1 == len(args) {
+				return usageError(stderr, "option %v requires a value", arg)
+			}
+			i++
+			if arg == "--payload" {
+				payloadFile = args[i]
+			} else {
+				conf.BaseURL = args[i]
+			}
+		case strings.HasPrefix(arg, "--payload="):
+			payloadFile = strings.TrimPrefix(arg, "--payload=")
+		case strings.HasPrefix(arg, "--base-url="):
+			conf.BaseURL = strings.TrimPrefix(arg, "--base-url=")
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return usageError(stderr, "unknown option %v", arg)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) == 0 {
+		fmt.Fprint(stdout, servicesUsage())
+		if help {
+			return exitOK
+		}
+		return exitUsage
+	}
+	svc := findService(positional[0])
+	if svc == nil {
+		return usageError(stderr, "unknown service %v\n\n%v", positional[0], servicesUsage())
+	}
+	if len(positional) == 1 {
+		fmt.Fprint(stdout, svc.usage())
+		if help {
+			return exitOK
+		}
+		return exitUsage
+	}
+	cmd := svc.findCommand(positional[1])
+	if cmd == nil {
+		return usageError(stderr, "unknown command %v\n\n%v", positional[1], svc.usage())
+	}
+	if help {
+		fmt.Fprint(stdout, cmd.usage(svc))
+		return exitOK
+	}
+	commandArgs := positional[2:]
+	if len(commandArgs) != len(cmd.Args) {
+		return usageError(stderr, "%v %v takes %v argument(s), but got %v\n\n%v", svc.Name, cmd.Name, len(cmd.Args), len(commandArgs), cmd.usage(svc))
+	}
+
+	var payload interface{}
+	switch {
+	case cmd.Input != nil && payloadFile == "":
+		return usageError(stderr, "%v %v requires --payload\n\n%v", svc.Name, cmd.Name, cmd.usage(svc))
+	case cmd.Input == nil && payloadFile != "":
+		return usageError(stderr, "%v %v does not take a payload\n\n%v", svc.Name, cmd.Name, cmd.usage(svc))
+	case cmd.Input != nil:
+		data, err := readFile(payloadFile, stdin)
+		if err != nil {
+			return usageError(stderr, "could not read payload: %v", err)
+		}
+		payload = cmd.Input()
+		if err := json.Unmarshal(data, payload); err != nil {
+			return usageError(stderr, "payload %v is not valid for %v %v: %v", payloadFile, svc.Name, cmd.Name, err)
+		}
+	}
+
+	return report(cmd.Run(conf, commandArgs, payload), stdout, stderr)
+}
+
+// report writes the outcome of an API call to stdout or stderr, and returns
+// the corresponding exit code.
+func report(c *call, stdout, stderr io.Writer) int {
+	resp := c.HttpResponse
+	if resp != nil && c.HttpResponseBody == "" && resp.Body != nil {
+		// the body is not read by the generated packages if the request
+		// failed, but it usually explains why
+		if body, err := ioutil.ReadAll(resp.Body); err == nil {
+			c.HttpResponseBody = string(body)
+		}
+	}
+	if c.Error == nil && resp != nil && resp.StatusCode/100 == 2 {
+		if c.HttpResponseBody != "" {
+			fmt.Fprintln(stdout, indent(c.HttpResponseBody))
+		}
+		return exitOK
+	}
+
+	f := &failure{}
+	exitCode := exitFailure
+	if resp != nil {
+		f.StatusCode = resp.StatusCode
+		f.Error = resp.Status
+		switch resp.StatusCode / 100 {
+		case 4:
+			exitCode = exitClientError
+		case 5:
+			exitCode = exitServerError
+		}
+		if c.HttpResponseBody != "" {
+			if validJSON([]byte(c.HttpResponseBody)) {
+				// a pointer, since json.RawMessage only has a pointer
+				// MarshalJSON method in older go releases
+				response := json.RawMessage(c.HttpResponseBody)
+				f.Response = &response
+			} else {
+				f.Response = c.HttpResponseBody
+			}
+		}
+	}
+	if c.Error != nil && (resp == nil || exitCode == exitFailure) {
+		f.Error = c.Error.Error()
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	fmt.Fprintln(stderr, string(data))
+	return exitCode
+}
+
+// usageError writes the formatted message to stderr, and returns exitUsage.
+func usageError(stderr io.Writer, format string, a ...interface{}) int {
+	fmt.Fprintf(stderr, "tc: "+format+"\n", a...)
+	return exitUsage
+}
+
+// indent returns the json document body indented, or body unchanged if it is
+// not valid json.
+func indent(body string) string {
+	var b bytes.Buffer
+	if err := json.Indent(&b, []byte(body), "", "  "); err != nil {
+		return body
+	}
+	return b.String()
+}
+
+// validJSON reports whether data is a valid json document
+func validJSON(data []byte) bool {
+	return json.Unmarshal(data, new(json.RawMessage)) == nil
+}
+
+// readFile returns the contents of file, or of stdin if file is -
+func readFile(file string, stdin io.Reader) ([]byte, error) {
+	if file == "-" {
+		return ioutil.ReadAll(stdin)
+	}
+	return ioutil.ReadFile(file)
+}
+
+func findService(name string) *service {
+	for _, s := range services {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (s *service) findCommand(name string) *command {
+	for _, c := range s.Commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func servicesUsage() string {
+	usage := "Usage: tc <service> <command> [<arg>...] [--payload <file>] [--base-url <url>]\n\nServices:\n"
+	for _, s := range services {
+		usage += fmt.Sprintf("  %-16v %v\n", s.Name, s.Title)
+	}
+	return usage + "\nRun tc <service> for a list of its commands, or tc listen --help for\nsubscribing to pulse exchanges.\n\nTo back up, restore and rotate secrets, run tc export-secrets, tc\nimport-secrets or tc rotate-secret with --help.\n"
+}
+
+func (s *service) usage() string {
+	usage := fmt.Sprintf("Usage: tc %v <command> [<arg>...] [--payload <file>] [--base-url <url>]\n\n%v commands:\n", s.Name, s.Title)
+	for _, c := range s.Commands {
+		usage += fmt.Sprintf("  %-48v %v\n", c.synopsis(), c.Title)
+	}
+	return usage + "\nRun tc " + s.Name + " <command> --help for the documentation of a command.\n"
+}
+
+// synopsis returns the command with its arguments, e.g.
+// create-task <taskId> --payload <file>
+func (c *command) synopsis() string {
+	synopsis := c.Name
+	for _, arg := range c.Args {
+		synopsis += " <" + arg + ">"
+	}
+	if c.Input != nil {
+		synopsis += " --payload <file>"
+	}
+	return synopsis
+}
+
+func (c *command) usage(s *service) string {
+	return fmt.Sprintf("Usage: tc %v %v [--base-url <url>]\n\n%v\n\n%v\n", s.Name, c.synopsis(), c.Title, c.Description)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tc runs the tc command line args against a fake service, which answers
+// requests for the status of a task, echoes the body of createTask requests,
+// and responds 404 otherwise. It returns the exit code, stdout and stderr.
+func tc(stdin string, args ...string) (int, string, string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/task/Gu3BJf0IQeuJE-HFKtYI2A/status":
+			w.Write([]byte(`{"status":{"taskId":"Gu3BJf0IQeuJE-HFKtYI2A","state":"completed"}}`))
+		case r.Method == "PUT" && r.URL.Path == "/task/Gu3BJf0IQeuJE-HFKtYI2A":
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Write([]byte(`{"status":{"taskId":"Gu3BJf0IQeuJE-HFKtYI2A","state":"pending"},"request":` + string(body) + `}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Indexed task not found"}`))
+		}
+	}))
+	defer server.Close()
+	getenv := func(name string) string { return "" }
+	var stdout, stderr bytes.Buffer
+	exitCode := run(append(args, "--base-url", server.URL), getenv, strings.NewReader(stdin), &stdout, &stderr)
+	return exitCode, stdout.String(), stderr.String()
+}
+
+func TestStatus(t *testing.T) {
+	exitCode, stdout, stderr := tc("", "queue", "status", "Gu3BJf0IQeuJE-HFKtYI2A")
+	if exitCode != exitOK {
+		t.Fatalf("Expected exit code %v but got %v: %v", exitOK, exitCode, stderr)
+	}
+	expected := `{
+  "status": {
+    "taskId": "Gu3BJf0IQeuJE-HFKtYI2A",
+    "state": "completed"
+  }
+}
+`
+	if stdout != expected {
+		t.Errorf("Expected indented response\n%v\nbut got\n%v", expected, stdout)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	exitCode, stdout, stderr := tc("", "index", "find-task", "gecko.v2.missing")
+	if exitCode != exitClientError {
+		t.Fatalf("Expected exit code %v but got %v", exitClientError, exitCode)
+	}
+	if stdout != "" {
+		t.Errorf("Expected no output, but got %v", stdout)
+	}
+	var f struct {
+		StatusCode int `json:"statusCode"`
+		Response   struct {
+			Message string `json:"message"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(stderr), &f); err != nil {
+		t.Fatalf("Expected json failure, but got %v: %v", stderr, err)
+	}
+	if f.StatusCode != 404 || f.Response.Message != "Indexed task not found" {
+		t.Errorf("Unexpected failure %v", stderr)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tc")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "task.json")
+	if err := ioutil.WriteFile(file, []byte(`{"provisionerId": "aws-provisioner-v1", "workerType": "b2gtest"}`), 0644); err != nil {
+		t.Fatalf("Could not write payload: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"queue", "create-task", "Gu3BJf0IQeuJE-HFKtYI2A", "--payload", file},
+		{"queue", "create-task", "--payload=-", "Gu3BJf0IQeuJE-HFKtYI2A"},
+	} {
+		exitCode, stdout, stderr := tc(`{"provisionerId": "aws-provisioner-v1", "workerType": "b2gtest"}`, args...)
+		if exitCode != exitOK {
+			t.Fatalf("%v: expected exit code %v but got %v: %v", args, exitOK, exitCode, stderr)
+		}
+		if !strings.Contains(stdout, `"workerType": "b2gtest"`) {
+			t.Errorf("%v: expected payload to be sent, but got %v", args, stdout)
+		}
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"nosuchservice"},
+		{"queue", "nosuchcommand"},
+		{"queue", "status"},
+		{"queue", "status", "Gu3BJf0IQeuJE-HFKtYI2A", "extra"},
+		{"queue", "create-task", "Gu3BJf0IQeuJE-HFKtYI2A"},
+		{"queue", "create-task", "Gu3BJf0IQeuJE-HFKtYI2A", "--payload", "-"},
+		{"queue", "status", "Gu3BJf0IQeuJE-HFKtYI2A", "--payload", "-"},
+		{"queue", "status", "Gu3BJf0IQeuJE-HFKtYI2A", "--verbose"},
+	} {
+		exitCode, stdout, stderr := tc(`{"workerType": 5}`, args...)
+		if exitCode != exitUsage {
+			t.Errorf("%v: expected exit code %v but got %v", args, exitUsage, exitCode)
+		}
+		if stdout != "" || !strings.HasPrefix(stderr, "tc: ") {
+			t.Errorf("%v: expected usage error, but got output %q and error %q", args, stdout, stderr)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	exitCode, stdout, _ := tc("", "index", "--help")
+	if exitCode != exitOK || !strings.Contains(stdout, "find-task <namespace> ") {
+		t.Errorf("Expected list of index commands, but got exit code %v and output\n%v", exitCode, stdout)
+	}
+	exitCode, stdout, _ = tc("", "queue", "create-task", "-h")
+	if exitCode != exitOK || !strings.HasPrefix(stdout, "Usage: tc queue create-task <taskId> --payload <file>") {
+		t.Errorf("Expected create-task documentation, but got exit code %v and output\n%v", exitCode, stdout)
+	}
+}
+
+func TestCommandNames(t *testing.T) {
+	names := map[string]bool{}
+	for _, s := range services {
+		for _, c := range s.Commands {
+			name := s.Name + " " + c.Name
+			if names[name] {
+				t.Errorf("Duplicate command %v", name)
+			}
+			names[name] = true
+		}
+	}
+	for _, name := range []string{"queue status", "index find-task", "auth aws-s3-credentials", "auth azure-table-sas"} {
+		if !names[name] {
+			t.Errorf("Expected command %v", name)
+		}
+	}
+}
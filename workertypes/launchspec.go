@@ -0,0 +1,168 @@
+package workertypes
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// LaunchSpec is the effective configuration of the instances of one
+// instance type in one region of a worker type, as computed by the
+// aws-provisioner when it requests spot instances.
+type LaunchSpec struct {
+	WorkerType   string `json:"workerType"`
+	Region       string `json:"region"`
+	InstanceType string `json:"instanceType"`
+	// Capacity and utility of the instance type
+	Capacity int `json:"capacity"`
+	Utility  int `json:"utility"`
+	// EC2 launch specification, merged from the worker type, region and
+	// instance type levels, with ImageId from the region, and InstanceType
+	// set. The provisioner adds KeyName, and UserData encoded from
+	// UserData, when it launches instances.
+	LaunchSpecification map[string]interface{} `json:"launchSpecification"`
+	// User data for the instances, merged from the three levels, with
+	// capacity, workerType, region and instanceType set. The provisioner
+	// adds provisionerId, a securityToken and launchSpecGenerated when it
+	// launches instances.
+	UserData map[string]interface{} `json:"userData"`
+	// Secrets made available to the instances, merged from the three levels
+	Secrets map[string]interface{} `json:"secrets"`
+	// Scopes of the credentials given to the instances: the union of the
+	// scopes of the three levels
+	Scopes []string `json:"scopes"`
+}
+
+// Launch spec keys which may only be set at a certain level, or not at all,
+// since the provisioner sets them, mapped to the level they may be set at
+var reservedKeys = map[string]string{
+	"ImageId":      "region",
+	"InstanceType": "",
+	"KeyName":      "",
+	"UserData":     "",
+}
+
+// LaunchSpecs returns the launch spec of each region and instance type of
+// the definition, in the order of its regions, and then instance types,
+// merged as by the aws-provisioner, so that the effect of a change can be
+// reviewed offline. Objects are merged key by key, recursively, with the
+// region overriding the worker type, and the instance type overriding both;
+// arrays are merged element by element. If the definition is not valid, a
+// *ValidationError is returned.
+func (d *Definition) LaunchSpecs() ([]*LaunchSpec, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	r := d.Request
+	launchSpecs := []*LaunchSpec{}
+	for _, region := range r.Regions {
+		regionLaunchSpec, err := json.Marshal(region.LaunchSpec)
+		if err != nil {
+			return nil, err
+		}
+		for _, instanceType := range r.InstanceTypes {
+			l := &LaunchSpec{
+				WorkerType:          d.WorkerType,
+				Region:              region.Region,
+				InstanceType:        instanceType.InstanceType,
+				Capacity:            instanceType.Capacity,
+				Utility:             instanceType.Utility,
+				LaunchSpecification: mergeObjects(r.LaunchSpec, regionLaunchSpec, instanceType.LaunchSpec),
+				UserData:            mergeObjects(r.UserData, region.UserData, instanceType.UserData),
+				Secrets:             mergeObjects(r.Secrets, region.Secrets, instanceType.Secrets),
+				Scopes:              union(r.Scopes, region.Scopes, instanceType.Scopes),
+			}
+			l.LaunchSpecification["InstanceType"] = instanceType.InstanceType
+			l.UserData["capacity"] = instanceType.Capacity
+			l.UserData["workerType"] = d.WorkerType
+			l.UserData["region"] = region.Region
+			l.UserData["instanceType"] = instanceType.InstanceType
+			launchSpecs = append(launchSpecs, l)
+		}
+	}
+	return launchSpecs, nil
+}
+
+// reservedKeyProblems returns the problems of launch spec keys which are set
+// at a level at which the provisioner does not allow them
+func (d *Definition) reservedKeyProblems() []string {
+	problems := []string{}
+	check := func(level string, launchSpec json.RawMessage) {
+		var keys map[string]interface{}
+		if err := json.Unmarshal(launchSpec, &keys); err != nil && len(launchSpec) > 0 && string(launchSpec) != "null" {
+			problems = append(problems, fmt.Sprintf("%v launchSpec is not an object", level))
+			return
+		}
+		for _, key := range []string{"ImageId", "InstanceType", "KeyName", "UserData"} {
+			allowed := reservedKeys[key]
+			if _, ok := keys[key]; !ok || level == allowed {
+				continue
+			}
+			if allowed == "" {
+				problems = append(problems, fmt.Sprintf("%v launchSpec sets %v, which is set by the provisioner", level, key))
+			} else {
+				problems = append(problems, fmt.Sprintf("%v launchSpec sets %v, which may only be set per %v", level, key, allowed))
+			}
+		}
+	}
+	check("worker type", d.Request.LaunchSpec)
+	for _, instanceType := range d.Request.InstanceTypes {
+		check("instance type "+instanceType.InstanceType, instanceType.LaunchSpec)
+	}
+	return problems
+}
+
+// mergeObjects returns the json objects merged, with later objects
+// overriding earlier ones. Empty values and null are treated as {}.
+func mergeObjects(objects ...json.RawMessage) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for _, object := range objects {
+		var value map[string]interface{}
+		json.Unmarshal(object, &value)
+		merge(merged, value)
+	}
+	return merged
+}
+
+// merge merges src into dst, recursively merging objects key by key, and
+// arrays element by element, as lodash.merge does, and returns the result,
+// which is dst if it is an object or array.
+func merge(dst, src interface{}) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			d = map[string]interface{}{}
+		}
+		for key, value := range s {
+			d[key] = merge(d[key], value)
+		}
+		return d
+	case []interface{}:
+		d, _ := dst.([]interface{})
+		for i, value := range s {
+			if i < len(d) {
+				d[i] = merge(d[i], value)
+			} else {
+				d = append(d, merge(nil, value))
+			}
+		}
+		return d
+	}
+	return src
+}
+
+// union returns the distinct strings of the lists, in order of first
+// appearance
+func union(lists ...[]string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, list := range lists {
+		for _, s := range list {
+			if !seen[s] {
+				seen[s] = true
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
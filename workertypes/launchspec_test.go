@@ -0,0 +1,84 @@
+package workertypes
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster-client-go/awsprovisioner"
+)
+
+func TestLaunchSpecs(t *testing.T) {
+	request := new(awsprovisioner.CreateWorkerTypeRequest)
+	definition := strings.NewReplacer(
+		`"launchSpec": {"SecurityGroups": ["docker-worker"]}`, `"launchSpec": {"SecurityGroups": ["docker-worker", "ssh"], "Placement": {"Tenancy": "default"}}`,
+		`"userData": {},
+  "secrets"`, `"userData": {"dockerConfig": {"allowPrivileged": false}},
+  "secrets"`,
+		`"secrets": {}, "scopes": []},
+    {"region": "us-east-1"`, `"secrets": {"region": "oregon"}, "scopes": ["queue:create-artifact:*", "index:insert-task:*"]},
+    {"region": "us-east-1"`,
+		`"instanceType": "c3.xlarge", "capacity": 1, "utility": 1, "launchSpec": {}, "userData": {}`, `"instanceType": "c3.xlarge", "capacity": 2, "utility": 3, "launchSpec": {"SecurityGroups": ["c3"], "Placement": {"AvailabilityZone": "a"}}, "userData": {"dockerConfig": {"allowPrivileged": true}}`,
+	).Replace(gaia)
+	if err := json.Unmarshal([]byte(definition), request); err != nil {
+		t.Fatalf("Could not unmarshal definition: %v", err)
+	}
+	launchSpecs, err := (&Definition{WorkerType: "gaia", Request: request}).LaunchSpecs()
+	if err != nil {
+		t.Fatalf("Could not compute launch specs: %v", err)
+	}
+	if len(launchSpecs) != 2 {
+		t.Fatalf("Expected a launch spec per region, but got %v", len(launchSpecs))
+	}
+	actual, _ := json.Marshal(launchSpecs[0])
+	expected := `{
+  "workerType": "gaia",
+  "region": "us-west-2",
+  "instanceType": "c3.xlarge",
+  "capacity": 2,
+  "utility": 3,
+  "launchSpecification": {
+    "ImageId": "ami-1a2b3c4d",
+    "InstanceType": "c3.xlarge",
+    "Placement": {"AvailabilityZone": "a", "Tenancy": "default"},
+    "SecurityGroups": ["c3", "ssh"]
+  },
+  "userData": {
+    "capacity": 2,
+    "dockerConfig": {"allowPrivileged": true},
+    "instanceType": "c3.xlarge",
+    "region": "us-west-2",
+    "workerType": "gaia"
+  },
+  "secrets": {"region": "oregon", "token": "hunter2"},
+  "scopes": ["queue:create-artifact:*", "index:insert-task:*"]
+}`
+	var actualValue, expectedValue interface{}
+	json.Unmarshal(actual, &actualValue)
+	json.Unmarshal([]byte(expected), &expectedValue)
+	if !reflect.DeepEqual(actualValue, expectedValue) {
+		t.Errorf("Expected launch spec\n%v\nbut got\n%s", expected, actual)
+	}
+	if launchSpecs[1].Region != "us-east-1" || launchSpecs[1].LaunchSpecification["ImageId"] != "ami-2b3c4d5e" || launchSpecs[1].Secrets["region"] != nil {
+		t.Errorf("Unexpected launch spec for us-east-1: %+v", launchSpecs[1])
+	}
+}
+
+func TestReservedLaunchSpecKeys(t *testing.T) {
+	request := new(awsprovisioner.CreateWorkerTypeRequest)
+	definition := strings.NewReplacer(
+		`"launchSpec": {"SecurityGroups": ["docker-worker"]}`, `"launchSpec": {"ImageId": "ami-1a2b3c4d"}`,
+		`"launchSpec": {}, "userData": {}`, `"launchSpec": {"KeyName": "mine"}, "userData": {}`,
+	).Replace(gaia)
+	if err := json.Unmarshal([]byte(definition), request); err != nil {
+		t.Fatalf("Could not unmarshal definition: %v", err)
+	}
+	_, err := (&Definition{WorkerType: "gaia", Request: request}).LaunchSpecs()
+	expected := `invalid worker type definitions:
+  * gaia: worker type launchSpec sets ImageId, which may only be set per region
+  * gaia: instance type c3.xlarge launchSpec sets KeyName, which is set by the provisioner`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error\n%v\nbut got\n%v", expected, err)
+	}
+}
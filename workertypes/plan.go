@@ -0,0 +1,383 @@
+package workertypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/taskcluster/taskcluster-client-go/awsprovisioner"
+)
+
+// Actions of a Change
+const (
+	Create = "create"
+	Update = "update"
+	Remove = "remove"
+)
+
+// Change is a change of a live worker type, to bring it in line with its
+// definition.
+type Change struct {
+	WorkerType string
+	// Create, Update or Remove
+	Action string
+	// Definition to create or update the worker type with, or nil for Remove
+	Definition *Definition
+	// For Update, the differences between the live definition and the desired
+	// one
+	Differences []*Difference
+}
+
+// Difference is a difference between a live worker type definition and a
+// desired one.
+type Difference struct {
+	// Part of the definition which differs: "" for the settings of the
+	// worker type as a whole, or e.g. "region us-west-2" or "instance type
+	// c3.xlarge"
+	Section string
+	// Description of the difference, e.g. `maxCapacity: 10 -> 20`, or
+	// `added`. Values of secrets are not included.
+	Description string
+}
+
+// Plan is the set of changes to bring the live worker types in line with
+// their definitions, as returned by Manager.Plan. Its String method gives a
+// readable summary for review, before the plan is applied with
+// Manager.Apply.
+type Plan struct {
+	Changes []*Change
+	// Worker types whose live definitions already match
+	Unchanged []string
+}
+
+// Manager plans and applies changes to the worker types of the
+// aws-provisioner.
+type Manager struct {
+	Provisioner *awsprovisioner.AwsProvisioner
+	// If true, Plan removes live worker types which have no definition.
+	// Note that removing a worker type terminates all of its instances.
+	Prune bool
+}
+
+// New returns a Manager for the worker types of myProvisioner, which does
+// not remove worker types without a definition.
+func New(myProvisioner *awsprovisioner.AwsProvisioner) *Manager {
+	return &Manager{Provisioner: myProvisioner}
+}
+
+// Plan compares definitions with the live worker types, and returns the
+// changes needed to bring the live worker types in line with them.
+func (m *Manager) Plan(definitions []*Definition) (*Plan, error) {
+	list, callSummary := m.Provisioner.ListWorkerTypes()
+	if callSummary.Error != nil {
+		return nil, fmt.Errorf("could not list worker types: %v", callSummary.Error)
+	}
+	live := map[string]bool{}
+	for _, workerType := range *list {
+		live[workerType] = true
+	}
+	plan := &Plan{}
+	defined := map[string]bool{}
+	for _, d := range definitions {
+		defined[d.WorkerType] = true
+		if !live[d.WorkerType] {
+			plan.Changes = append(plan.Changes, &Change{WorkerType: d.WorkerType, Action: Create, Definition: d})
+			continue
+		}
+		current, err := m.current(d.WorkerType)
+		if err != nil {
+			return nil, err
+		}
+		differences := diff(current, d.Request)
+		if len(differences) == 0 {
+			plan.Unchanged = append(plan.Unchanged, d.WorkerType)
+			continue
+		}
+		plan.Changes = append(plan.Changes, &Change{WorkerType: d.WorkerType, Action: Update, Definition: d, Differences: differences})
+	}
+	if m.Prune {
+		sort.Strings(*list)
+		for _, workerType := range *list {
+			if !defined[workerType] {
+				plan.Changes = append(plan.Changes, &Change{WorkerType: workerType, Action: Remove})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// current returns the live definition of workerType, as a request to
+// create it
+func (m *Manager) current(workerType string) (*awsprovisioner.CreateWorkerTypeRequest, error) {
+	response, callSummary := m.Provisioner.WorkerType(workerType)
+	if callSummary.Error != nil {
+		return nil, fmt.Errorf("could not get worker type %v: %v", workerType, callSummary.Error)
+	}
+	// the response also has the workerType and lastModified, which are
+	// dropped
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	request := new(awsprovisioner.CreateWorkerTypeRequest)
+	if err := json.Unmarshal(data, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Apply makes the changes of plan in order, stopping at the first failure,
+// in which case the changes before it have been made.
+func (m *Manager) Apply(plan *Plan) error {
+	for _, change := range plan.Changes {
+		debug("Applying %v of worker type %v", change.Action, change.WorkerType)
+		var callSummary *awsprovisioner.CallSummary
+		switch change.Action {
+		case Create:
+			_, callSummary = m.Provisioner.CreateWorkerType(change.WorkerType, change.Definition.Request)
+		case Update:
+			_, callSummary = m.Provisioner.UpdateWorkerType(change.WorkerType, change.Definition.Request)
+		case Remove:
+			callSummary = m.Provisioner.RemoveWorkerType(change.WorkerType)
+		default:
+			return fmt.Errorf("unknown action %v for worker type %v", change.Action, change.WorkerType)
+		}
+		if callSummary.Error != nil {
+			return fmt.Errorf("could not %v worker type %v: %v", change.Action, change.WorkerType, callSummary.Error)
+		}
+	}
+	return nil
+}
+
+// String returns a readable summary of the plan, e.g.
+//
+//	+ create b2gtest
+//	    regions: us-east-1, us-west-2
+//	    instance types: c3.xlarge
+//	~ update gaia
+//	    maxCapacity: 10 -> 20
+//	    region us-west-2:
+//	      launchSpec.ImageId: "ami-1a2b3c4d" -> "ami-5e6f7a8b"
+//	    instance type m3.large:
+//	      added
+//	- remove old-worker
+//
+//	Plan: 1 to create, 1 to update, 1 to remove, 2 unchanged.
+func (p *Plan) String() string {
+	s := ""
+	counts := map[string]int{}
+	for _, change := range p.Changes {
+		counts[change.Action]++
+		switch change.Action {
+		case Create:
+			r := change.Definition.Request
+			regions := make([]string, len(r.Regions))
+			for i, region := range r.Regions {
+				regions[i] = region.Region
+			}
+			instanceTypes := make([]string, len(r.InstanceTypes))
+			for i, instanceType := range r.InstanceTypes {
+				instanceTypes[i] = instanceType.InstanceType
+			}
+			s += "+ create " + change.WorkerType + "\n"
+			s += "    regions: " + strings.Join(regions, ", ") + "\n"
+			s += "    instance types: " + strings.Join(instanceTypes, ", ") + "\n"
+		case Update:
+			s += "~ update " + change.WorkerType + "\n"
+			section := ""
+			for _, d := range change.Differences {
+				if d.Section == "" {
+					s += "    " + d.Description + "\n"
+					continue
+				}
+				if d.Section != section {
+					section = d.Section
+					s += "    " + section + ":\n"
+				}
+				s += "      " + d.Description + "\n"
+			}
+		case Remove:
+			s += "- remove " + change.WorkerType + "\n"
+		}
+	}
+	if s != "" {
+		s += "\n"
+	}
+	return s + fmt.Sprintf("Plan: %v to create, %v to update, %v to remove, %v unchanged.\n", counts[Create], counts[Update], counts[Remove], len(p.Unchanged))
+}
+
+// diff returns the differences between the live and desired definitions of a
+// worker type, with the settings of the worker type as a whole first, then
+// those of each region and instance type
+func diff(live, desired *awsprovisioner.CreateWorkerTypeRequest) []*Difference {
+	differences := []*Difference{}
+	add := func(section string, descriptions ...string) {
+		for _, description := range descriptions {
+			differences = append(differences, &Difference{Section: section, Description: description})
+		}
+	}
+
+	add("", compare("minCapacity", live.MinCapacity, desired.MinCapacity)...)
+	add("", compare("maxCapacity", live.MaxCapacity, desired.MaxCapacity)...)
+	add("", compare("minPrice", live.MinPrice, desired.MinPrice)...)
+	add("", compare("maxPrice", live.MaxPrice, desired.MaxPrice)...)
+	add("", compare("scalingRatio", live.ScalingRatio, desired.ScalingRatio)...)
+	add("", compare("canUseOndemand", live.CanUseOndemand, desired.CanUseOndemand)...)
+	add("", compare("canUseSpot", live.CanUseSpot, desired.CanUseSpot)...)
+	add("", compareJSON("launchSpec", live.LaunchSpec, desired.LaunchSpec, false)...)
+	add("", compareJSON("userData", live.UserData, desired.UserData, false)...)
+	add("", compareJSON("secrets", live.Secrets, desired.Secrets, true)...)
+	add("", compareScopes(live.Scopes, desired.Scopes)...)
+
+	liveRegions := map[string]int{}
+	for i, region := range live.Regions {
+		liveRegions[region.Region] = i
+	}
+	for _, region := range desired.Regions {
+		section := "region " + region.Region
+		i, ok := liveRegions[region.Region]
+		if !ok {
+			add(section, "added")
+			continue
+		}
+		delete(liveRegions, region.Region)
+		old := live.Regions[i]
+		add(section, compare("launchSpec.ImageId", old.LaunchSpec.ImageId, region.LaunchSpec.ImageId)...)
+		add(section, compareJSON("userData", old.UserData, region.UserData, false)...)
+		add(section, compareJSON("secrets", old.Secrets, region.Secrets, true)...)
+		add(section, compareScopes(old.Scopes, region.Scopes)...)
+	}
+	for _, region := range live.Regions {
+		if _, removed := liveRegions[region.Region]; removed {
+			add("region "+region.Region, "removed")
+		}
+	}
+
+	liveInstanceTypes := map[string]int{}
+	for i, instanceType := range live.InstanceTypes {
+		liveInstanceTypes[instanceType.InstanceType] = i
+	}
+	for _, instanceType := range desired.InstanceTypes {
+		section := "instance type " + instanceType.InstanceType
+		i, ok := liveInstanceTypes[instanceType.InstanceType]
+		if !ok {
+			add(section, "added")
+			continue
+		}
+		delete(liveInstanceTypes, instanceType.InstanceType)
+		old := live.InstanceTypes[i]
+		add(section, compare("capacity", old.Capacity, instanceType.Capacity)...)
+		add(section, compare("utility", old.Utility, instanceType.Utility)...)
+		add(section, compareJSON("launchSpec", old.LaunchSpec, instanceType.LaunchSpec, false)...)
+		add(section, compareJSON("userData", old.UserData, instanceType.UserData, false)...)
+		add(section, compareJSON("secrets", old.Secrets, instanceType.Secrets, true)...)
+		add(section, compareScopes(old.Scopes, instanceType.Scopes)...)
+	}
+	for _, instanceType := range live.InstanceTypes {
+		if _, removed := liveInstanceTypes[instanceType.InstanceType]; removed {
+			add("instance type "+instanceType.InstanceType, "removed")
+		}
+	}
+	return differences
+}
+
+// compare describes the change of a value from old to desired, if any
+func compare(name string, old, desired interface{}) []string {
+	if reflect.DeepEqual(old, desired) {
+		return nil
+	}
+	return []string{name + ": " + render(old) + " -> " + render(desired)}
+}
+
+// compareJSON describes the changes between two json values, key by key if
+// they are both objects. An empty value, null and {} are all considered the
+// same. If secret is true, the values themselves are not described.
+func compareJSON(name string, old, desired json.RawMessage, secret bool) []string {
+	var oldValue, desiredValue interface{}
+	json.Unmarshal(old, &oldValue)
+	json.Unmarshal(desired, &desiredValue)
+	oldObject, oldIsObject := oldValue.(map[string]interface{})
+	desiredObject, desiredIsObject := desiredValue.(map[string]interface{})
+	if oldValue == nil {
+		oldObject, oldIsObject = map[string]interface{}{}, true
+	}
+	if desiredValue == nil {
+		desiredObject, desiredIsObject = map[string]interface{}{}, true
+	}
+	if !oldIsObject || !desiredIsObject {
+		switch {
+		case reflect.DeepEqual(oldValue, desiredValue):
+			return nil
+		case secret:
+			return []string{name + " changed"}
+		}
+		return []string{name + ": " + render(oldValue) + " -> " + render(desiredValue)}
+	}
+	keys := []string{}
+	for key := range oldObject {
+		keys = append(keys, key)
+	}
+	for key := range desiredObject {
+		if _, ok := oldObject[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	descriptions := []string{}
+	for _, key := range keys {
+		oldValue, inOld := oldObject[key]
+		desiredValue, inDesired := desiredObject[key]
+		switch {
+		case reflect.DeepEqual(oldValue, desiredValue) && inOld == inDesired:
+		case secret && !inOld:
+			descriptions = append(descriptions, name+"."+key+" added")
+		case secret && !inDesired:
+			descriptions = append(descriptions, name+"."+key+" removed")
+		case secret:
+			descriptions = append(descriptions, name+"."+key+" changed")
+		case !inOld:
+			descriptions = append(descriptions, name+"."+key+" added: "+render(desiredValue))
+		case !inDesired:
+			descriptions = append(descriptions, name+"."+key+" removed")
+		default:
+			descriptions = append(descriptions, name+"."+key+": "+render(oldValue)+" -> "+render(desiredValue))
+		}
+	}
+	return descriptions
+}
+
+// compareScopes describes the scopes added and removed
+func compareScopes(old, desired []string) []string {
+	descriptions := []string{}
+	for _, scope := range desired {
+		if !contains(old, scope) {
+			descriptions = append(descriptions, "scope "+scope+" added")
+		}
+	}
+	for _, scope := range old {
+		if !contains(desired, scope) {
+			descriptions = append(descriptions, "scope "+scope+" removed")
+		}
+	}
+	return descriptions
+}
+
+// render returns value as compact json
+func render(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
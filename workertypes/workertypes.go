@@ -0,0 +1,231 @@
+// Package workertypes manages the worker types of the aws-provisioner
+// declaratively: worker type definitions are kept in files, validated, and
+// compared with the live definitions, giving a plan of the changes, which
+// can be reviewed before it is applied.
+//
+// Each definition is a json file named after its worker type, e.g.
+// gaia.json, containing the request body of
+// awsprovisioner.CreateWorkerType. Definition.LaunchSpecs gives the
+// effective launch spec of each region and instance type of a definition,
+// merged as by the aws-provisioner, for review offline.
+//
+// For example:
+//
+//	definitions, err := workertypes.Load("worker-types")
+//	if err != nil {
+//		// handle error, e.g. invalid definitions...
+//	}
+//	manager := workertypes.New(awsprovisioner.New("myClientId", "myAccessToken"))
+//	plan, err := manager.Plan(definitions)
+//	if err != nil {
+//		// handle error...
+//	}
+//	fmt.Print(plan)
+//	err = manager.Apply(plan)
+package workertypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/taskcluster/taskcluster-client-go/awsprovisioner"
+	"github.com/taskcluster/taskcluster-client-go/schemacheck"
+	D "github.com/tj/go-debug"
+)
+
+var (
+	// Used for logging based on DEBUG environment variable
+	// See github.com/tj/go-debug
+	debug = D.Debug("workertypes")
+
+	// Syntax of worker type names, from the aws-provisioner schemas
+	workerTypePattern = regexp.MustCompile(`^[A-Za-z0-9+/=_-]{1,22}$`)
+)
+
+// Definition is a worker type definition.
+type Definition struct {
+	WorkerType string
+	// File the definition was loaded from, if any
+	File    string
+	Request *awsprovisioner.CreateWorkerTypeRequest
+}
+
+// ValidationError is returned by Load and Definition.Validate when
+// definitions are not valid, and lists all of the problems found.
+type ValidationError struct {
+	Problems []string
+}
+
+func (err *ValidationError) Error() string {
+	return "invalid worker type definitions:\n  * " + strings.Join(err.Problems, "\n  * ")
+}
+
+// Load reads the worker type definitions from the given json files, and
+// directories of json files, and validates them. The worker type of each
+// definition is the name of its file, without the .json extension. Unknown
+// fields, which would be dropped when the definition is sent to the
+// aws-provisioner, are not allowed, to catch typos. If any definitions are
+// invalid, a *ValidationError is returned listing the problems of all of
+// them.
+func Load(paths ...string) ([]*Definition, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	definitions := []*Definition{}
+	definedIn := map[string]string{}
+	invalid := &ValidationError{}
+	for _, file := range files {
+		d, err := loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := definedIn[d.WorkerType]; ok {
+			invalid.Problems = append(invalid.Problems, fmt.Sprintf("%v: worker type %v is also defined in %v", file, d.WorkerType, other))
+			continue
+		}
+		definedIn[d.WorkerType] = file
+		if err := d.Validate(); err != nil {
+			invalid.Problems = append(invalid.Problems, err.(*ValidationError).Problems...)
+		}
+		definitions = append(definitions, d)
+	}
+	if len(invalid.Problems) > 0 {
+		return nil, invalid
+	}
+	sort.Sort(byWorkerType(definitions))
+	return definitions, nil
+}
+
+func loadFile(file string) (*Definition, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	d := &Definition{
+		WorkerType: strings.TrimSuffix(filepath.Base(file), ".json"),
+		File:       file,
+		Request:    new(awsprovisioner.CreateWorkerTypeRequest),
+	}
+	err = json.Unmarshal(data, d.Request)
+	if err == nil {
+		err = schemacheck.CheckFields(data, d.Request)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", file, err)
+	}
+	debug("Loaded worker type %v from %v", d.WorkerType, file)
+	return d, nil
+}
+
+// Validate checks the definition for problems which the aws-provisioner
+// would reject, or which would stop it from provisioning instances, e.g.
+// regions without an AMI, and returns a *ValidationError listing them.
+func (d *Definition) Validate() error {
+	problems := []string{}
+	problem := func(format string, a ...interface{}) {
+		problems = append(problems, d.name()+": "+fmt.Sprintf(format, a...))
+	}
+	r := d.Request
+	if !workerTypePattern.MatchString(d.WorkerType) {
+		problem("worker type name does not match %v", workerTypePattern)
+	}
+
+	if r.MinCapacity < 0 {
+		problem("minCapacity %v is negative", r.MinCapacity)
+	}
+	if r.MaxCapacity <= 0 {
+		problem("maxCapacity %v is not positive", r.MaxCapacity)
+	}
+	if r.MinCapacity > r.MaxCapacity {
+		problem("minCapacity %v is greater than maxCapacity %v", r.MinCapacity, r.MaxCapacity)
+	}
+	if r.MinPrice < 0 {
+		problem("minPrice %v is negative", r.MinPrice)
+	}
+	if r.MaxPrice <= 0 {
+		problem("maxPrice %v is not positive", r.MaxPrice)
+	}
+	if r.MinPrice > r.MaxPrice {
+		problem("minPrice %v is greater than maxPrice %v", r.MinPrice, r.MaxPrice)
+	}
+	if r.ScalingRatio < 0 {
+		problem("scalingRatio %v is negative", r.ScalingRatio)
+	}
+
+	if len(r.Regions) == 0 {
+		problem("no regions")
+	}
+	regions := map[string]bool{}
+	for _, region := range r.Regions {
+		switch {
+		case region.Region == "":
+			problem("region without a name")
+		case regions[region.Region]:
+			problem("region %v is defined more than once", region.Region)
+		case region.LaunchSpec.ImageId == "":
+			problem("region %v has no launchSpec.ImageId (AMI)", region.Region)
+		}
+		regions[region.Region] = true
+	}
+
+	if len(r.InstanceTypes) == 0 {
+		problem("no instance types")
+	}
+	instanceTypes := map[string]bool{}
+	for _, instanceType := range r.InstanceTypes {
+		switch {
+		case instanceType.InstanceType == "":
+			problem("instance type without a name")
+		case instanceTypes[instanceType.InstanceType]:
+			problem("instance type %v is defined more than once", instanceType.InstanceType)
+		}
+		if instanceType.Capacity <= 0 {
+			problem("instance type %v has capacity %v, which is not positive", instanceType.InstanceType, instanceType.Capacity)
+		}
+		if instanceType.Utility <= 0 {
+			problem("instance type %v has utility %v, which is not positive", instanceType.InstanceType, instanceType.Utility)
+		}
+		instanceTypes[instanceType.InstanceType] = true
+	}
+	for _, p := range d.reservedKeyProblems() {
+		problem("%v", p)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// name returns the worker type, and the file it was loaded from, if any
+func (d *Definition) name() string {
+	if d.File != "" {
+		return d.File + " (" + d.WorkerType + ")"
+	}
+	return d.WorkerType
+}
+
+type byWorkerType []*Definition
+
+func (b byWorkerType) Len() int           { return len(b) }
+func (b byWorkerType) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byWorkerType) Less(i, j int) bool { return b[i].WorkerType < b[j].WorkerType }
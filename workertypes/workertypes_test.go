@@ -0,0 +1,201 @@
+package workertypes
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/taskcluster/taskcluster-client-go/awsprovisioner"
+)
+
+const gaia = `{
+  "minCapacity": 0,
+  "maxCapacity": 10,
+  "minPrice": 0,
+  "maxPrice": 2,
+  "scalingRatio": 0,
+  "canUseOndemand": false,
+  "canUseSpot": true,
+  "launchSpec": {"SecurityGroups": ["docker-worker"]},
+  "userData": {},
+  "secrets": {"token": "hunter2"},
+  "scopes": ["queue:create-artifact:*"],
+  "regions": [
+    {"region": "us-west-2", "launchSpec": {"ImageId": "ami-1a2b3c4d"}, "userData": {}, "secrets": {}, "scopes": []},
+    {"region": "us-east-1", "launchSpec": {"ImageId": "ami-2b3c4d5e"}, "userData": {}, "secrets": {}, "scopes": []}
+  ],
+  "instanceTypes": [
+    {"instanceType": "c3.xlarge", "capacity": 1, "utility": 1, "launchSpec": {}, "userData": {}, "secrets": {}, "scopes": []}
+  ]
+}`
+
+// fakeProvisioner is an in-memory aws-provisioner, holding worker type
+// definitions as json, by worker type
+type fakeProvisioner struct {
+	mutex       sync.Mutex
+	workerTypes map[string]json.RawMessage
+}
+
+func (f *fakeProvisioner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	workerType := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/worker-type/"), "/update")
+	switch {
+	case r.URL.Path == "/list-worker-types":
+		list := awsprovisioner.ListWorkerTypes{}
+		for workerType := range f.workerTypes {
+			list = append(list, workerType)
+		}
+		json.NewEncoder(w).Encode(list)
+	case f.workerTypes[workerType] == nil && r.Method != "PUT":
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == "GET":
+		w.Write(f.workerTypes[workerType])
+	case r.Method == "PUT" || r.Method == "POST":
+		body, _ := ioutil.ReadAll(r.Body)
+		f.workerTypes[workerType] = body
+		w.Write(body)
+	case r.Method == "DELETE":
+		delete(f.workerTypes, workerType)
+	}
+}
+
+// newTestManager returns a Manager using a fakeProvisioner with the given
+// worker types
+func newTestManager(workerTypes map[string]json.RawMessage) (*Manager, *fakeProvisioner, func()) {
+	f := &fakeProvisioner{workerTypes: workerTypes}
+	server := httptest.NewServer(f)
+	myProvisioner := awsprovisioner.New("", "")
+	myProvisioner.Authenticate = false
+	myProvisioner.BaseURL = server.URL
+	return New(myProvisioner), f, server.Close
+}
+
+// writeDefinitions writes the given definitions, by worker type, to a temp
+// dir, and returns it
+func writeDefinitions(t *testing.T, definitions map[string]string) string {
+	dir, err := ioutil.TempDir("", "workertypes")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	for workerType, definition := range definitions {
+		if err := ioutil.WriteFile(filepath.Join(dir, workerType+".json"), []byte(definition), 0644); err != nil {
+			t.Fatalf("Could not write definition: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestLoadInvalid(t *testing.T) {
+	invalid := strings.NewReplacer(
+		`"maxCapacity": 10`, `"maxCapacity": -1`,
+		`"maxPrice": 2`, `"maxPrice": 0`,
+		`"ImageId": "ami-2b3c4d5e"`, `"ImageId": ""`,
+		`"capacity": 1`, `"capacity": 0`,
+	).Replace(gaia)
+	dir := writeDefinitions(t, map[string]string{"gaia": gaia, "b2gtest": invalid})
+	defer os.RemoveAll(dir)
+	_, err := Load(dir)
+	if err == nil {
+		t.Fatalf("Expected invalid definition to be rejected")
+	}
+	problems := err.(*ValidationError).Problems
+	for _, expected := range []string{
+		"maxCapacity -1 is not positive",
+		"minCapacity 0 is greater than maxCapacity -1",
+		"maxPrice 0 is not positive",
+		"region us-east-1 has no launchSpec.ImageId (AMI)",
+		"instance type c3.xlarge has capacity 0, which is not positive",
+	} {
+		found := false
+		for _, problem := range problems {
+			found = found || strings.HasSuffix(problem, "(b2gtest): "+expected)
+		}
+		if !found {
+			t.Errorf("Expected problem %q, but got:\n%v", expected, err)
+		}
+	}
+	if len(problems) != 5 {
+		t.Errorf("Expected 5 problems, but got:\n%v", err)
+	}
+
+	typo := writeDefinitions(t, map[string]string{"gaia": strings.Replace(gaia, "maxCapacity", "maxCapactiy", 1)})
+	defer os.RemoveAll(typo)
+	if _, err := Load(typo); err == nil || !strings.Contains(err.Error(), "maxCapactiy") {
+		t.Errorf("Expected unknown field to be rejected, but got %v", err)
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	live := strings.NewReplacer(
+		`"maxCapacity": 10`, `"maxCapacity": 5`,
+		`"ImageId": "ami-1a2b3c4d"`, `"ImageId": "ami-0f0f0f0f"`,
+		`"token": "hunter2"`, `"token": "correcthorse"`,
+		`"instanceType": "c3.xlarge"`, `"instanceType": "m3.large"`,
+	).Replace(gaia)
+	// live definitions have the worker type and when they were last modified
+	live = strings.Replace(live, "{", `{"workerType": "gaia", "lastModified": "2015-10-27T20:36:19.255Z",`, 1)
+	m, f, done := newTestManager(map[string]json.RawMessage{
+		"gaia":       json.RawMessage(live),
+		"old-worker": json.RawMessage(gaia),
+		"b2gbuild":   json.RawMessage(gaia),
+	})
+	defer done()
+	m.Prune = true
+	dir := writeDefinitions(t, map[string]string{"gaia": gaia, "b2gtest": gaia, "b2gbuild": gaia})
+	defer os.RemoveAll(dir)
+	definitions, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Could not load definitions: %v", err)
+	}
+
+	plan, err := m.Plan(definitions)
+	if err != nil {
+		t.Fatalf("Could not plan changes: %v", err)
+	}
+	expected := `+ create b2gtest
+    regions: us-west-2, us-east-1
+    instance types: c3.xlarge
+~ update gaia
+    maxCapacity: 5 -> 10
+    secrets.token changed
+    region us-west-2:
+      launchSpec.ImageId: "ami-0f0f0f0f" -> "ami-1a2b3c4d"
+    instance type c3.xlarge:
+      added
+    instance type m3.large:
+      removed
+- remove old-worker
+
+Plan: 1 to create, 1 to update, 1 to remove, 1 unchanged.
+`
+	if plan.String() != expected {
+		t.Errorf("Expected plan\n%v\nbut got\n%v", expected, plan)
+	}
+
+	if err := m.Apply(plan); err != nil {
+		t.Fatalf("Could not apply plan: %v", err)
+	}
+	workerTypes := []string{}
+	for workerType := range f.workerTypes {
+		workerTypes = append(workerTypes, workerType)
+	}
+	sort.Strings(workerTypes)
+	if strings.Join(workerTypes, " ") != "b2gbuild b2gtest gaia" {
+		t.Errorf("Unexpected worker types after applying plan: %v", workerTypes)
+	}
+	plan, err = m.Plan(definitions)
+	if err != nil {
+		t.Fatalf("Could not plan changes: %v", err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("Expected no changes after applying plan, but got\n%v", plan)
+	}
+}